@@ -0,0 +1,346 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// aiffHeaderSize is the number of bytes written by writeFormChunk,
+// writeCommonChunk and writeSoundChunk before the first sample.
+const aiffHeaderSize = 12 + 26 + 16
+
+// AIFF has no float or little endian samples, so they're written as AIFF-C,
+// which adds a version chunk and names the sample type at the end of the
+// COMM chunk.
+const (
+	// aifcVersionSize is the size of the FVER chunk.
+	aifcVersionSize = 12
+
+	// aifcVersion is the only AIFF-C version timestamp.
+	aifcVersion = 0xA2805140
+	// aifcFloatName names the fl32 compression type and aifcSowtName the
+	// sowt one. With their length bytes they have even sizes, so they
+	// need no padding.
+	aifcFloatName = "32-bit floating point"
+	aifcSowtName  = "little endian"
+)
+
+// aifcCompression returns the AIFF-C compression type and name of samples
+// in pf, or an empty type for samples that plain AIFF can hold.
+func aifcCompression(pf pcmFormat) (string, string) {
+	switch {
+	case pf.float:
+		return "fl32", aifcFloatName
+	case pf.sowt:
+		return "sowt", aifcSowtName
+	}
+	return "", ""
+}
+
+// aifcCommonExtra returns the size of what AIFF-C adds to the end of the
+// COMM chunk for pf, the compression type and the length byte and text of
+// its name, or 0 for plain AIFF.
+func aifcCommonExtra(pf pcmFormat) int {
+	id, name := aifcCompression(pf)
+	if id == "" {
+		return 0
+	}
+	return 4 + 1 + len(name)
+}
+
+// aifcExtra returns the bytes AIFF-C adds before the first sample of pf,
+// or 0 for plain AIFF.
+func aifcExtra(pf pcmFormat) int {
+	if extra := aifcCommonExtra(pf); extra > 0 {
+		return aifcVersionSize + extra
+	}
+	return 0
+}
+
+func writeFormChunk(w io.Writer, pf pcmFormat) error {
+	// http://paulbourke.net/dataformats/audio/
+
+	// header
+	if _, err := io.WriteString(w, "FORM"); err != nil {
+		return err
+	}
+
+	// total bytes
+	if err := binary.Write(w, binary.BigEndian, int32(0)); err != nil {
+		return err
+	}
+
+	// header
+	formType := "AIFF"
+	if id, _ := aifcCompression(pf); id != "" {
+		formType = "AIFC"
+	}
+	if _, err := io.WriteString(w, formType); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func writeVersionChunk(w io.Writer) error {
+	// http://www-mmsp.ece.mcgill.ca/Documents/AudioFormats/AIFF/Docs/AIFF-C.9.26.91.pdf
+
+	// header
+	if _, err := io.WriteString(w, "FVER"); err != nil {
+		return err
+	}
+	// size
+	if err := binary.Write(w, binary.BigEndian, int32(4)); err != nil {
+		return err
+	}
+	// timestamp of the AIFF-C version
+	if err := binary.Write(w, binary.BigEndian, uint32(aifcVersion)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func writeCommonChunk(w io.Writer, pf pcmFormat) error {
+	// http://paulbourke.net/dataformats/audio/
+
+	sr := extendedFloat(pf.sampleRate)
+
+	// header
+	if _, err := io.WriteString(w, "COMM"); err != nil {
+		return err
+	}
+	// size
+	size := 18 + aifcCommonExtra(pf)
+	if err := binary.Write(w, binary.BigEndian, int32(size)); err != nil {
+		return err
+	}
+	// channels
+	if err := binary.Write(w, binary.BigEndian, int16(pf.channels)); err != nil {
+		return err
+	}
+	// number of samples
+	if err := binary.Write(w, binary.BigEndian, int32(0)); err != nil {
+		return err
+	}
+	// bits per sample
+	if err := binary.Write(w, binary.BigEndian, int16(pf.bitDepth)); err != nil {
+		return err
+	}
+	// 80-bit sample rate
+	if _, err := w.Write(sr[:]); err != nil {
+		return err
+	}
+
+	id, name := aifcCompression(pf)
+	if id == "" {
+		return nil
+	}
+
+	// compression type
+	if _, err := io.WriteString(w, id); err != nil {
+		return err
+	}
+	// compression name, whose length byte makes its size even
+	if _, err := w.Write(append([]byte{byte(len(name))}, name...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func writeSoundChunk(w io.Writer) error {
+	// http://paulbourke.net/dataformats/audio/
+
+	// header
+	if _, err := io.WriteString(w, "SSND"); err != nil {
+		return err
+	}
+	// size
+	if err := binary.Write(w, binary.BigEndian, int32(0)); err != nil {
+		return err
+	}
+	// offset
+	if err := binary.Write(w, binary.BigEndian, int32(0)); err != nil {
+		return err
+	}
+	// block
+	if err := binary.Write(w, binary.BigEndian, int32(0)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// encodeMarkChunk returns a MARK chunk holding a marker for each cue
+// other than the start and stop of the recording, so that editors can
+// jump to them, or nothing when there are none. Markers are numbered
+// from 1 and their names are cut to the 255 bytes a pstring can hold.
+func encodeMarkChunk(cues []cuePoint) []byte {
+	var markers bytes.Buffer
+	n := 0
+	for _, c := range cues {
+		if c.name == cueStart || c.name == cueStop {
+			continue
+		}
+		n++
+
+		name := c.name
+		if len(name) > 255 {
+			name = name[:255]
+		}
+		binary.Write(&markers, binary.BigEndian, int16(n))
+		binary.Write(&markers, binary.BigEndian, uint32(c.frame))
+		markers.WriteByte(byte(len(name)))
+		markers.WriteString(name)
+		// the length byte and text of a pstring are padded to an even size.
+		if len(name)%2 == 0 {
+			markers.WriteByte(0)
+		}
+	}
+
+	if n == 0 {
+		return nil
+	}
+
+	var chunk bytes.Buffer
+	chunk.WriteString("MARK")
+	binary.Write(&chunk, binary.BigEndian, int32(2+markers.Len()))
+	binary.Write(&chunk, binary.BigEndian, uint16(n))
+	chunk.Write(markers.Bytes())
+	return chunk.Bytes()
+}
+
+// extendedFloat encodes a sample rate as the big-endian IEEE 754 80-bit
+// extended precision float that the COMM chunk expects.
+func extendedFloat(n int) [10]byte {
+	var b [10]byte
+	if n <= 0 {
+		return b
+	}
+
+	// the mantissa has an explicit integer bit, so shift the
+	// most significant bit of n into bit 63.
+	e := bits.Len64(uint64(n)) - 1
+	binary.BigEndian.PutUint16(b[:2], uint16(16383+e))
+	binary.BigEndian.PutUint64(b[2:], uint64(n)<<uint(63-e))
+	return b
+}
+
+// aiffSizes returns the FORM size, COMM numSampleFrames and SSND size
+// fields for a recording of numSamples interleaved samples followed
+// by trailer bytes of other chunks.
+func aiffSizes(pf pcmFormat, numSamples, trailer int) []sizeField {
+	dataBytes := pf.bytesPerSample() * numSamples
+
+	headerSize, framesOffset, soundOffset := aiffHeaderSize+aifcExtra(pf), int64(22), int64(42)
+	if aifcExtra(pf) > 0 {
+		framesOffset += aifcVersionSize
+		soundOffset += int64(aifcExtra(pf))
+	}
+
+	return []sizeField{
+		// FORM size covers everything after its own id and size fields.
+		{name: "form size", offset: 4, value: int32(headerSize - 8 + dataBytes + trailer)},
+		{name: "sample frames", offset: framesOffset, value: int32(pf.frames(numSamples))},
+		{name: "sound size", offset: soundOffset, value: int32(dataBytes + 8)},
+	}
+}
+
+// extendedToInt decodes an 80-bit extended precision sample rate,
+// discarding any fractional part.
+func extendedToInt(b [10]byte) int {
+	e := int(binary.BigEndian.Uint16(b[:2])&0x7fff) - 16383
+	if e < 0 || e > 62 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(b[2:]) >> uint(63-e))
+}
+
+// parseAIFF reads the chunks of an AIFF file whose FORM id has already been read.
+func parseAIFF(r io.ReadSeeker) (audioFile, error) {
+	var form struct {
+		Size uint32
+		Type [4]byte
+	}
+	if err := binary.Read(r, binary.BigEndian, &form); err != nil {
+		return audioFile{}, fmt.Errorf("failed to read form chunk : %v", err)
+	}
+	aifc := string(form.Type[:]) == "AIFC"
+	if string(form.Type[:]) != "AIFF" && !aifc {
+		return audioFile{}, fmt.Errorf("unsupported form type %q", form.Type[:])
+	}
+
+	af := audioFile{format: formatAIFF, formSize: int64(form.Size)}
+
+	var foundCommon, foundSound bool
+	for pos := int64(12); !foundCommon || !foundSound; {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(r, binary.BigEndian, &chunk); err != nil {
+			return audioFile{}, fmt.Errorf("failed to read chunk header : %v", err)
+		}
+		pos += 8
+
+		switch string(chunk.ID[:]) {
+		case "COMM":
+			var comm struct {
+				Channels   int16
+				NumFrames  uint32
+				BitDepth   int16
+				SampleRate [10]byte
+			}
+			if err := binary.Read(r, binary.BigEndian, &comm); err != nil {
+				return audioFile{}, fmt.Errorf("failed to read common chunk : %v", err)
+			}
+			af.channels = int(comm.Channels)
+			af.numFrames = int(comm.NumFrames)
+			af.bitDepth = int(comm.BitDepth)
+			af.sampleRate = extendedToInt(comm.SampleRate)
+			foundCommon = true
+
+			// AIFF-C names the sample type after the sample rate.
+			if !aifc {
+				break
+			}
+
+			var compression [4]byte
+			if err := binary.Read(r, binary.BigEndian, &compression); err != nil {
+				return audioFile{}, fmt.Errorf("failed to read compression type : %v", err)
+			}
+
+			switch string(compression[:]) {
+			case "NONE":
+			case "fl32", "FL32":
+				af.float = true
+			case "sowt":
+				af.sowt = true
+			default:
+				return audioFile{}, fmt.Errorf("unsupported aiff-c compression type %q", compression[:])
+			}
+		case "SSND":
+			var ssnd struct{ Offset, BlockSize uint32 }
+			if err := binary.Read(r, binary.BigEndian, &ssnd); err != nil {
+				return audioFile{}, fmt.Errorf("failed to read sound chunk : %v", err)
+			}
+			af.dataOffset = pos + 8 + int64(ssnd.Offset)
+			if af.dataSize = int64(chunk.Size) - 8 - int64(ssnd.Offset); af.dataSize < 0 {
+				af.dataSize = 0
+			}
+			foundSound = true
+		}
+
+		// chunks are padded to an even length.
+		pos += int64(chunk.Size) + int64(chunk.Size&1)
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return audioFile{}, fmt.Errorf("failed to seek to next chunk : %v", err)
+		}
+	}
+
+	if af.channels < 1 || af.sampleRate < 1 || !validBitDepth(af.bitDepth) || (af.float && af.bitDepth != 32) {
+		return audioFile{}, fmt.Errorf("unsupported common chunk : %d channels, %d Hz, %d bits", af.channels, af.sampleRate, af.bitDepth)
+	}
+	return af, nil
+}
@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// unhex decodes hex spread over several strings, ignoring spaces.
+func unhex(t *testing.T, parts ...string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(strings.Replace(strings.Join(parts, ""), " ", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestWriteFormChunk(t *testing.T) {
+	tests := []struct {
+		name string
+		pf   pcmFormat
+		want string
+	}{
+		{name: "aiff", pf: pcmFormat{sampleRate: 44100, channels: 2, bitDepth: 16}, want: "464f524d 00000000 41494646"},
+		{name: "float samples are aifc", pf: pcmFormat{sampleRate: 44100, channels: 1, bitDepth: 32, float: true}, want: "464f524d 00000000 41494643"},
+		{name: "sowt samples are aifc", pf: pcmFormat{sampleRate: 44100, channels: 1, bitDepth: 16, sowt: true}, want: "464f524d 00000000 41494643"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeFormChunk(&buf, tt.pf); err != nil {
+				t.Fatal(err)
+			}
+			if want := unhex(t, tt.want); !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("wrote % x, want % x", buf.Bytes(), want)
+			}
+		})
+	}
+}
+
+func TestWriteCommonChunk(t *testing.T) {
+	tests := []struct {
+		name string
+		pf   pcmFormat
+		// want is the chunk after its id and size, starting with the channels.
+		want string
+	}{
+		{
+			name: "44.1 kHz stereo 16 bit",
+			pf:   pcmFormat{sampleRate: 44100, channels: 2, bitDepth: 16},
+			want: "0002 00000000 0010 400eac44000000000000",
+		},
+		{
+			name: "48 kHz mono 24 bit",
+			pf:   pcmFormat{sampleRate: 48000, channels: 1, bitDepth: 24},
+			want: "0001 00000000 0018 400ebb80000000000000",
+		},
+		{
+			name: "8 kHz 6 channels 32 bit",
+			pf:   pcmFormat{sampleRate: 8000, channels: 6, bitDepth: 32},
+			want: "0006 00000000 0020 400bfa00000000000000",
+		},
+		{
+			name: "96 kHz float",
+			pf:   pcmFormat{sampleRate: 96000, channels: 2, bitDepth: 32, float: true},
+			want: "0002 00000000 0020 400fbb80000000000000 666c3332 15" + hex.EncodeToString([]byte(aifcFloatName)),
+		},
+		{
+			name: "sowt",
+			pf:   pcmFormat{sampleRate: 22050, channels: 1, bitDepth: 16, sowt: true},
+			want: "0001 00000000 0010 400dac44000000000000 736f7774 0d" + hex.EncodeToString([]byte(aifcSowtName)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeCommonChunk(&buf, tt.pf); err != nil {
+				t.Fatal(err)
+			}
+			b := buf.Bytes()
+
+			if id := string(b[:4]); id != "COMM" {
+				t.Fatalf("chunk id is %q, want COMM", id)
+			}
+			if size := binary.BigEndian.Uint32(b[4:8]); int(size) != len(b)-8 {
+				t.Errorf("chunk size is %d, but %d bytes follow it", size, len(b)-8)
+			}
+			if size := len(b) - 8; size%2 != 0 {
+				t.Errorf("chunk size %d isn't even", size)
+			}
+			if want := unhex(t, tt.want); !bytes.Equal(b[8:], want) {
+				t.Errorf("wrote % x, want % x", b[8:], want)
+			}
+			var sr [10]byte
+			copy(sr[:], b[16:26])
+			if rate := extendedToInt(sr); rate != tt.pf.sampleRate {
+				t.Errorf("sample rate reads back as %d, want %d", rate, tt.pf.sampleRate)
+			}
+		})
+	}
+}
+
+func TestWriteSoundChunk(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSoundChunk(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// the id, then a size, offset and block size that are filled in or left at 0.
+	if want := unhex(t, "53534e44 00000000 00000000 00000000"); !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("wrote % x, want % x", buf.Bytes(), want)
+	}
+}
+
+func TestEncodeMarkChunk(t *testing.T) {
+	cues := []cuePoint{
+		{frame: 0, name: cueStart},
+		{frame: 1000, name: "intro"},
+		{frame: 10000, name: "chorus"},
+		{frame: 12000, name: cueStop},
+	}
+
+	// the count, then the id, position and name of each marker. The
+	// pstring of the 6 byte name is padded to an even size.
+	want := unhex(t,
+		"4d41524b 0000001c 0002",
+		"0001 000003e8 05 696e74726f",
+		"0002 00002710 06 63686f727573 00",
+	)
+	b := encodeMarkChunk(cues)
+	if !bytes.Equal(b, want) {
+		t.Errorf("wrote % x, want % x", b, want)
+	}
+	if size := binary.BigEndian.Uint32(b[4:]); int(size) != len(b)-8 || size%2 != 0 {
+		t.Errorf("chunk size %d doesn't cover the %d bytes after it or isn't even", size, len(b)-8)
+	}
+
+	if b := encodeMarkChunk([]cuePoint{cues[0], cues[3]}); b != nil {
+		t.Errorf("wrote % x without markers, want nothing", b)
+	}
+
+	long := encodeMarkChunk([]cuePoint{{frame: 1, name: strings.Repeat("a", 300)}})
+	if n := long[16]; n != 255 || len(long) != 8+2+2+4+1+255 {
+		t.Errorf("a 300 byte name is written as %d bytes in a %d byte chunk, want 255 in %d", n, len(long), 8+2+2+4+1+255)
+	}
+}
+
+func TestHeaderSize(t *testing.T) {
+	for _, pf := range []pcmFormat{
+		{sampleRate: 44100, channels: 2, bitDepth: 16},
+		{sampleRate: 44100, channels: 2, bitDepth: 32, float: true},
+		{sampleRate: 44100, channels: 2, bitDepth: 16, sowt: true},
+	} {
+		var buf bytes.Buffer
+		if err := writeHeader(&buf, formatAIFF, pf); err != nil {
+			t.Fatal(err)
+		}
+		if size := headerSize(formatAIFF, pf); int64(buf.Len()) != size {
+			t.Errorf("%+v : writeHeader wrote %d bytes, headerSize says %d", pf, buf.Len(), size)
+		}
+	}
+}
+
+// TestEmptyRecordingGolden compares an empty recording, once its sizes are
+// filled in, with a golden file. go test -update rewrites the golden files.
+func TestEmptyRecordingGolden(t *testing.T) {
+	tests := []struct {
+		golden string
+		pf     pcmFormat
+	}{
+		{golden: "empty.aiff", pf: pcmFormat{sampleRate: 44100, channels: 2, bitDepth: 16}},
+		{golden: "empty_float.aifc", pf: pcmFormat{sampleRate: 48000, channels: 1, bitDepth: 32, float: true}},
+		{golden: "empty_sowt.aifc", pf: pcmFormat{sampleRate: 44100, channels: 2, bitDepth: 16, sowt: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			f := &memoryFile{}
+			if err := writeHeader(f, formatAIFF, tt.pf); err != nil {
+				t.Fatal(err)
+			}
+			if err := fillSizes(f, formatAIFF, tt.pf, 0, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := ioutil.WriteFile(path, f.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(f.Bytes(), want) {
+				t.Errorf("wrote % x, want % x", f.Bytes(), want)
+			}
+
+			// what's written has to read back as the same empty recording.
+			af, err := readHeader(bytes.NewReader(want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if af.pcmFormat != tt.pf || af.numFrames != 0 || af.dataSize != 0 || af.formSize+8 != int64(len(want)) {
+				t.Errorf("golden file reads back as %+v", af)
+			}
+		})
+	}
+}
+
+// TestSowtRecordingStructure walks the chunks of a sowt recording and checks
+// them against the AIFF-C spec: an AIFC form holding the FVER chunk of the
+// 1990 version, a COMM chunk naming the sowt compression type and an SSND
+// chunk of little endian samples, with every size covering what follows it.
+func TestSowtRecordingStructure(t *testing.T) {
+	pf := pcmFormat{sampleRate: 44100, channels: 2, bitDepth: 16, sowt: true}
+	rec := recording{format: formatAIFF, order: binary.LittleEndian, pcmFormat: pf}
+
+	f := &memoryFile{}
+	enc, err := newEncoder(f, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.WriteFrames([]int32{0x0102, -2, 3, 0x7ffe}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := f.Bytes()
+	be := binary.BigEndian
+	if id, size, form := string(b[:4]), be.Uint32(b[4:]), string(b[8:12]); id != "FORM" || int(size) != len(b)-8 || form != "AIFC" {
+		t.Fatalf("form is %q of %d bytes holding %q, want FORM of %d holding AIFC", id, size, form, len(b)-8)
+	}
+
+	chunks := map[string][]byte{}
+	var ids []string
+	for rest := b[12:]; len(rest) > 0; {
+		if len(rest) < 8 {
+			t.Fatalf("%d bytes are left after the last chunk", len(rest))
+		}
+		id, size := string(rest[:4]), int(be.Uint32(rest[4:]))
+		if 8+size > len(rest) {
+			t.Fatalf("%s chunk of %d bytes runs past the form", id, size)
+		}
+		chunks[id], ids = rest[8:8+size], append(ids, id)
+		rest = rest[8+size+size%2:]
+	}
+	if got := strings.Join(ids, " "); got != "FVER COMM SSND" {
+		t.Fatalf("chunks are %s, want FVER COMM SSND", got)
+	}
+
+	if fver := chunks["FVER"]; len(fver) != 4 || be.Uint32(fver) != 0xa2805140 {
+		t.Errorf("FVER chunk is % x, want the timestamp a2805140", fver)
+	}
+
+	// channels, frames, bits, rate, then the compression type and its name as a pstring.
+	comm := chunks["COMM"]
+	if len(comm) < 23 {
+		t.Fatalf("COMM chunk is only %d bytes", len(comm))
+	}
+	if channels, frames, bits := be.Uint16(comm), be.Uint32(comm[2:]), be.Uint16(comm[6:]); channels != 2 || frames != 2 || bits != 16 {
+		t.Errorf("COMM records %d channels, %d frames of %d bits, want 2, 2 of 16", channels, frames, bits)
+	}
+	var rate [10]byte
+	copy(rate[:], comm[8:18])
+	if got := extendedToInt(rate); got != pf.sampleRate {
+		t.Errorf("COMM records a rate of %d, want %d", got, pf.sampleRate)
+	}
+	if compression := string(comm[18:22]); compression != "sowt" {
+		t.Errorf("compression type is %q, want sowt", compression)
+	}
+	if n := int(comm[22]); 23+n > len(comm) || string(comm[23:23+n]) != aifcSowtName {
+		t.Errorf("compression name is % x, want the pstring %q", comm[22:], aifcSowtName)
+	}
+
+	// the offset and block size, then the samples.
+	ssnd := chunks["SSND"]
+	if want := unhex(t, "00000000 00000000 0201 feff 0300 fe7f"); !bytes.Equal(ssnd, want) {
+		t.Errorf("SSND chunk is % x, want % x", ssnd, want)
+	}
+}
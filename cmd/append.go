@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// openAppend opens the existing recording name so that rec continues it.
+// It sets rec.existingSamples and leaves the file positioned at the end of
+// its sample data. A file that doesn't exist yet is created instead.
+func openAppend(name string, rec *recording) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return os.Create(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := seekAppend(f, rec); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// seekAppend checks that f holds a recording with the same parameters as rec
+// and seeks to the end of its sample data.
+func seekAppend(f *os.File, rec *recording) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	af, err := readHeader(f)
+	if err != nil {
+		return fmt.Errorf("can't append to an invalid recording : %v", err)
+	}
+
+	if af.format != rec.format || af.pcmFormat != rec.pcmFormat {
+		return fmt.Errorf("can't append %s at %d Hz, %d channels, %d bits to %s at %d Hz, %d channels, %d bits",
+			rec.format, rec.sampleRate, rec.channels, rec.bitDepth, af.format, af.sampleRate, af.channels, af.bitDepth)
+	}
+
+	// the pad byte after sample data of odd length is overwritten by the first samples appended.
+	end := af.dataOffset + af.dataSize
+	if end+int64(len(af.dataPad(int(af.dataSize)/af.bytesPerSample()))) != fi.Size() {
+		return fmt.Errorf("can't append because the sample data doesn't end the file")
+	}
+
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to the end of the sample data : %v", err)
+	}
+
+	rec.existingSamples = int(af.dataSize) / rec.bytesPerSample()
+	rec.appending = true
+	return nil
+}
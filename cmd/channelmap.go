@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseChannelMap parses a --channel-map, a comma separated list of the
+// device channels to record counted from 0. A channel can be listed more
+// than once, like to record a single microphone to both sides of a stereo file.
+func parseChannelMap(s string) ([]int, error) {
+	var picks []int
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		ch, err := strconv.Atoi(field)
+		if err != nil || ch < 0 {
+			return nil, fmt.Errorf("invalid channel map %q : %q isn't a channel number counted from 0", s, field)
+		}
+		picks = append(picks, ch)
+	}
+	return picks, nil
+}
+
+// mappedChannels returns the number of channels a device has to be
+// opened with to capture every channel in picks.
+func mappedChannels(picks []int) int {
+	var channels int
+	for _, ch := range picks {
+		if ch+1 > channels {
+			channels = ch + 1
+		}
+	}
+	return channels
+}
+
+// newCaptureBuffer returns an empty capture buffer of n samples of the same type as buf.
+func newCaptureBuffer(buf interface{}, n int) interface{} {
+	switch buf.(type) {
+	case []int16:
+		return make([]int16, n)
+	case []float32:
+		return make([]float32, n)
+	}
+	return make([]int32, n)
+}
+
+// selectChannels copies the channels in picks out of each frame of the
+// interleaved frames of channels samples in src, in the order they're
+// listed, to dst. Both are capture buffers of the same type.
+func selectChannels(dst, src interface{}, channels int, picks []int) {
+	switch s := src.(type) {
+	case []int16:
+		d := dst.([]int16)
+		for f := 0; f*channels < len(s) && (f+1)*len(picks) <= len(d); f++ {
+			for i, ch := range picks {
+				d[f*len(picks)+i] = s[f*channels+ch]
+			}
+		}
+	case []int32:
+		d := dst.([]int32)
+		for f := 0; f*channels < len(s) && (f+1)*len(picks) <= len(d); f++ {
+			for i, ch := range picks {
+				d[f*len(picks)+i] = s[f*channels+ch]
+			}
+		}
+	case []float32:
+		d := dst.([]float32)
+		for f := 0; f*channels < len(s) && (f+1)*len(picks) <= len(d); f++ {
+			for i, ch := range picks {
+				d[f*len(picks)+i] = s[f*channels+ch]
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseChannelMap checks the picks parsed from a --channel-map and
+// the channels a device has to be opened with to capture them.
+func TestParseChannelMap(t *testing.T) {
+	for _, tc := range []struct {
+		in       string
+		picks    []int
+		channels int
+	}{
+		{"0,1", []int{0, 1}, 2},
+		{"2, 3", []int{2, 3}, 4},
+		{"3,0", []int{3, 0}, 4},
+		{"1,1", []int{1, 1}, 2},
+	} {
+		picks, err := parseChannelMap(tc.in)
+		if err != nil {
+			t.Errorf("parseChannelMap(%q) failed : %v", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(picks, tc.picks) {
+			t.Errorf("parseChannelMap(%q) = %v, want %v", tc.in, picks, tc.picks)
+		}
+		if got := mappedChannels(picks); got != tc.channels {
+			t.Errorf("mappedChannels(%v) = %d, want %d", picks, got, tc.channels)
+		}
+	}
+
+	for _, in := range []string{"", "0,", "a", "-1", "0;1"} {
+		if _, err := parseChannelMap(in); err == nil {
+			t.Errorf("parseChannelMap(%q) didn't fail", in)
+		}
+	}
+}
+
+// TestSelectChannels maps 3 frames of a 4 channel buffer, whose samples
+// are numbered by frame and channel, to 2 channels in every capture type.
+func TestSelectChannels(t *testing.T) {
+	src := []int16{
+		10, 11, 12, 13,
+		20, 21, 22, 23,
+		30, 31, 32, 33,
+	}
+
+	for _, tc := range []struct {
+		picks []int
+		want  []int16
+	}{
+		{[]int{0, 1}, []int16{10, 11, 20, 21, 30, 31}},
+		{[]int{2, 3}, []int16{12, 13, 22, 23, 32, 33}},
+		{[]int{3, 0}, []int16{13, 10, 23, 20, 33, 30}},
+		{[]int{1, 1}, []int16{11, 11, 21, 21, 31, 31}},
+	} {
+		narrow := newCaptureBuffer(src, len(tc.want)).([]int16)
+		selectChannels(narrow, src, 4, tc.picks)
+		if !reflect.DeepEqual(narrow, tc.want) {
+			t.Errorf("int16 picks %v = %v, want %v", tc.picks, narrow, tc.want)
+		}
+
+		wide, wideSrc := make([]int32, len(tc.want)), make([]int32, len(src))
+		floats, floatSrc := make([]float32, len(tc.want)), make([]float32, len(src))
+		for i, v := range src {
+			wideSrc[i], floatSrc[i] = int32(v)<<16, float32(v)/100
+		}
+		selectChannels(wide, wideSrc, 4, tc.picks)
+		selectChannels(floats, floatSrc, 4, tc.picks)
+		for i, v := range tc.want {
+			if wide[i] != int32(v)<<16 {
+				t.Errorf("int32 picks %v: sample %d = %d, want %d", tc.picks, i, wide[i], int32(v)<<16)
+			}
+			if floats[i] != float32(v)/100 {
+				t.Errorf("float32 picks %v: sample %d = %v, want %v", tc.picks, i, floats[i], float32(v)/100)
+			}
+		}
+	}
+}
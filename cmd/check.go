@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// checkInput opens the input stream or input file for rec, reads a
+// single buffer from it and returns the peak level of that buffer.
+func checkInput(rec recording) (float64, error) {
+	pf := rec.capturePCMFormat()
+	var in interface{} = make([]int32, rec.buffer*pf.channels)
+	if rec.float {
+		in = make([]float32, rec.buffer*pf.channels)
+	} else if pf.bitDepth == 16 {
+		in = make([]int16, rec.buffer*pf.channels)
+	}
+
+	var src input
+	var err error
+	if rec.inputFile != "" {
+		src, err = openFileInput(rec.inputFile, rec.inputOrder, pf.bitDepth, in)
+	} else {
+		src, err = openDeviceInput(rec.inputDevice(), rec, in)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	defer src.Close()
+
+	// an overflow still fills the buffer.
+	_, err = src.Read()
+	if err == io.EOF {
+		return 0, fmt.Errorf("%s holds no samples", rec.inputFile)
+	}
+	if err != nil && err != portaudio.InputOverflowed {
+		return 0, fmt.Errorf("failed to read from audio stream : %v", err)
+	}
+	return peakLevel(in), nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checksumExt is added to the name of a recording to name the file holding its checksum.
+const checksumExt = ".sha256"
+
+// checksumPrefix starts the text of the ANNO chunk a checksum is embedded
+// in, which tells it apart from a comment.
+const checksumPrefix = "sha256:"
+
+// sampleChecksum returns the SHA-256 of the size bytes of sample data
+// starting at dataOffset, in hex.
+func sampleChecksum(rs io.ReadSeeker, dataOffset, size int64) (string, error) {
+	if _, err := rs.Seek(dataOffset, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to seek to sample data : %v", err)
+	}
+
+	h := sha256.New()
+	if _, err := io.CopyN(h, rs, size); err != nil {
+		return "", fmt.Errorf("failed to read sample data : %v", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeChecksumFile writes sum to the checksum file of the recording in
+// name, laid out like the output of sha256sum. It only covers the sample
+// data, so sha256sum -c doesn't match it against the whole file.
+func writeChecksumFile(name, sum string) error {
+	path := name + checksumExt
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(name))
+	if err := ioutil.WriteFile(path, []byte(line), 0644); err != nil {
+		return fmt.Errorf("failed to write %s : %v", path, err)
+	}
+	return nil
+}
+
+// readChecksumFile returns the checksum in the checksum file of the
+// recording in name, and whether there is one.
+func readChecksumFile(name string) (string, bool, error) {
+	path := name + checksumExt
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s : %v", path, err)
+	}
+
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 || !isChecksum(fields[0]) {
+		return "", false, fmt.Errorf("%s doesn't start with a sha256 checksum", path)
+	}
+	return strings.ToLower(fields[0]), true, nil
+}
+
+// isChecksum reports whether s is a SHA-256 in hex.
+func isChecksum(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == sha256.Size
+}
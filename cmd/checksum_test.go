@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audio-recorder-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		format   string
+		order    binary.ByteOrder
+		embedded bool
+	}{
+		{name: "wav checksum file", format: formatWAV, order: binary.LittleEndian},
+		{name: "aiff checksum file", format: formatAIFF, order: binary.BigEndian},
+		{name: "aiff embedded", format: formatAIFF, order: binary.BigEndian, embedded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := recording{
+				format:        tt.format,
+				order:         tt.order,
+				pcmFormat:     pcmFormat{sampleRate: 8000, channels: 2, bitDepth: 16},
+				buffer:        64,
+				maxFrames:     256,
+				gain:          1,
+				checksum:      true,
+				embedChecksum: tt.embedded,
+				dev:           &fakeCaptureDevice{},
+			}
+
+			f := &memoryFile{}
+			stats, err := record(f, rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isChecksum(stats.checksum) {
+				t.Fatalf("record returned checksum %q", stats.checksum)
+			}
+
+			name := filepath.Join(dir, tt.format)
+			if err := ioutil.WriteFile(name, f.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			os.Remove(name + checksumExt)
+			if !tt.embedded {
+				if err := writeChecksumFile(name, stats.checksum); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sum, err := verify(name)
+			if err != nil {
+				t.Fatalf("verify failed on the recording : %v", err)
+			}
+			if sum != stats.checksum {
+				t.Errorf("verify returned %s, want %s", sum, stats.checksum)
+			}
+
+			// flip a bit of a sample in the middle of the data.
+			tampered := append([]byte(nil), f.Bytes()...)
+			tampered[headerSize(rec.format, rec.pcmFormat)+100] ^= 1
+			if err := ioutil.WriteFile(name, tampered, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := verify(name); err == nil {
+				t.Error("verify passed a tampered recording")
+			}
+		})
+	}
+}
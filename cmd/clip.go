@@ -0,0 +1,34 @@
+package cmd
+
+// clipPercent is the percentage of full scale above which a sample is
+// considered clipped.
+const clipPercent = 95
+
+// clippedFrames returns the number of frames in buf, an []int16 or []int32
+// capture buffer of interleaved samples, with at least one clipped sample.
+func clippedFrames(buf interface{}, channels int) int {
+	var n int
+	switch b := buf.(type) {
+	case []int16:
+		const limit = clipPercent * (1 << 15) / 100
+		for i := 0; i+channels <= len(b); i += channels {
+			for _, v := range b[i : i+channels] {
+				if v > limit || v < -limit {
+					n++
+					break
+				}
+			}
+		}
+	case []int32:
+		const limit = clipPercent * (1 << 31) / 100
+		for i := 0; i+channels <= len(b); i += channels {
+			for _, v := range b[i : i+channels] {
+				if v > limit || v < -limit {
+					n++
+					break
+				}
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/pflag"
+	"go.coder.com/cli"
+	"go.coder.com/flog"
+)
+
+type concatCmd struct {
+	outFile string
+	force   bool
+}
+
+// Spec returns a command spec containing a description of it's usage.
+func (cmd *concatCmd) Spec() cli.CommandSpec {
+	return cli.CommandSpec{
+		Name:  "concat",
+		Usage: "[flags] <in>...",
+		Desc:  "Join AIFF or WAV recordings with the same format into one, like the segments of --split-duration.",
+	}
+}
+
+// RegisterFlags initializes how a flag set is processed for a particular command.
+func (cmd *concatCmd) RegisterFlags(fl *pflag.FlagSet) {
+	fl.StringVarP(&cmd.outFile, "out", "o", cmd.outFile, "Name the output file, which is written in the format of the inputs. Their metadata and markers aren't copied.")
+	fl.BoolVar(&cmd.force, "force", false, "Overwrite an output file that already exists.")
+}
+
+// Run joins the samples of every input file, in the order they're given, into the output file.
+// It exits with a nonzero status if they can't be joined.
+func (cmd *concatCmd) Run(fl *pflag.FlagSet) {
+	inputs := fl.Args()
+	if len(inputs) < 2 {
+		flog.Error("at least two input files are needed")
+		fl.Usage()
+		os.Exit(1)
+	}
+
+	if cmd.outFile == "" {
+		flog.Error("no output file provided")
+		fl.Usage()
+		os.Exit(1)
+	}
+
+	if err := cmd.run(inputs); err != nil {
+		flog.Error("%v", err)
+		os.Exit(1)
+	}
+}
+
+// run joins inputs into the output file, which is removed again if they can't be joined.
+func (cmd *concatCmd) run(inputs []string) error {
+	for _, in := range inputs {
+		if filepath.Clean(in) == filepath.Clean(cmd.outFile) {
+			return fmt.Errorf("the output %s can't also be an input", cmd.outFile)
+		}
+	}
+
+	out, err := createOutput(cmd.outFile, cmd.force)
+	if os.IsExist(err) {
+		return clobberError(cmd.outFile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create %s : %v", cmd.outFile, err)
+	}
+
+	af, err := concat(out, inputs)
+	if cerr := out.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("failed to close %s : %v", cmd.outFile, cerr)
+	}
+
+	if err != nil {
+		if rerr := os.Remove(cmd.outFile); rerr != nil {
+			flog.Error("failed to remove %s : %v", cmd.outFile, rerr)
+		}
+		return err
+	}
+
+	flog.Success("successfully joined %d recordings into %s, %d frames long", len(inputs), cmd.outFile, af.numFrames)
+	return nil
+}
+
+// concat writes the samples of the recordings named inputs to w, one after
+// another, under a single header. Every input must have the same format,
+// sample rate, channels and bit depth, which are checked before anything is
+// written. It returns the header of the joined recording.
+func concat(w io.WriteSeeker, inputs []string) (audioFile, error) {
+	files := make([]*os.File, 0, len(inputs))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	headers := make([]audioFile, len(inputs))
+	for i, name := range inputs {
+		f, err := os.Open(name)
+		if err != nil {
+			return audioFile{}, fmt.Errorf("failed to open %s : %v", name, err)
+		}
+		files = append(files, f)
+
+		af, err := readHeader(f)
+		if err != nil {
+			return audioFile{}, fmt.Errorf("failed to read header of %s : %v", name, err)
+		}
+
+		if first := headers[0]; i > 0 && (af.format != first.format || af.pcmFormat != first.pcmFormat) {
+			return audioFile{}, fmt.Errorf("%s is %s but %s is %s : every input must have the same format, sample rate, channels and bit depth",
+				name, describeFormat(af), inputs[0], describeFormat(first))
+		}
+		headers[i] = af
+	}
+
+	joined := headers[0]
+	if err := writeHeader(w, joined.format, joined.pcmFormat); err != nil {
+		return audioFile{}, err
+	}
+
+	// a partial frame at the end of an input would shift every channel after it.
+	frameBytes := int64(joined.channels * joined.bytesPerSample())
+
+	var numSamples int
+	for i, f := range files {
+		af := headers[i]
+		if _, err := f.Seek(af.dataOffset, io.SeekStart); err != nil {
+			return audioFile{}, fmt.Errorf("failed to seek to the samples of %s : %v", inputs[i], err)
+		}
+
+		n, err := io.Copy(w, io.LimitReader(f, af.dataSize/frameBytes*frameBytes))
+		if err != nil {
+			return audioFile{}, fmt.Errorf("failed to copy the samples of %s : %v", inputs[i], err)
+		}
+
+		numSamples += int(n) / joined.bytesPerSample()
+		flog.Info("copied %d frames from %s", n/frameBytes, inputs[i])
+	}
+
+	pad := joined.dataPad(numSamples)
+	if _, err := w.Write(pad); err != nil {
+		return audioFile{}, fmt.Errorf("failed to pad the samples : %v", err)
+	}
+
+	if err := fillSizes(w, joined.format, joined.pcmFormat, numSamples, len(pad)); err != nil {
+		return audioFile{}, fmt.Errorf("failed to fill in missing sizes : %v", err)
+	}
+
+	joined.numFrames = joined.frames(numSamples)
+	joined.dataSize = int64(numSamples * joined.bytesPerSample())
+	return joined, nil
+}
+
+// describeFormat describes the format of af for an error message.
+func describeFormat(af audioFile) string {
+	sampleType := "bit"
+	switch {
+	case af.float:
+		sampleType = "bit float"
+	case af.sowt:
+		sampleType = "bit little endian"
+	}
+	return fmt.Sprintf("%s at %d Hz with %d channels of %d %s samples", af.format, af.sampleRate, af.channels, af.bitDepth, sampleType)
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConcatSplitRecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audio-recorder-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, format := range []string{formatWAV, formatAIFF} {
+		t.Run(format, func(t *testing.T) {
+			order := binary.ByteOrder(binary.BigEndian)
+			if format == formatWAV {
+				order = binary.LittleEndian
+			}
+
+			rec := recording{
+				format:    format,
+				order:     order,
+				pcmFormat: pcmFormat{sampleRate: 8000, channels: 2, bitDepth: 16},
+				buffer:    64,
+				maxFrames: 320,
+				gain:      1,
+			}
+
+			whole := &memoryFile{}
+			rec.dev = &fakeCaptureDevice{}
+			if _, err := record(whole, rec); err != nil {
+				t.Fatal(err)
+			}
+
+			// the same recording split every 128 frames, into 128, 128 and 64.
+			var segments []string
+			var files []*os.File
+			next := func() (io.Writer, error) {
+				name := filepath.Join(dir, fmt.Sprintf("%s-%03d", format, len(segments)+1))
+				f, err := os.Create(name)
+				if err != nil {
+					return nil, err
+				}
+				segments, files = append(segments, name), append(files, f)
+				return f, nil
+			}
+
+			first, err := next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec.dev = &fakeCaptureDevice{}
+			rec.splitFrames, rec.nextSegment = 128, next
+			_, err = record(first, rec)
+			for _, f := range files {
+				f.Close()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(segments) != 3 {
+				t.Fatalf("recorded %d segments, want 3", len(segments))
+			}
+
+			out := filepath.Join(dir, format+"-joined")
+			cmd := &concatCmd{outFile: out}
+			if err := cmd.run(segments); err != nil {
+				t.Fatal(err)
+			}
+
+			joined, err := ioutil.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(joined) != len(whole.Bytes()) {
+				t.Errorf("joined recording is %d bytes, want the %d of the original", len(joined), len(whole.Bytes()))
+			}
+			if !bytes.Equal(joined, whole.Bytes()) {
+				t.Error("joined recording doesn't match the original")
+			}
+		})
+	}
+}
+
+func TestConcatOutputExists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audio-recorder-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var inputs []string
+	for i := 0; i < 2; i++ {
+		f := &memoryFile{}
+		rec := recording{
+			format:    formatWAV,
+			order:     binary.LittleEndian,
+			pcmFormat: pcmFormat{sampleRate: 8000, channels: 1, bitDepth: 16},
+			buffer:    64,
+			maxFrames: 64,
+			gain:      1,
+			dev:       &fakeCaptureDevice{},
+		}
+		if _, err := record(f, rec); err != nil {
+			t.Fatal(err)
+		}
+
+		name := filepath.Join(dir, fmt.Sprintf("in-%d.wav", i))
+		if err := ioutil.WriteFile(name, f.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, name)
+	}
+
+	out := filepath.Join(dir, "out.wav")
+	existing := []byte("not a recording")
+	if err := ioutil.WriteFile(out, existing, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&concatCmd{outFile: out}).run(inputs); err == nil {
+		t.Error("concat overwrote an existing output without --force")
+	}
+	if b, err := ioutil.ReadFile(out); err != nil || !bytes.Equal(b, existing) {
+		t.Errorf("existing output was changed to %q : %v", b, err)
+	}
+
+	if err := (&concatCmd{outFile: out, force: true}).run(inputs); err != nil {
+		t.Fatalf("concat with --force failed : %v", err)
+	}
+	if af := readHeaderFile(t, out); af.numFrames != 128 {
+		t.Errorf("joined recording holds %d frames, want 128", af.numFrames)
+	}
+
+	// an input that can't be read leaves no output behind.
+	failed := filepath.Join(dir, "failed.wav")
+	if err := (&concatCmd{outFile: failed}).run([]string{inputs[0], filepath.Join(dir, "missing.wav")}); err == nil {
+		t.Error("concat succeeded with a missing input")
+	}
+	if _, err := os.Stat(failed); !os.IsNotExist(err) {
+		t.Errorf("failed output was left behind : %v", err)
+	}
+}
+
+// readHeaderFile reads the header of the recording in name.
+func readHeaderFile(t *testing.T, name string) audioFile {
+	t.Helper()
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	af, err := readHeader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return af
+}
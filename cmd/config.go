@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"go.coder.com/cli"
+	"go.coder.com/flog"
+)
+
+// configFileName is the name of the config file in ~/.config.
+const configFileName = "audio-recorder.yaml"
+
+// defaultConfigPath returns ~/.config/audio-recorder.yaml,
+// or an empty string if there's no home directory.
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", configFileName)
+}
+
+// configuredCmd runs a subcommand with the flags it wasn't given
+// on the command line set from the config file.
+type configuredCmd struct {
+	cli.Command
+	root *Root
+}
+
+// RegisterFlags registers the flags of the wrapped command.
+func (c *configuredCmd) RegisterFlags(fl *pflag.FlagSet) {
+	if fc, ok := c.Command.(cli.FlaggedCommand); ok {
+		fc.RegisterFlags(fl)
+	}
+}
+
+// Run applies the config file to fl and runs the wrapped command.
+func (c *configuredCmd) Run(fl *pflag.FlagSet) {
+	if err := c.root.applyConfig(fl); err != nil {
+		flog.Error("%v", err)
+		os.Exit(1)
+	}
+	c.Command.Run(fl)
+}
+
+// applyConfig sets every flag in fl that wasn't given on the command line
+// and has a value in the config file. Flags keep reporting that they
+// weren't changed, so the file only replaces their defaults.
+func (r *Root) applyConfig(fl *pflag.FlagSet) error {
+	path, explicit := r.configPath, r.configPath != ""
+	if !explicit {
+		if path = defaultConfigPath(); path == "" {
+			return nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open config file %s : %v", path, err)
+	}
+	defer f.Close()
+
+	values, err := parseConfig(f)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s : %v", path, err)
+	}
+
+	known := r.flagNames()
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !known[key] {
+			return fmt.Errorf("unknown setting %q in config file %s : settings are named after the flags they set", key, path)
+		}
+
+		flag := fl.Lookup(key)
+		if flag == nil || flag.Changed {
+			continue
+		}
+
+		if err := flag.Value.Set(values[key]); err != nil {
+			return fmt.Errorf("invalid %s %q in config file %s : %v", key, values[key], path, err)
+		}
+	}
+	return nil
+}
+
+// flagNames returns the long name of every flag of every subcommand.
+func (r *Root) flagNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, c := range r.commands() {
+		fc, ok := c.(cli.FlaggedCommand)
+		if !ok {
+			continue
+		}
+
+		fl := pflag.NewFlagSet(c.Spec().Name, pflag.ContinueOnError)
+		fc.RegisterFlags(fl)
+		fl.VisitAll(func(f *pflag.Flag) { names[f.Name] = true })
+	}
+	return names
+}
+
+// parseConfig reads the flat subset of YAML the config file is written in:
+// one "key: value" pair per line, with # starting a comment and values
+// optionally quoted.
+func parseConfig(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if trimmed := strings.TrimSpace(text); trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+
+		if text[0] == ' ' || text[0] == '\t' {
+			return nil, fmt.Errorf("line %d : nested settings aren't supported", line)
+		}
+
+		i := strings.Index(text, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d : expected key: value", line)
+		}
+		key, value := strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+
+		if n := len(value); n >= 2 && (value[0] == '"' || value[0] == '\'') {
+			end := strings.IndexByte(value[1:], value[0])
+			if end < 0 {
+				return nil, fmt.Errorf("line %d : unterminated quote", line)
+			}
+			value = value[1 : end+1]
+		} else if j := strings.Index(value, " #"); j >= 0 {
+			value = strings.TrimSpace(value[:j])
+		}
+
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d : %s is set more than once", line, key)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
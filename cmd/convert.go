@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fuskovic/audio-recorder/internal/dsp"
+	"github.com/spf13/pflag"
+	"go.coder.com/cli"
+	"go.coder.com/flog"
+)
+
+type convertCmd struct {
+	inFile   string
+	outFile  string
+	bitDepth int
+	dither   string
+}
+
+// Spec returns a command spec containing a description of it's usage.
+func (cmd *convertCmd) Spec() cli.CommandSpec {
+	return cli.CommandSpec{
+		Name:  "convert",
+		Usage: "[flags]",
+		Desc:  "Convert an AIFF recording to WAV.",
+	}
+}
+
+// RegisterFlags initializes how a flag set is processed for a particular command.
+func (cmd *convertCmd) RegisterFlags(fl *pflag.FlagSet) {
+	fl.StringVarP(&cmd.inFile, "in", "i", cmd.inFile, "Name the input AIFF file.")
+	fl.StringVarP(&cmd.outFile, "out", "o", cmd.outFile, "Name the output WAV file (defaults to the input name with a .wav extension).")
+	fl.IntVar(&cmd.bitDepth, "bit-depth", 0, "Bits per sample of the output, 16 to reduce a 32 bit recording (0 keeps the bit depth of the input).")
+	fl.StringVar(&cmd.dither, "dither", ditherNone, ditherUsage)
+}
+
+// Run converts the input AIFF file to an equivalent WAV file.
+func (cmd *convertCmd) Run(fl *pflag.FlagSet) {
+	if cmd.inFile == "" {
+		flog.Error("no input file provided")
+		fl.Usage()
+		return
+	}
+
+	dither, err := parseDither(cmd.dither)
+	if err != nil {
+		flog.Error("%v", err)
+		fl.Usage()
+		return
+	}
+
+	if cmd.outFile == "" {
+		cmd.outFile = strings.TrimSuffix(cmd.inFile, filepath.Ext(cmd.inFile)) + "." + formatWAV
+	}
+
+	in, err := os.Open(cmd.inFile)
+	if err != nil {
+		flog.Error("failed to open %s : %v", cmd.inFile, err)
+		fl.Usage()
+		return
+	}
+
+	defer func() {
+		if err := in.Close(); err != nil {
+			flog.Error("failed to close %s : %v", cmd.inFile, err)
+		}
+	}()
+
+	af, err := readHeader(in)
+	if err == nil && af.format != formatAIFF {
+		err = fmt.Errorf("found a %s file", af.format)
+	}
+	if err != nil {
+		flog.Error("%s is not a recognizable aiff file : %v", cmd.inFile, err)
+		return
+	}
+
+	// reduce is set when the samples are dithered down to 16 bits.
+	outFormat, reduce := af.pcmFormat, cmd.bitDepth != 0 && cmd.bitDepth != af.bitDepth
+	outFormat.sowt = false
+	if reduce && (cmd.bitDepth != 16 || af.bitDepth != 32 || af.float) {
+		flog.Error("can't convert %d bit samples to %d bits : only 32 bit integer samples can be reduced to 16 bits", af.bitDepth, cmd.bitDepth)
+		return
+	}
+	if reduce {
+		outFormat.bitDepth = 16
+	} else if dither != dsp.DitherNone {
+		flog.Info("--dither only applies when --bit-depth reduces the samples, ignoring it")
+	}
+
+	out, err := os.Create(cmd.outFile)
+	if err != nil {
+		flog.Error("failed to create %s : %v", cmd.outFile, err)
+		return
+	}
+
+	defer func() {
+		if err := out.Close(); err != nil {
+			flog.Error("failed to close %s : %v", cmd.outFile, err)
+		}
+	}()
+
+	if err := writeHeader(out, formatWAV, outFormat); err != nil {
+		flog.Error("%v", err)
+		return
+	}
+
+	var numSamples int
+	if reduce {
+		q := dsp.NewQuantizer(16, dither, time.Now().UnixNano())
+		numSamples, err = reduceAIFFToWAV(out, io.LimitReader(in, af.dataSize), af.sampleOrder(), q)
+	} else {
+		numSamples, err = aiffToWAV(out, io.LimitReader(in, af.dataSize), af.bitDepth, af.sampleOrder())
+	}
+	if err != nil {
+		flog.Error("failed to convert samples : %v", err)
+		return
+	}
+
+	pad := outFormat.dataPad(numSamples)
+	if _, err := out.Write(pad); err != nil {
+		flog.Error("failed to pad the samples : %v", err)
+		return
+	}
+
+	if err := fillSizes(out, formatWAV, outFormat, numSamples, len(pad)); err != nil {
+		flog.Error("failed to fill in missing sizes : %v", err)
+		return
+	}
+
+	flog.Success("successfully converted %s to %s", cmd.inFile, cmd.outFile)
+}
+
+// aiffToWAV copies AIFF samples in order from r to w as little-endian WAV
+// samples and returns the number of samples copied. Any trailing partial
+// sample is dropped.
+func aiffToWAV(w io.Writer, r io.Reader, bitDepth int, order binary.ByteOrder) (int, error) {
+	width := bitDepth / 8
+	buf := make([]byte, 4096*width)
+
+	var numSamples int
+	for {
+		n, err := io.ReadFull(r, buf)
+		n -= n % width
+
+		for i := 0; i < n; i += width {
+			s := buf[i : i+width]
+			for a, b := 0, width-1; a < b && order == binary.BigEndian; a, b = a+1, b-1 {
+				s[a], s[b] = s[b], s[a]
+			}
+
+			// 8-bit aiff samples are signed, 8-bit wav samples are not.
+			if width == 1 {
+				s[0] += 128
+			}
+		}
+
+		if _, werr := w.Write(buf[:n]); werr != nil {
+			return numSamples, werr
+		}
+		numSamples += n / width
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return numSamples, nil
+		}
+		if err != nil {
+			return numSamples, err
+		}
+	}
+}
+
+// reduceAIFFToWAV reduces 32 bit AIFF samples in order from r to 16 bit
+// little-endian WAV samples with q, writes them to w and returns the number
+// of samples copied. Any trailing partial sample is dropped.
+func reduceAIFFToWAV(w io.Writer, r io.Reader, order binary.ByteOrder, q *dsp.Quantizer) (int, error) {
+	in := make([]byte, 4096*4)
+	samples := make([]int32, 4096)
+	out := make([]byte, 4096*2)
+
+	var numSamples int
+	for {
+		n, err := io.ReadFull(r, in)
+		n /= 4
+
+		for i := range samples[:n] {
+			samples[i] = int32(order.Uint32(in[4*i:]))
+		}
+		q.Process(samples[:n])
+		for i, s := range samples[:n] {
+			binary.LittleEndian.PutUint16(out[2*i:], uint16(s))
+		}
+
+		if _, werr := w.Write(out[:2*n]); werr != nil {
+			return numSamples, werr
+		}
+		numSamples += n
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return numSamples, nil
+		}
+		if err != nil {
+			return numSamples, err
+		}
+	}
+}
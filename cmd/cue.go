@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// cueTimeLayout is the layout of the wall-clock time of each line of a cue file.
+const cueTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// The names of the cues record adds itself, around the markers typed during it.
+const (
+	cueStart  = "start"
+	cuePause  = "pause"
+	cueResume = "resume"
+	cueStop   = "stop"
+)
+
+// cuePoint ties a wall-clock time to the frame of a recording that was captured at it.
+type cuePoint struct {
+	time  time.Time
+	frame int
+	name  string
+}
+
+// parseMarker reports whether line asks for a marker, either c on its own
+// or c followed by the marker's name, and returns the name.
+func parseMarker(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if line != "c" && !strings.HasPrefix(line, "c ") {
+		return "", false
+	}
+	return strings.TrimSpace(line[1:]), true
+}
+
+// cueFrame returns the frame of the output being captured now, given the
+// samples written so far and the frames the input has captured but that
+// haven't been read yet, which are counted at the capture rate.
+func (rec recording) cueFrame(samples, pending int) int {
+	pf := rec.capturePCMFormat()
+	return rec.frames(samples) + int(int64(pending)*int64(rec.sampleRate)/int64(pf.sampleRate))
+}
+
+// writeCues writes a line for each cue to the file name, adding them to
+// the end of it when add is set. Each line holds the wall-clock time, the
+// frame, the seconds into the recording and the name, separated by tabs.
+func writeCues(name string, cues []cuePoint, sampleRate int, add bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if add {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(name, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s : %v", name, err)
+	}
+
+	var b strings.Builder
+	for _, c := range cues {
+		fmt.Fprintf(&b, "%s\t%d\t%.3f\t%s\n", c.time.Format(cueTimeLayout), c.frame, float64(c.frame)/float64(sampleRate), c.name)
+	}
+
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s : %v", name, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s : %v", name, err)
+	}
+	return nil
+}
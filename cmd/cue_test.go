@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCueFrame checks the frame a cue lands on, counting the frames the
+// input is still holding at the capture rate and channels.
+func TestCueFrame(t *testing.T) {
+	tests := []struct {
+		name             string
+		rec              recording
+		samples, pending int
+		want             int
+	}{
+		{name: "mono", rec: recording{pcmFormat: pcmFormat{sampleRate: 8000, channels: 1}}, samples: 800, want: 800},
+		{name: "stereo", rec: recording{pcmFormat: pcmFormat{sampleRate: 8000, channels: 2}}, samples: 800, want: 400},
+		{name: "pending", rec: recording{pcmFormat: pcmFormat{sampleRate: 8000, channels: 2}}, samples: 800, pending: 64, want: 464},
+		{
+			name:    "resampled",
+			rec:     recording{pcmFormat: pcmFormat{sampleRate: 44100, channels: 2}, captureRate: 48000},
+			samples: 2 * 44100, pending: 4800,
+			want: 44100 + 4410,
+		},
+		{
+			name:    "downmixed",
+			rec:     recording{pcmFormat: pcmFormat{sampleRate: 8000, channels: 1}, captureChannels: 2},
+			samples: 800, pending: 64,
+			want: 864,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rec.cueFrame(tt.samples, tt.pending); got != tt.want {
+				t.Errorf("cueFrame(%d, %d) = %d, want %d", tt.samples, tt.pending, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestWriteCues checks the frame and offset in seconds written for each
+// cue, and that adding cues keeps those already in the file.
+func TestWriteCues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audio-recorder-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "take.cue")
+
+	start := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	cues := []cuePoint{
+		{time: start, frame: 0, name: cueStart},
+		{time: start.Add(1500 * time.Millisecond), frame: 66150, name: "marker 1"},
+		{time: start.Add(2 * time.Second), frame: 88200, name: cueStop},
+	}
+	want := []string{
+		"2020-05-01T12:00:00.000Z\t0\t0.000\tstart",
+		"2020-05-01T12:00:01.500Z\t66150\t1.500\tmarker 1",
+		"2020-05-01T12:00:02.000Z\t88200\t2.000\tstop",
+	}
+
+	for _, add := range []bool{false, true} {
+		if err := writeCues(name, cues, 44100, add); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), strings.Join(append(want, want...), "\n")+"\n"; got != want {
+		t.Errorf("cue file is\n%s\nwant\n%s", got, want)
+	}
+
+	// without add, the file only holds the cues written last.
+	if err := writeCues(name, cues[1:2], 44100, false); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(name); string(b) != want[1]+"\n" {
+		t.Errorf("rewritten cue file is %q, want %q", b, want[1]+"\n")
+	}
+}
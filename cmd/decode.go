@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// audioFile describes the header of a parsed AIFF or WAV file.
+type audioFile struct {
+	format string
+	pcmFormat
+	numFrames int
+
+	// formSize is the size recorded in the FORM or RIFF chunk.
+	formSize int64
+
+	// dataOffset and dataSize locate the sample data within the file.
+	dataOffset int64
+	dataSize   int64
+}
+
+// sizeWarnings compares the sizes recorded in the header with the
+// size of the file and describes each one that disagrees.
+func (af audioFile) sizeWarnings(fileSize int64) []string {
+	var warnings []string
+
+	if af.formSize+8 != fileSize {
+		warnings = append(warnings, fmt.Sprintf("header records %d bytes but the file holds %d", af.formSize+8, fileSize))
+	}
+
+	if end := af.dataOffset + af.dataSize; end > fileSize {
+		warnings = append(warnings, fmt.Sprintf("sample data runs %d bytes past the end of the file", end-fileSize))
+	}
+
+	frameBytes := int64(af.channels * af.bytesPerSample())
+	if frames := af.dataSize / frameBytes; int64(af.numFrames) != frames {
+		warnings = append(warnings, fmt.Sprintf("header records %d frames but the sample data holds %d", af.numFrames, frames))
+	}
+
+	return warnings
+}
+
+// order returns the byte order of the file's chunks.
+func (af audioFile) order() binary.ByteOrder {
+	if af.format == formatWAV {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// sampleOrder returns the byte order of the file's samples, which is only
+// different from that of its chunks for a sowt AIFF-C file.
+func (af audioFile) sampleOrder() binary.ByteOrder {
+	if af.sowt {
+		return binary.LittleEndian
+	}
+	return af.order()
+}
+
+// readHeader parses the header of an AIFF or WAV file and leaves r
+// positioned at the start of the sample data.
+func readHeader(r io.ReadSeeker) (audioFile, error) {
+	var id [4]byte
+	if _, err := io.ReadFull(r, id[:]); err != nil {
+		return audioFile{}, fmt.Errorf("failed to read file id : %v", err)
+	}
+
+	var (
+		af  audioFile
+		err error
+	)
+	switch string(id[:]) {
+	case "FORM":
+		af, err = parseAIFF(r)
+	case "RIFF":
+		af, err = parseWAV(r)
+	default:
+		return audioFile{}, errors.New("not an aiff or wav file")
+	}
+	if err != nil {
+		return audioFile{}, err
+	}
+
+	if _, err := r.Seek(af.dataOffset, io.SeekStart); err != nil {
+		return audioFile{}, fmt.Errorf("failed to seek to sample data : %v", err)
+	}
+	return af, nil
+}
+
+// openRecording opens the recording in name, made with rec, positioned at
+// its first sample. Raw recordings have no header, so their format is rec's.
+func openRecording(name string, rec recording) (*os.File, audioFile, binary.ByteOrder, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, audioFile{}, nil, fmt.Errorf("failed to open %s : %v", name, err)
+	}
+
+	af, order := audioFile{format: rec.format, pcmFormat: rec.pcmFormat}, rec.order
+	if rec.format == formatRaw {
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, audioFile{}, nil, fmt.Errorf("failed to stat %s : %v", name, err)
+		}
+		af.dataSize = fi.Size()
+		af.numFrames = int(fi.Size()) / (rec.channels * rec.bytesPerSample())
+	} else {
+		if af, err = readHeader(f); err != nil {
+			f.Close()
+			return nil, audioFile{}, nil, fmt.Errorf("failed to read %s : %v", name, err)
+		}
+		order = af.sampleOrder()
+	}
+	return f, af, order, nil
+}
+
+// readSamples fills buf with samples in the format pf read from r,
+// scaling each one to the full int32 range. It returns the number of
+// samples read, which is only less than len(buf) alongside an error.
+func readSamples(r io.Reader, order binary.ByteOrder, pf pcmFormat, buf []int32) (int, error) {
+	bitDepth := pf.bitDepth
+	width := bitDepth / 8
+	raw := make([]byte, width*len(buf))
+
+	n, err := io.ReadFull(r, raw)
+	n /= width
+
+	for i := 0; i < n; i++ {
+		b := raw[i*width : (i+1)*width]
+
+		switch bitDepth {
+		case 8:
+			if order == binary.LittleEndian {
+				// 8-bit wav samples are unsigned.
+				buf[i] = int32(int8(b[0]-128)) << 24
+			} else {
+				buf[i] = int32(int8(b[0])) << 24
+			}
+		case 16:
+			buf[i] = int32(int16(order.Uint16(b))) << 16
+		case 24:
+			if order == binary.LittleEndian {
+				buf[i] = int32(uint32(b[0])<<8 | uint32(b[1])<<16 | uint32(b[2])<<24)
+			} else {
+				buf[i] = int32(uint32(b[2])<<8 | uint32(b[1])<<16 | uint32(b[0])<<24)
+			}
+		case 32:
+			if pf.float {
+				buf[i] = floatToSample(math.Float32frombits(order.Uint32(b)))
+			} else {
+				buf[i] = int32(order.Uint32(b))
+			}
+		}
+	}
+
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// floatToSample scales a float sample in [-1, 1] to the full int32 range,
+// clamping anything outside it.
+func floatToSample(v float32) int32 {
+	switch {
+	case v != v:
+		return 0
+	case v >= 1:
+		return math.MaxInt32
+	case v <= -1:
+		return math.MinInt32
+	}
+	return int32(float64(v) * (1 << 31))
+}
+
+// sampleToFloat scales a full range int32 sample to a float in [-1, 1).
+func sampleToFloat(v int32) float32 {
+	return float32(float64(v) / (1 << 31))
+}
+
+// validBitDepth reports whether readSamples can decode samples of bitDepth.
+func validBitDepth(bitDepth int) bool {
+	switch bitDepth {
+	case 8, 16, 24, 32:
+		return true
+	}
+	return false
+}
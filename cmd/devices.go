@@ -0,0 +1,362 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gordonklaus/portaudio"
+	"github.com/spf13/pflag"
+	"go.coder.com/cli"
+	"go.coder.com/flog"
+)
+
+type devicesCmd struct {
+	hostAPIs bool
+	json     bool
+}
+
+// deviceInfo is an input device as printed by devices --json.
+type deviceInfo struct {
+	Index             int     `json:"index"`
+	Name              string  `json:"name"`
+	HostAPI           string  `json:"hostApi"`
+	MaxInputChannels  int     `json:"maxInputChannels"`
+	DefaultSampleRate float64 `json:"defaultSampleRate"`
+	// DefaultLowLatency is in seconds.
+	DefaultLowLatency float64 `json:"defaultLowLatency"`
+}
+
+// Spec returns a command spec containing a description of it's usage.
+func (cmd *devicesCmd) Spec() cli.CommandSpec {
+	return cli.CommandSpec{
+		Name:  "devices",
+		Usage: "[flags]",
+		Desc:  "List available audio input devices.",
+	}
+}
+
+// RegisterFlags initializes how a flag set is processed for a particular command.
+func (cmd *devicesCmd) RegisterFlags(fl *pflag.FlagSet) {
+	fl.BoolVar(&cmd.hostAPIs, "host-apis", false, "List the host APIs portaudio was built with, like ALSA, CoreAudio or WASAPI, and their default devices instead.")
+	fl.BoolVar(&cmd.json, "json", false, "Print the input devices as a JSON array of objects with their index, name, hostApi, maxInputChannels, defaultSampleRate and defaultLowLatency in seconds.")
+}
+
+// Run prints every device that can be recorded from, or every host API.
+func (cmd *devicesCmd) Run(fl *pflag.FlagSet) {
+	if cmd.json && cmd.hostAPIs {
+		flog.Error("--json can't be used with --host-apis")
+		fl.Usage()
+		return
+	}
+
+	if err := portaudio.Initialize(); err != nil {
+		flog.Error("failed to initialize portaudio : %v", err)
+		return
+	}
+
+	defer func() {
+		if err := portaudio.Terminate(); err != nil {
+			flog.Error("failed to terminate portaudio : %v", err)
+		}
+	}()
+
+	if cmd.hostAPIs {
+		apis, err := portaudio.HostApis()
+		if err != nil {
+			flog.Error("failed to list host APIs : %v", err)
+			return
+		}
+
+		def, err := portaudio.DefaultHostApi()
+		if err != nil {
+			flog.Error("failed to find the default host API : %v", err)
+			return
+		}
+
+		if err := printHostAPIs(os.Stdout, apis, def); err != nil {
+			flog.Error("%v", err)
+		}
+		return
+	}
+
+	devices, err := portaudio.Devices()
+	if err != nil {
+		flog.Error("failed to list devices : %v", err)
+		return
+	}
+
+	write := printDevices
+	if cmd.json {
+		write = printDevicesJSON
+	}
+
+	if err := write(os.Stdout, devices); err != nil {
+		flog.Error("%v", err)
+	}
+}
+
+// inputDevices returns the input devices in devices, indexed by their
+// position in the full portaudio device list.
+func inputDevices(devices []*portaudio.DeviceInfo) []deviceInfo {
+	inputs := []deviceInfo{}
+	for i, d := range devices {
+		if d.MaxInputChannels < 1 {
+			continue
+		}
+
+		info := deviceInfo{
+			Index:             i,
+			Name:              d.Name,
+			MaxInputChannels:  d.MaxInputChannels,
+			DefaultSampleRate: d.DefaultSampleRate,
+			DefaultLowLatency: d.DefaultLowInputLatency.Seconds(),
+		}
+		if d.HostApi != nil {
+			info.HostAPI = d.HostApi.Name
+		}
+		inputs = append(inputs, info)
+	}
+	return inputs
+}
+
+// printDevicesJSON writes the input devices in devices as a JSON array,
+// which is empty when there are none so that scripts don't need to tell
+// that apart from an error.
+func printDevicesJSON(w io.Writer, devices []*portaudio.DeviceInfo) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(inputDevices(devices)); err != nil {
+		return fmt.Errorf("failed to encode devices : %v", err)
+	}
+	return nil
+}
+
+// printDevices writes a table of the input devices in devices. The index
+// column is the device's position in the full portaudio device list.
+func printDevices(w io.Writer, devices []*portaudio.DeviceInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "INDEX\tNAME\tHOST API\tINPUT CHANNELS\tDEFAULT SAMPLE RATE")
+
+	inputs := inputDevices(devices)
+	for _, d := range inputs {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%.0f\n", d.Index, d.Name, d.HostAPI, d.MaxInputChannels, d.DefaultSampleRate)
+	}
+
+	if len(inputs) == 0 {
+		return fmt.Errorf("no input devices found")
+	}
+	return tw.Flush()
+}
+
+// printHostAPIs writes a table of apis, marking def as the default, with
+// the number of input devices each has and their default devices.
+func printHostAPIs(w io.Writer, apis []*portaudio.HostApiInfo, def *portaudio.HostApiInfo) error {
+	if len(apis) == 0 {
+		return fmt.Errorf("no host APIs found")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tDEFAULT\tINPUT DEVICES\tDEFAULT INPUT\tDEFAULT OUTPUT")
+
+	name := func(d *portaudio.DeviceInfo) string {
+		if d == nil {
+			return "none"
+		}
+		return d.Name
+	}
+
+	for _, api := range apis {
+		inputs := 0
+		for _, d := range api.Devices {
+			if d.MaxInputChannels > 0 {
+				inputs++
+			}
+		}
+
+		isDefault := "no"
+		if def != nil && api.Name == def.Name {
+			isDefault = "yes"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", api.Name, isDefault, inputs, name(api.DefaultInputDevice), name(api.DefaultOutputDevice))
+	}
+	return tw.Flush()
+}
+
+// hostAPIUsage is the help of the --host-api flag of the commands that capture.
+const hostAPIUsage = "Capture through this host API, as listed by devices --host-apis, and look for --device among its devices. " +
+	"Which host APIs there are depends on the platform and how portaudio was built: " +
+	"Windows has MME, which the default device often uses, DirectSound, WASAPI, which has lower latency, and possibly ASIO and WDMKS, " +
+	"macOS has Core Audio and Linux has ALSA, OSS and possibly JACK. The same device can be listed once for each of them."
+
+// resolveHostAPI finds a host API by its name or its type, like WASAPI,
+// ignoring case. Portaudio must already be initialized.
+func resolveHostAPI(name string) (*portaudio.HostApiInfo, error) {
+	apis, err := portaudio.HostApis()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list host APIs : %v", err)
+	}
+
+	var names []string
+	for _, api := range apis {
+		if strings.EqualFold(api.Name, name) || strings.EqualFold(api.Type.String(), name) {
+			return api, nil
+		}
+		names = append(names, fmt.Sprintf("%q", api.Name))
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("host API %q isn't available : portaudio has no host APIs on this system", name)
+	}
+	return nil, fmt.Errorf("host API %q isn't available on this system : available host APIs are %s", name, strings.Join(names, ", "))
+}
+
+// hostAPIInputDevice returns the default input device of api, or an
+// actionable error if it has none. Portaudio must already be initialized.
+func hostAPIInputDevice(api *portaudio.HostApiInfo) (*portaudio.DeviceInfo, error) {
+	dev := api.DefaultInputDevice
+	if dev != nil && dev.MaxInputChannels > 0 {
+		return dev, nil
+	}
+
+	devices, err := portaudio.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices : %v", err)
+	}
+	return nil, fmt.Errorf("host API %s has no default input device : valid devices are %s", api.Name, inputDeviceList(hostAPIDevices(devices, api)))
+}
+
+// hostAPIDevices returns devices with those that don't belong to api set
+// to nil, so that the rest keep their indexes, or devices if api is nil.
+func hostAPIDevices(devices []*portaudio.DeviceInfo, api *portaudio.HostApiInfo) []*portaudio.DeviceInfo {
+	if api == nil {
+		return devices
+	}
+
+	valid := make([]*portaudio.DeviceInfo, len(devices))
+	for i, d := range devices {
+		if d.HostApi != nil && d.HostApi.Name == api.Name {
+			valid[i] = d
+		}
+	}
+	return valid
+}
+
+// resolveDevice finds an input device by its index in the portaudio device
+// list or by its name. With a host API, only its devices are looked for.
+// Portaudio must already be initialized.
+func resolveDevice(device string, api *portaudio.HostApiInfo) (*portaudio.DeviceInfo, error) {
+	devices, err := portaudio.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices : %v", err)
+	}
+
+	valid := hostAPIDevices(devices, api)
+
+	var dev *portaudio.DeviceInfo
+	if i, err := strconv.Atoi(device); err == nil {
+		if i >= 0 && i < len(devices) {
+			dev = devices[i]
+		}
+		if dev != nil && valid[i] == nil {
+			return nil, fmt.Errorf("device %d %q doesn't belong to host API %s : valid devices are %s", i, dev.Name, api.Name, inputDeviceList(valid))
+		}
+	} else {
+		for _, d := range valid {
+			if d != nil && strings.EqualFold(d.Name, device) {
+				dev = d
+				break
+			}
+		}
+	}
+
+	if dev == nil {
+		return nil, fmt.Errorf("unknown input device %q : valid devices are %s", device, inputDeviceList(valid))
+	}
+	if dev.MaxInputChannels < 1 {
+		return nil, fmt.Errorf("device %q has no input channels : valid devices are %s", dev.Name, inputDeviceList(valid))
+	}
+	return dev, nil
+}
+
+// noInputDeviceHint tells the user how to pick an input device when the default can't be used.
+const noInputDeviceHint = "run audio-recorder devices to list the input devices and pick one with --device"
+
+// defaultInputDevice returns the system default input device, or an
+// actionable error if there isn't one or it has no input channels.
+func defaultInputDevice() (*portaudio.DeviceInfo, error) {
+	dev, err := portaudio.DefaultInputDevice()
+	if err != nil || dev == nil {
+		return nil, fmt.Errorf("no default input device was found : %s", noInputDeviceHint)
+	}
+	if dev.MaxInputChannels < 1 {
+		return nil, fmt.Errorf("default device %q has no input channels : %s", dev.Name, noInputDeviceHint)
+	}
+	return dev, nil
+}
+
+// loopbackNames are the parts of a device name, in lowercase, that mark
+// a device that captures what the system plays instead of a microphone.
+var loopbackNames = []string{"monitor", "loopback", "stereo mix"}
+
+// findLoopbackDevice returns the first input device named like a loopback
+// device, of api when it's set. Portaudio must already be initialized.
+func findLoopbackDevice(api *portaudio.HostApiInfo) (*portaudio.DeviceInfo, error) {
+	devices, err := portaudio.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices : %v", err)
+	}
+
+	for _, d := range hostAPIDevices(devices, api) {
+		if d != nil && d.MaxInputChannels > 0 && isLoopbackName(d.Name) {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("no loopback input device was found : %s", loopbackHint(runtime.GOOS))
+}
+
+// isLoopbackName reports whether name looks like the name of a loopback device.
+func isLoopbackName(name string) bool {
+	name = strings.ToLower(name)
+	for _, part := range loopbackNames {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// loopbackHint tells the user how to get a loopback device on goos.
+func loopbackHint(goos string) string {
+	switch goos {
+	case "linux":
+		return "PulseAudio and PipeWire name one \"Monitor of\" each output, but they're only listed when portaudio was built with their backend, otherwise pick the pulse device with --device and choose the monitor source in pavucontrol"
+	case "darwin":
+		return "macOS has no loopback input, install a virtual device such as BlackHole, send the system output to it and pick it with --device"
+	case "windows":
+		return "enable Stereo Mix under the recording devices of the Sound control panel, or pick a WASAPI loopback device with --device"
+	}
+	return noInputDeviceHint
+}
+
+// inputDeviceList formats the input devices in devices for an error message,
+// skipping nil entries.
+func inputDeviceList(devices []*portaudio.DeviceInfo) string {
+	var names []string
+	for i, d := range devices {
+		if d != nil && d.MaxInputChannels > 0 {
+			names = append(names, fmt.Sprintf("%d %q", i, d.Name))
+		}
+	}
+
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// testDevices returns a device list of two host APIs, with one device
+// that can only play between the inputs.
+func testDevices() ([]*portaudio.DeviceInfo, []*portaudio.HostApiInfo) {
+	alsa := &portaudio.HostApiInfo{Name: "ALSA"}
+	jack := &portaudio.HostApiInfo{Name: "JACK Audio Connection Kit"}
+
+	devices := []*portaudio.DeviceInfo{
+		{Name: "USB Microphone", MaxInputChannels: 1, DefaultSampleRate: 48000, DefaultLowInputLatency: 8700 * time.Microsecond, HostApi: alsa},
+		{Name: "HDMI Output", MaxOutputChannels: 8, DefaultSampleRate: 48000, HostApi: alsa},
+		{Name: "system", MaxInputChannels: 2, MaxOutputChannels: 2, DefaultSampleRate: 44100, DefaultLowInputLatency: 5 * time.Millisecond, HostApi: jack},
+	}
+
+	alsa.Devices, alsa.DefaultInputDevice, alsa.DefaultOutputDevice = devices[:2], devices[0], devices[1]
+	jack.Devices, jack.DefaultInputDevice = devices[2:], devices[2]
+	return devices, []*portaudio.HostApiInfo{alsa, jack}
+}
+
+// TestPrintDevicesJSON checks the fields and indexes devices --json prints
+// for the input devices, and that it prints an empty array without any.
+func TestPrintDevicesJSON(t *testing.T) {
+	devices, _ := testDevices()
+
+	var out bytes.Buffer
+	if err := printDevicesJSON(&out, devices); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode %s : %v", out.Bytes(), err)
+	}
+
+	want := []map[string]interface{}{
+		{"index": 0.0, "name": "USB Microphone", "hostApi": "ALSA", "maxInputChannels": 1.0, "defaultSampleRate": 48000.0, "defaultLowLatency": 0.0087},
+		{"index": 2.0, "name": "system", "hostApi": "JACK Audio Connection Kit", "maxInputChannels": 2.0, "defaultSampleRate": 44100.0, "defaultLowLatency": 0.005},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("devices --json printed %s, want %v", out.Bytes(), want)
+	}
+
+	out.Reset()
+	if err := printDevicesJSON(&out, devices[1:2]); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "[]\n" {
+		t.Errorf("devices --json without inputs printed %q, want %q", got, "[]\n")
+	}
+}
+
+// TestPrintHostAPIs checks the table devices --host-apis prints for a
+// stubbed list of host APIs, and the error without any.
+func TestPrintHostAPIs(t *testing.T) {
+	_, apis := testDevices()
+
+	var out bytes.Buffer
+	if err := printHostAPIs(&out, apis, apis[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// the output only device isn't counted as an input.
+	want := strings.Join([]string{
+		"NAME                       DEFAULT  INPUT DEVICES  DEFAULT INPUT   DEFAULT OUTPUT",
+		"ALSA                       yes      1              USB Microphone  HDMI Output",
+		"JACK Audio Connection Kit  no       1              system          none",
+	}, "\n") + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("devices --host-apis printed\n%s\nwant\n%s", got, want)
+	}
+
+	if err := printHostAPIs(&out, nil, nil); err == nil {
+		t.Error("printing no host APIs didn't fail")
+	}
+}
+
+// TestHostAPIDevices checks that only the devices of the host API are
+// kept, at the indexes they have in the full device list.
+func TestHostAPIDevices(t *testing.T) {
+	devices, apis := testDevices()
+
+	for _, tt := range []struct {
+		api  *portaudio.HostApiInfo
+		want []*portaudio.DeviceInfo
+	}{
+		{nil, devices},
+		{apis[0], []*portaudio.DeviceInfo{devices[0], devices[1], nil}},
+		{apis[1], []*portaudio.DeviceInfo{nil, nil, devices[2]}},
+	} {
+		name := "all"
+		if tt.api != nil {
+			name = tt.api.Name
+		}
+		if got := hostAPIDevices(devices, tt.api); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s devices are %s, want %s", name, inputDeviceList(got), inputDeviceList(tt.want))
+		}
+	}
+
+	if got, want := inputDeviceList(hostAPIDevices(devices, apis[1])), `2 "system"`; got != want {
+		t.Errorf("JACK input devices are listed as %s, want %s", got, want)
+	}
+}
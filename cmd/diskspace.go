@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// diskCheckInterval is how often the free space on the output's
+// filesystem is checked while recording.
+const diskCheckInterval = 10 * time.Second
+
+// errNoFreeSpace is returned by freeSpace on platforms where it can't be checked.
+var errNoFreeSpace = errors.New("checking free space isn't supported on this platform")
+
+// estimateSize returns roughly how many bytes rec grows to, or 0 if it
+// can't be estimated. Without a duration or frame count only a size limit
+// tells, and compressed formats other than flac depend on their bitrate.
+// Flac is estimated as if it didn't compress at all.
+func estimateSize(rec recording) int64 {
+	frames := int64(rec.maxFrames)
+	if d := int64(rec.duration.Seconds() * float64(rec.sampleRate)); d > 0 && (frames == 0 || d < frames) {
+		frames = d
+	}
+
+	ef, _ := lookupEncoder(rec.format)
+	if frames == 0 || !ef.pcm && rec.format != formatFLAC {
+		return rec.maxBytes
+	}
+
+	size := headerSize(rec.format, rec.pcmFormat) + frames*int64(rec.channels*rec.bytesPerSample())
+	if rec.maxBytes > 0 && rec.maxBytes < size {
+		size = rec.maxBytes
+	}
+	return size
+}
+
+// checkFreeSpace compares the free space in dir with the size rec is
+// expected to reach, logging a warning when it looks short, or returning
+// an error when require is set.
+func checkFreeSpace(dir string, rec recording, require bool) error {
+	need := estimateSize(rec)
+	if need == 0 && require {
+		return fmt.Errorf("can't estimate the size of the recording, --require-space needs --duration or --frames with --format %s, %s, %s or %s, or a size limit", formatAIFF, formatWAV, formatFLAC, formatRaw)
+	}
+
+	free, err := freeSpace(dir)
+	if err != nil && require {
+		return fmt.Errorf("failed to check free space in %s : %v", dir, err)
+	}
+	if err != nil {
+		log.Info("failed to check free space in %s : %v", dir, err)
+		return nil
+	}
+
+	if need > free {
+		msg := fmt.Sprintf("the recording needs about %s but only %s is free in %s", formatSize(need), formatSize(free), dir)
+		if require {
+			return errors.New(msg)
+		}
+		log.Error("%s, it will stop early if the disk fills up", msg)
+		return nil
+	}
+
+	log.Info("%s is free in %s", formatSize(free), dir)
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package cmd
+
+// freeSpace returns errNoFreeSpace, there's no portable way to check free space here.
+func freeSpace(path string) (int64, error) { return 0, errNoFreeSpace }
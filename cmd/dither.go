@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/fuskovic/audio-recorder/internal/dsp"
+)
+
+// The dither shapes --dither accepts.
+const (
+	ditherNone        = "none"
+	ditherRectangular = "rectangular"
+	ditherTriangular  = "triangular"
+)
+
+// ditherUsage is the help of the --dither flag of the commands that reduce the bit depth.
+const ditherUsage = "Noise added when samples are reduced from 32 to 16 bits, none, rectangular or triangular. " +
+	"Triangular (TPDF) dither keeps quiet passages free of quantization distortion at the cost of a faint noise floor."
+
+// ditherShapes maps the names --dither accepts to their shapes.
+var ditherShapes = map[string]dsp.DitherShape{
+	ditherNone:        dsp.DitherNone,
+	ditherRectangular: dsp.DitherRectangular,
+	ditherTriangular:  dsp.DitherTriangular,
+}
+
+// parseDither returns the shape of the --dither called name.
+func parseDither(name string) (dsp.DitherShape, error) {
+	shape, ok := ditherShapes[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported dither %q : must be %s, %s or %s", name, ditherNone, ditherRectangular, ditherTriangular)
+	}
+	return shape, nil
+}
@@ -0,0 +1,15 @@
+package cmd
+
+// downmix averages each frame of channels interleaved samples in src into
+// a single sample and returns those samples, reusing the space in dst.
+func downmix(dst, src []int32, channels int) []int32 {
+	dst = dst[:0]
+	for i := 0; i+channels <= len(src); i += channels {
+		var sum int64
+		for _, v := range src[i : i+channels] {
+			sum += int64(v)
+		}
+		dst = append(dst, int32(sum/int64(channels)))
+	}
+	return dst
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// TestDownmix checks that each frame is averaged into a single sample.
+func TestDownmix(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      []int32
+		channels int
+		want     []int32
+	}{
+		{name: "stereo", src: []int32{100, 300, -50, 50, 7, 8, -7, -8}, channels: 2, want: []int32{200, 0, 7, -7}},
+		// the sum can't overflow on full scale channels.
+		{name: "full scale", src: []int32{math.MaxInt32, math.MaxInt32, math.MinInt32, math.MinInt32}, channels: 2, want: []int32{math.MaxInt32, math.MinInt32}},
+		{name: "opposite phase", src: []int32{1 << 30, -1 << 30}, channels: 2, want: []int32{0}},
+		// a frame that isn't complete is left out.
+		{name: "partial frame", src: []int32{2, 4, 6}, channels: 2, want: []int32{3}},
+		{name: "quad", src: []int32{1, 2, 3, 6}, channels: 4, want: []int32{3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := make([]int32, 8)
+			got := downmix(dst, tt.src, tt.channels)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("downmix(%v, %d) = %v, want %v", tt.src, tt.channels, got, tt.want)
+			}
+			if len(got) > 0 && &got[0] != &dst[0] {
+				t.Error("downmix didn't reuse dst")
+			}
+		})
+	}
+}
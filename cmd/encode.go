@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// Encoder writes captured audio in an output format.
+type Encoder interface {
+	// WriteHeader writes whatever precedes the samples.
+	WriteHeader() error
+	// WriteFrames writes interleaved samples, each holding a value
+	// at the bit depth of the recording.
+	WriteFrames(samples []int32) error
+	// Finalize finishes the output, filling in anything that's
+	// only known once recording has stopped.
+	Finalize() error
+}
+
+// sizeFlusher is an Encoder that can fill in its header sizes for the
+// samples written so far and carry on writing after them.
+type sizeFlusher interface {
+	flushSizes() error
+}
+
+// encoderFormat describes an output format and how to create its Encoder.
+type encoderFormat struct {
+	name      string
+	ext       string
+	bitDepths []int
+	new       func(w io.Writer, rec recording) Encoder
+
+	// pcm formats store uncompressed samples, so they can be trimmed and appended to.
+	pcm bool
+}
+
+// encoders holds every output format the record command can write.
+var encoders = []encoderFormat{
+	{name: formatAIFF, ext: "aiff", bitDepths: []int{16, 24, 32}, pcm: true, new: func(w io.Writer, rec recording) Encoder {
+		return &aiffEncoder{newPCMWriter(w, rec)}
+	}},
+	{name: formatWAV, ext: "wav", bitDepths: []int{16, 24, 32}, pcm: true, new: func(w io.Writer, rec recording) Encoder {
+		return &wavEncoder{newPCMWriter(w, rec)}
+	}},
+	{name: formatFLAC, ext: "flac", bitDepths: []int{16, 24, 32}, new: func(w io.Writer, rec recording) Encoder {
+		return newFLACEncoder(w, rec.pcmFormat, rec.threads)
+	}},
+	{name: formatOpus, ext: "opus", bitDepths: []int{16, 24, 32}, new: func(w io.Writer, rec recording) Encoder {
+		return newOpusEncoder(w, rec.pcmFormat, rec.bitrate)
+	}},
+	{name: formatMP3, ext: "mp3", bitDepths: []int{16}, new: func(w io.Writer, rec recording) Encoder {
+		return newMP3Encoder(w, rec.pcmFormat, rec.bitrate)
+	}},
+	{name: formatRaw, ext: "raw", bitDepths: []int{16, 24, 32}, pcm: true, new: func(w io.Writer, rec recording) Encoder {
+		return &rawEncoder{newPCMWriter(w, rec)}
+	}},
+}
+
+// lookupEncoder returns the registered output format called name.
+func lookupEncoder(name string) (encoderFormat, bool) {
+	for _, ef := range encoders {
+		if ef.name == name {
+			return ef, true
+		}
+	}
+	return encoderFormat{}, false
+}
+
+// newEncoder returns the Encoder for rec.format, writing to w.
+func newEncoder(w io.Writer, rec recording) (Encoder, error) {
+	ef, ok := lookupEncoder(rec.format)
+	if !ok {
+		return nil, fmt.Errorf("unsupported format %q", rec.format)
+	}
+	return ef.new(w, rec), nil
+}
+
+// pcmWriter writes uncompressed samples and counts them
+// so that the header sizes can be filled in.
+type pcmWriter struct {
+	w          io.Writer
+	rec        recording
+	numSamples int
+
+	// scratch holds the encoded bytes of samples before they're written,
+	// which avoids binary.Write reflecting on and allocating for every buffer.
+	scratch []byte
+}
+
+// newPCMWriter returns a pcmWriter for rec that continues
+// counting from the existing samples when appending.
+func newPCMWriter(w io.Writer, rec recording) pcmWriter {
+	p := pcmWriter{w: w, rec: rec}
+	if rec.appending {
+		p.numSamples = rec.existingSamples
+	}
+	return p
+}
+
+// WriteFrames writes samples at the bit depth and sample type of the recording in the byte order of the format.
+func (p *pcmWriter) WriteFrames(samples []int32) error {
+	n := p.rec.bytesPerSample() * len(samples)
+	if cap(p.scratch) < n {
+		p.scratch = make([]byte, n)
+	}
+	b := p.scratch[:n]
+
+	// calls through the binary.ByteOrder interface can't be inlined, so
+	// samples are written little endian and byte swapped for big endian.
+	big := p.rec.order == binary.BigEndian
+	switch {
+	case p.rec.bitDepth == 16:
+		for i, s := range samples {
+			v := uint16(s)
+			if big {
+				v = bits.ReverseBytes16(v)
+			}
+			binary.LittleEndian.PutUint16(b[2*i:], v)
+		}
+	case p.rec.bitDepth == 24:
+		// 24 bit samples are captured as int32, so their high 3 bytes are kept.
+		for i, s := range samples {
+			v := uint32(s)
+			if big {
+				b[3*i], b[3*i+1], b[3*i+2] = byte(v>>24), byte(v>>16), byte(v>>8)
+			} else {
+				b[3*i], b[3*i+1], b[3*i+2] = byte(v>>8), byte(v>>16), byte(v>>24)
+			}
+		}
+	case p.rec.float:
+		for i, s := range samples {
+			v := math.Float32bits(sampleToFloat(s))
+			if big {
+				v = bits.ReverseBytes32(v)
+			}
+			binary.LittleEndian.PutUint32(b[4*i:], v)
+		}
+	default:
+		for i, s := range samples {
+			v := uint32(s)
+			if big {
+				v = bits.ReverseBytes32(v)
+			}
+			binary.LittleEndian.PutUint32(b[4*i:], v)
+		}
+	}
+
+	if _, err := p.w.Write(b); err != nil {
+		return err
+	}
+	p.numSamples += len(samples)
+	return nil
+}
+
+// Finalize trims and normalizes the recording if requested and fills in the header sizes.
+func (p *pcmWriter) Finalize() error {
+	return finalize(p.w, p.rec, p.numSamples)
+}
+
+// flushSizes fills in the header sizes for the samples written so far and
+// seeks back to where they end, so that a recording that's cut short before
+// it's finalized still plays. Outputs without a header or that can't seek
+// are left alone.
+func (p *pcmWriter) flushSizes() error {
+	ws, ok := p.w.(io.WriteSeeker)
+	if !ok || p.rec.format == formatRaw {
+		return nil
+	}
+
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to find the end of the sample data : %v", err)
+	}
+
+	if err := fillSizes(ws, p.rec.format, p.rec.pcmFormat, p.numSamples, 0); err != nil {
+		return err
+	}
+
+	if _, err := ws.Seek(end, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek back to the end of the sample data : %v", err)
+	}
+	return nil
+}
+
+// aiffEncoder writes big endian samples after an aiff header.
+type aiffEncoder struct{ pcmWriter }
+
+// WriteHeader writes the form, common and sound chunks.
+func (e *aiffEncoder) WriteHeader() error { return writeHeader(e.w, formatAIFF, e.rec.pcmFormat) }
+
+// wavEncoder writes little endian samples after a wav header.
+type wavEncoder struct{ pcmWriter }
+
+// WriteHeader writes the riff, fmt and data chunks.
+func (e *wavEncoder) WriteHeader() error {
+	if !e.rec.streamWAV {
+		return writeHeader(e.w, formatWAV, e.rec.pcmFormat)
+	}
+
+	header, err := streamingWAVHeader(e.rec.pcmFormat)
+	if err != nil {
+		return err
+	}
+	if _, err := e.w.Write(header); err != nil {
+		return fmt.Errorf("failed to write streaming header : %v", err)
+	}
+	return nil
+}
+
+// rawEncoder writes samples without a header.
+type rawEncoder struct{ pcmWriter }
+
+// WriteHeader does nothing, raw files have no header.
+func (e *rawEncoder) WriteHeader() error { return nil }
+
+// containsInt reports whether v is in values.
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+// benchmarkBufferSizes are the frames per buffer the write path is measured at.
+var benchmarkBufferSizes = []int{64, 1024, 8192}
+
+// rampSamples returns n samples that cover the range of bitDepth.
+func rampSamples(n, bitDepth int) []int32 {
+	samples := make([]int32, n)
+	for i := range samples {
+		v := int32(uint32(i) * 2654435761)
+		if bitDepth == 16 {
+			v >>= 16
+		}
+		samples[i] = v
+	}
+	return samples
+}
+
+// BenchmarkBinaryWrite measures writing a buffer with binary.Write, which
+// reflects on the slice and allocates for every buffer.
+func BenchmarkBinaryWrite(b *testing.B) {
+	for _, frames := range benchmarkBufferSizes {
+		b.Run(fmt.Sprintf("frames=%d", frames), func(b *testing.B) {
+			samples := rampSamples(frames, 32)
+			b.SetBytes(int64(4 * frames))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if err := binary.Write(ioutil.Discard, binary.BigEndian, samples); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkPCMWriter measures the write path of aiff and wav recordings,
+// which fills a reused buffer and writes it once.
+func BenchmarkPCMWriter(b *testing.B) {
+	for _, bitDepth := range []int{16, 32} {
+		for _, frames := range benchmarkBufferSizes {
+			b.Run(fmt.Sprintf("bits=%d/frames=%d", bitDepth, frames), func(b *testing.B) {
+				rec := recording{format: formatAIFF, order: binary.BigEndian, pcmFormat: pcmFormat{sampleRate: 44100, channels: 1, bitDepth: bitDepth}}
+				p := newPCMWriter(ioutil.Discard, rec)
+				samples := rampSamples(frames, bitDepth)
+				b.SetBytes(int64(bitDepth / 8 * frames))
+				b.ReportAllocs()
+
+				for i := 0; i < b.N; i++ {
+					if err := p.WriteFrames(samples); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestPCMWriterMatchesBinaryWrite checks that the write path writes the
+// same bytes as binary.Write of the samples at their bit depth, or of the
+// high 3 bytes of each for 24 bits.
+func TestPCMWriterMatchesBinaryWrite(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		for _, bitDepth := range []int{16, 24, 32} {
+			t.Run(fmt.Sprintf("%s/%d", order, bitDepth), func(t *testing.T) {
+				samples := rampSamples(1000, bitDepth)
+
+				var want bytes.Buffer
+				var v interface{} = samples
+				if bitDepth == 16 {
+					narrow := make([]int16, len(samples))
+					for i, s := range samples {
+						narrow[i] = int16(s)
+					}
+					v = narrow
+				}
+				if err := binary.Write(&want, order, v); err != nil {
+					t.Fatal(err)
+				}
+
+				expected := want.Bytes()
+				if bitDepth == 24 {
+					// 24 bit samples are captured as int32 and keep their high 3 bytes.
+					expected = make([]byte, 0, 3*len(samples))
+					for b := want.Bytes(); len(b) > 0; b = b[4:] {
+						if order == binary.BigEndian {
+							expected = append(expected, b[:3]...)
+						} else {
+							expected = append(expected, b[1:4]...)
+						}
+					}
+				}
+
+				var got bytes.Buffer
+				rec := recording{format: formatAIFF, order: order, pcmFormat: pcmFormat{sampleRate: 44100, channels: 2, bitDepth: bitDepth}}
+				p := newPCMWriter(&got, rec)
+				if err := p.WriteFrames(samples); err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(got.Bytes(), expected) {
+					t.Errorf("wrote % x..., want % x...", got.Bytes()[:16], expected[:16])
+				}
+			})
+		}
+	}
+}
+
+// TestOddSampleDataPad checks the header of 24 bit recordings whose sample
+// data has an odd length, which aiff and wav chunks pad to an even one.
+func TestOddSampleDataPad(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		order  binary.ByteOrder
+		sowt   bool
+		// want is the sample data of the ramp 1, 2, 3.
+		want string
+	}{
+		{name: "aiff", format: formatAIFF, order: binary.BigEndian, want: "000001 000002 000003"},
+		{name: "aifc sowt", format: formatAIFF, order: binary.LittleEndian, sowt: true, want: "010000 020000 030000"},
+		{name: "wav", format: formatWAV, order: binary.LittleEndian, want: "010000 020000 030000"},
+		{name: "raw", format: formatRaw, order: binary.BigEndian, want: "000001 000002 000003"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pf := pcmFormat{sampleRate: 44100, channels: 1, bitDepth: 24, sowt: tt.sowt}
+			rec := recording{format: tt.format, order: tt.order, pcmFormat: pf}
+
+			f := &memoryFile{}
+			enc, err := newEncoder(f, rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := enc.WriteHeader(); err != nil {
+				t.Fatal(err)
+			}
+			if err := enc.WriteFrames([]int32{1 << 8, 2 << 8, 3 << 8}); err != nil {
+				t.Fatal(err)
+			}
+			if err := enc.Finalize(); err != nil {
+				t.Fatal(err)
+			}
+
+			b := f.Bytes()
+			header := int(headerSize(tt.format, pf))
+			want := unhex(t, tt.want)
+			if got := b[header : header+len(want)]; !bytes.Equal(got, want) {
+				t.Errorf("sample data is % x, want % x", got, want)
+			}
+
+			if tt.format == formatRaw {
+				if len(b) != len(want) {
+					t.Errorf("raw recording is %d bytes, want %d without a pad byte", len(b), len(want))
+				}
+				return
+			}
+
+			if len(b) != header+len(want)+1 || b[len(b)-1] != 0 {
+				t.Fatalf("recording is %d bytes ending in %#x, want %d ending in a zero pad byte", len(b), b[len(b)-1], header+len(want)+1)
+			}
+
+			af, err := readHeader(bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if af.bitDepth != 24 || af.sowt != tt.sowt {
+				t.Errorf("header records %d bits, sowt %v", af.bitDepth, af.sowt)
+			}
+			if af.dataSize != int64(len(want)) || af.numFrames != 3 {
+				t.Errorf("header records %d bytes in %d frames, want %d in 3", af.dataSize, af.numFrames, len(want))
+			}
+			if w := af.sizeWarnings(int64(len(b))); len(w) > 0 {
+				t.Errorf("header sizes don't match the file : %v", w)
+			}
+		})
+	}
+}
+
+// TestPCMWriterFlushSizes checks that a recording whose sizes were flushed
+// reads back with the samples written before the flush, without being
+// finalized, and that the next samples are written after them.
+func TestPCMWriterFlushSizes(t *testing.T) {
+	for _, format := range []string{formatWAV, formatAIFF} {
+		t.Run(format, func(t *testing.T) {
+			order := binary.ByteOrder(binary.BigEndian)
+			if format == formatWAV {
+				order = binary.LittleEndian
+			}
+			pf := pcmFormat{sampleRate: 44100, channels: 2, bitDepth: 16}
+			rec := recording{format: format, order: order, pcmFormat: pf}
+
+			f := &memoryFile{}
+			enc, err := newEncoder(f, rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := enc.WriteHeader(); err != nil {
+				t.Fatal(err)
+			}
+
+			samples := rampSamples(2*100, 32)
+			var frames int
+			for _, n := range []int{60, 40} {
+				if err := enc.WriteFrames(samples[2*frames : 2*(frames+n)]); err != nil {
+					t.Fatal(err)
+				}
+				frames += n
+
+				if err := enc.(sizeFlusher).flushSizes(); err != nil {
+					t.Fatal(err)
+				}
+
+				if size, want := len(f.Bytes()), int(headerSize(format, pf))+frames*4; size != want {
+					t.Fatalf("after %d frames, recording is %d bytes, want %d", frames, size, want)
+				}
+
+				af, err := readHeader(bytes.NewReader(f.Bytes()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := int64(frames * 4); af.dataSize != want || af.numFrames != frames {
+					t.Errorf("after %d frames, header records %d bytes in %d frames, want %d in %d", frames, af.dataSize, af.numFrames, want, frames)
+				}
+				if w := af.sizeWarnings(int64(len(f.Bytes()))); len(w) > 0 {
+					t.Errorf("after %d frames, header sizes don't match the file : %v", frames, w)
+				}
+			}
+		})
+	}
+}
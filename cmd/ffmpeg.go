@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	// opusSampleRate is the only sample rate opus is recorded at.
+	opusSampleRate = 48000
+	// opusFrameSize is the number of frames in a 20ms opus packet.
+	opusFrameSize = opusSampleRate / 50
+
+	// mp3FrameSize is the number of frames in an mp3 frame.
+	mp3FrameSize = 1152
+	// mp3MaxChannels is the most channels an mp3 stream can hold.
+	mp3MaxChannels = 2
+	// defaultMP3Bitrate is the bitrate in kbps used when none is given.
+	defaultMP3Bitrate = 128
+)
+
+// mp3SampleRates are the rates in Hz an mp3 stream can be encoded at.
+var mp3SampleRates = []int{8000, 11025, 12000, 16000, 22050, 24000, 32000, 44100, 48000}
+
+// ffmpegEncoder pipes samples through ffmpeg to encode
+// formats that have no pure Go encoder.
+type ffmpegEncoder struct {
+	w  io.Writer
+	pf pcmFormat
+
+	// args select the codec and container of the output.
+	args []string
+
+	// frameSize is the number of frames ffmpeg is sent at a time,
+	// so that every packet it encodes is complete.
+	frameSize int
+
+	cmd     *exec.Cmd
+	in      io.WriteCloser
+	stderr  bytes.Buffer
+	pending []int32
+}
+
+// newOpusEncoder returns an Encoder that writes an ogg opus stream of pf to w.
+// A zero bitrate leaves the choice to the encoder.
+func newOpusEncoder(w io.Writer, pf pcmFormat, bitrate int) *ffmpegEncoder {
+	args := []string{"-c:a", "libopus", "-application", "voip", "-frame_duration", "20"}
+	if bitrate > 0 {
+		args = append(args, "-b:a", fmt.Sprintf("%dk", bitrate))
+	}
+
+	return &ffmpegEncoder{
+		w:         w,
+		pf:        pf,
+		args:      append(args, "-f", "ogg"),
+		frameSize: opusFrameSize,
+	}
+}
+
+// newMP3Encoder returns an Encoder that writes a constant bitrate mp3 stream of pf to w.
+// A zero bitrate uses defaultMP3Bitrate.
+func newMP3Encoder(w io.Writer, pf pcmFormat, bitrate int) *ffmpegEncoder {
+	if bitrate == 0 {
+		bitrate = defaultMP3Bitrate
+	}
+
+	return &ffmpegEncoder{
+		w:         w,
+		pf:        pf,
+		args:      []string{"-c:a", "libmp3lame", "-b:a", fmt.Sprintf("%dk", bitrate), "-f", "mp3"},
+		frameSize: mp3FrameSize,
+	}
+}
+
+// WriteHeader starts ffmpeg, which writes the header itself once it has samples.
+func (e *ffmpegEncoder) WriteHeader() error {
+	sampleFormat := "s32le"
+	if e.pf.bitDepth == 16 {
+		sampleFormat = "s16le"
+	}
+
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		"-f", sampleFormat,
+		"-ar", strconv.Itoa(e.pf.sampleRate),
+		"-ac", strconv.Itoa(e.pf.channels),
+		"-i", "pipe:0",
+	}
+	args = append(append(args, e.args...), "pipe:1")
+
+	e.cmd = exec.Command("ffmpeg", args...)
+	e.cmd.Stdout = e.w
+	e.cmd.Stderr = &e.stderr
+
+	in, err := e.cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open ffmpeg input : %v", err)
+	}
+	e.in = in
+
+	if err := e.cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg : %v", err)
+	}
+
+	log.Success("successfully started ffmpeg")
+	return nil
+}
+
+// WriteFrames sends ffmpeg every whole frame of samples, holding back the rest.
+func (e *ffmpegEncoder) WriteFrames(samples []int32) error {
+	e.pending = append(e.pending, samples...)
+
+	chunk := e.frameSize * e.pf.channels
+	n := len(e.pending) / chunk * chunk
+	if n == 0 {
+		return nil
+	}
+
+	if err := e.send(e.pending[:n]); err != nil {
+		return err
+	}
+	e.pending = append(e.pending[:0], e.pending[n:]...)
+	return nil
+}
+
+// Finalize sends the held back samples and waits for ffmpeg to finish the stream.
+func (e *ffmpegEncoder) Finalize() error {
+	sendErr := e.send(e.pending)
+	e.pending = nil
+
+	if err := e.in.Close(); err != nil {
+		return fmt.Errorf("failed to close ffmpeg input : %v", err)
+	}
+
+	if err := e.cmd.Wait(); err != nil {
+		return fmt.Errorf("failed to encode with ffmpeg : %v : %s", err, strings.TrimSpace(e.stderr.String()))
+	}
+	return sendErr
+}
+
+// send writes samples to ffmpeg as little endian values at the recording's bit depth.
+func (e *ffmpegEncoder) send(samples []int32) error {
+	var data interface{} = samples
+	if e.pf.bitDepth == 16 {
+		narrow := make([]int16, len(samples))
+		for i, s := range samples {
+			narrow[i] = int16(s)
+		}
+		data = narrow
+	}
+
+	if err := binary.Write(e.in, binary.LittleEndian, data); err != nil {
+		return fmt.Errorf("failed to write to ffmpeg : %v", err)
+	}
+	return nil
+}
+
+// validMP3SampleRate reports whether mp3 can be encoded at rate.
+func validMP3SampleRate(rate int) bool {
+	return containsInt(mp3SampleRates, rate)
+}
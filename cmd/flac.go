@@ -0,0 +1,387 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+// flacBlockSize is the number of frames in each FLAC frame.
+const flacBlockSize = 4096
+
+// flacMaxBitDepth is the widest sample the FLAC encoder can store.
+const flacMaxBitDepth = 24
+
+// flacMaxChannels is the most channels a FLAC stream can hold.
+const flacMaxChannels = 8
+
+// flacEncoder compresses captured samples into a FLAC stream.
+type flacEncoder struct {
+	w   io.Writer
+	pf  pcmFormat
+	enc *flac.Encoder
+
+	// shift drops the low bits of samples wider than flacMaxBitDepth.
+	// 24 bit samples are captured as int32, so they're shifted too.
+	shift uint
+	// bitDepth is the width of the samples stored in the stream.
+	bitDepth int
+
+	// block holds the samples of each channel until a full FLAC frame is buffered.
+	block [][]int32
+
+	// threads is the number of goroutines FLAC frames are encoded on.
+	threads int
+	// pool, when threads is above 1, encodes frames in parallel and
+	// writes them to w in the order their samples were captured.
+	pool *orderedPool
+	// submitted numbers the frames given to pool.
+	submitted uint64
+
+	// info is the stream info enc wrote, which the pool's workers encode
+	// frames with. Their frames bypass enc, so the hash of their samples,
+	// their count and block sizes are kept here for Finalize to rewrite it with.
+	info                       meta.StreamInfo
+	md5sum                     hash.Hash
+	nsamples                   uint64
+	blockSizeMin, blockSizeMax uint16
+}
+
+// encodedFLACFrame is a FLAC frame a pool worker encoded and the frame it encoded.
+type encodedFLACFrame struct {
+	f   *frame.Frame
+	b   []byte
+	err error
+}
+
+// newFLACEncoder returns an Encoder that writes a FLAC stream of pf to w,
+// encoding its frames on threads goroutines. The output is the same for
+// any number of threads. The total number of samples is filled in on
+// Finalize when w is an io.WriteSeeker.
+func newFLACEncoder(w io.Writer, pf pcmFormat, threads int) *flacEncoder {
+	e := &flacEncoder{w: w, pf: pf, threads: threads, bitDepth: pf.bitDepth}
+	if pf.bitDepth > 16 {
+		e.shift, e.bitDepth = 32-flacMaxBitDepth, flacMaxBitDepth
+	}
+	e.block = newFLACBlock(pf.channels)
+	return e
+}
+
+// newFLACBlock returns empty sample buffers for a FLAC frame of channels.
+func newFLACBlock(channels int) [][]int32 {
+	block := make([][]int32, channels)
+	for c := range block {
+		block[c] = make([]int32, 0, flacBlockSize)
+	}
+	return block
+}
+
+// WriteHeader writes the stream info.
+func (e *flacEncoder) WriteHeader() error {
+	pf := e.pf
+	e.info = meta.StreamInfo{
+		BlockSizeMin:  flacBlockSize,
+		BlockSizeMax:  flacBlockSize,
+		SampleRate:    uint32(pf.sampleRate),
+		NChannels:     uint8(pf.channels),
+		BitsPerSample: uint8(e.bitDepth),
+	}
+	info := e.info
+
+	// the flac encoder closes writers that implement io.Closer,
+	// but the output belongs to the caller.
+	var out io.Writer = struct{ io.Writer }{e.w}
+	if ws, ok := e.w.(io.WriteSeeker); ok {
+		out = struct{ io.WriteSeeker }{ws}
+	}
+
+	enc, err := flac.NewEncoder(out, &info)
+	if err != nil {
+		return fmt.Errorf("failed to write flac stream info : %v", err)
+	}
+
+	log.Success("successfully wrote flac stream info")
+	e.enc = enc
+
+	if e.threads > 1 {
+		e.md5sum = md5.New()
+		e.pool = newOrderedPool(e.threads, func(v interface{}) error {
+			return e.writeEncodedFrame(v.(encodedFLACFrame))
+		})
+	}
+	return nil
+}
+
+// WriteFrames buffers samples and encodes every FLAC frame they complete.
+func (e *flacEncoder) WriteFrames(samples []int32) error {
+	for i, s := range samples {
+		c := i % e.pf.channels
+		e.block[c] = append(e.block[c], s>>e.shift)
+
+		if c == e.pf.channels-1 && len(e.block[c]) == flacBlockSize {
+			if err := e.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Finalize encodes the buffered samples and rewrites the stream info
+// with the total number of samples.
+func (e *flacEncoder) Finalize() error {
+	if err := e.flush(); err != nil {
+		return err
+	}
+
+	if e.pool != nil {
+		if err := e.pool.close(); err != nil {
+			return err
+		}
+		return e.rewriteStreamInfo()
+	}
+
+	if err := e.enc.Close(); err != nil {
+		return fmt.Errorf("failed to finish flac stream : %v", err)
+	}
+	return nil
+}
+
+// flush encodes the buffered samples as a single FLAC frame. With a pool
+// the frame is encoded by a worker, which takes over the buffered samples.
+func (e *flacEncoder) flush() error {
+	if len(e.block[0]) == 0 {
+		return nil
+	}
+
+	if e.pool != nil {
+		block, num := e.block, e.submitted
+		e.block = newFLACBlock(e.pf.channels)
+		e.submitted++
+		return e.pool.submit(func() interface{} { return e.encodeFrame(block, num) })
+	}
+
+	err := e.writeFrame(e.newFrame(e.block))
+	for c := range e.block {
+		e.block[c] = e.block[c][:0]
+	}
+	return err
+}
+
+// newFrame returns a FLAC frame holding the samples of each channel in block.
+func (e *flacEncoder) newFrame(block [][]int32) *frame.Frame {
+	f := &frame.Frame{
+		Header: frame.Header{
+			HasFixedBlockSize: true,
+			BlockSize:         uint16(len(block[0])),
+			SampleRate:        uint32(e.pf.sampleRate),
+			Channels:          frame.ChannelsMono + frame.Channels(e.pf.channels-1),
+			BitsPerSample:     uint8(e.bitDepth),
+		},
+	}
+	for _, samples := range block {
+		f.Subframes = append(f.Subframes, fixedSubframe(samples))
+	}
+	return f
+}
+
+// writeFrame writes f to the stream, which numbers frames in the order they're written.
+func (e *flacEncoder) writeFrame(f *frame.Frame) error {
+	if err := e.enc.WriteFrame(f); err != nil {
+		return fmt.Errorf("failed to write flac frame : %v", err)
+	}
+	return nil
+}
+
+// encodeFrame encodes the FLAC frame holding the samples of block as frame
+// num of the stream. The frame is written by an encoder of its own, which
+// numbers it 0, so its number and the checksums covering it are redone.
+func (e *flacEncoder) encodeFrame(block [][]int32, num uint64) encodedFLACFrame {
+	var buf bytes.Buffer
+	info := e.info
+	enc, err := flac.NewEncoder(&buf, &info)
+	if err != nil {
+		return encodedFLACFrame{err: fmt.Errorf("failed to encode flac frame : %v", err)}
+	}
+	buf.Reset()
+
+	f := e.newFrame(block)
+	if err := enc.WriteFrame(f); err != nil {
+		return encodedFLACFrame{err: fmt.Errorf("failed to encode flac frame : %v", err)}
+	}
+	return encodedFLACFrame{f: f, b: renumberFLACFrame(buf.Bytes(), num)}
+}
+
+// writeEncodedFrame writes a frame a worker encoded to the stream, and adds
+// it to the stream info the way enc does for the frames it writes.
+func (e *flacEncoder) writeEncodedFrame(ef encodedFLACFrame) error {
+	if ef.err != nil {
+		return ef.err
+	}
+
+	if _, err := e.w.Write(ef.b); err != nil {
+		return fmt.Errorf("failed to write flac frame : %v", err)
+	}
+
+	ef.f.Hash(e.md5sum)
+	n := ef.f.BlockSize
+	e.nsamples += uint64(n)
+	if e.blockSizeMin == 0 || n < e.blockSizeMin {
+		e.blockSizeMin = n
+	}
+	if n > e.blockSizeMax {
+		e.blockSizeMax = n
+	}
+	return nil
+}
+
+// rewriteStreamInfo rewrites the stream info of the frames written by the
+// pool when w can seek, as enc.Close does for its own.
+func (e *flacEncoder) rewriteStreamInfo() error {
+	ws, ok := e.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+
+	info := e.info
+	info.NSamples, info.BlockSizeMin, info.BlockSizeMax = e.nsamples, e.blockSizeMin, e.blockSizeMax
+	copy(info.MD5sum[:], e.md5sum.Sum(nil))
+
+	// the stream info follows the fLaC signature, which a new encoder writes first.
+	var buf bytes.Buffer
+	if _, err := flac.NewEncoder(&buf, &info); err != nil {
+		return fmt.Errorf("failed to encode flac stream info : %v", err)
+	}
+
+	if _, err := ws.Seek(4, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to flac stream info : %v", err)
+	}
+	if _, err := ws.Write(buf.Bytes()[4:]); err != nil {
+		return fmt.Errorf("failed to finish flac stream : %v", err)
+	}
+	return nil
+}
+
+// renumberFLACFrame returns the FLAC frame b, which is numbered 0, numbered
+// num instead, with the checksums of its header and of the whole frame redone.
+func renumberFLACFrame(b []byte, num uint64) []byte {
+	// the number follows the first 4 bytes of the header, and a block size
+	// and sample rate that don't have a code of their own follow it.
+	var suffix int
+	switch b[2] >> 4 {
+	case 6:
+		suffix++
+	case 7:
+		suffix += 2
+	}
+	switch b[2] & 0x0f {
+	case 12:
+		suffix++
+	case 13, 14:
+		suffix += 2
+	}
+
+	out := make([]byte, 0, len(b)+6)
+	out = append(out, b[:4]...)
+	out = appendFLACNumber(out, num)
+	out = append(out, b[5:5+suffix]...)
+
+	var crc8 uint8
+	for _, c := range out {
+		crc8 = flacCRC8[crc8^c]
+	}
+	out = append(out, crc8)
+	out = append(out, b[5+suffix+1:len(b)-2]...)
+
+	var crc16 uint16
+	for _, c := range out {
+		crc16 = crc16<<8 ^ flacCRC16[byte(crc16>>8)^c]
+	}
+	return append(out, byte(crc16>>8), byte(crc16))
+}
+
+// appendFLACNumber appends x coded the way FLAC frame headers number frames,
+// like UTF-8 extended to 36 bits.
+func appendFLACNumber(b []byte, x uint64) []byte {
+	if x < 0x80 {
+		return append(b, byte(x))
+	}
+
+	// n continuation bytes of 6 bits each leave 6-n bits in the first byte.
+	n := 1
+	for n < 6 && x >= 1<<uint(5*n+6) {
+		n++
+	}
+
+	b = append(b, byte(0xff<<uint(7-n))|byte(x>>uint(6*n)))
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, 0x80|byte(x>>uint(6*i))&0x3f)
+	}
+	return b
+}
+
+// flacCRC8 and flacCRC16 are the tables of the checksums of FLAC frame
+// headers and frames, whose polynomials are 0x07 and 0x8005.
+var flacCRC8, flacCRC16 = flacCRCTables()
+
+func flacCRCTables() (t8 [256]uint8, t16 [256]uint16) {
+	for i := range t8 {
+		c8, c16 := uint8(i), uint16(i)<<8
+		for j := 0; j < 8; j++ {
+			if c8&0x80 != 0 {
+				c8 = c8<<1 ^ 0x07
+			} else {
+				c8 <<= 1
+			}
+			if c16&0x8000 != 0 {
+				c16 = c16<<1 ^ 0x8005
+			} else {
+				c16 <<= 1
+			}
+		}
+		t8[i], t16[i] = c8, c16
+	}
+	return t8, t16
+}
+
+// fixedSubframe predicts each sample from the two before it and rice codes
+// the difference, which stays small for smooth signals like audio.
+func fixedSubframe(samples []int32) *frame.Subframe {
+	const order = 2
+
+	sub := &frame.Subframe{Samples: samples, NSamples: len(samples)}
+	if len(samples) <= order {
+		sub.Pred = frame.PredVerbatim
+		return sub
+	}
+
+	// the rice parameter is picked from the mean of the zigzag encoded residuals.
+	var sum uint64
+	for i := order; i < len(samples); i++ {
+		r := int64(samples[i]) - 2*int64(samples[i-1]) + int64(samples[i-2])
+		if r < 0 {
+			sum += uint64(-r)*2 - 1
+		} else {
+			sum += uint64(r) * 2
+		}
+	}
+	mean := sum / uint64(len(samples)-order)
+
+	// 31 is reserved as an escape code.
+	var k uint
+	for k < 30 && uint64(1)<<(k+1) <= mean {
+		k++
+	}
+
+	sub.Pred = frame.PredFixed
+	sub.Order = order
+	sub.ResidualCodingMethod = frame.ResidualCodingMethodRice2
+	sub.RiceSubframe = &frame.RiceSubframe{Partitions: []frame.RicePartition{{Param: k}}}
+	return sub
+}
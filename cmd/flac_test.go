@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+)
+
+// encodeFLACFile encodes samples of pf on threads goroutines into a temporary
+// file, so that the stream info is rewritten, and returns what it holds.
+func encodeFLACFile(t *testing.T, pf pcmFormat, threads int, samples []int32) []byte {
+	t.Helper()
+
+	f, err := ioutil.TempFile("", "flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	encodeFLAC(t, f, pf, threads, samples)
+
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// encodeFLAC encodes samples of pf to w on threads goroutines, a buffer at a time.
+func encodeFLAC(t *testing.T, w interface{ Write([]byte) (int, error) }, pf pcmFormat, threads int, samples []int32) {
+	t.Helper()
+
+	e := newFLACEncoder(w, pf, threads)
+	if err := e.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	for len(samples) > 0 {
+		n := 1000 * pf.channels
+		if n > len(samples) {
+			n = len(samples)
+		}
+		if err := e.WriteFrames(samples[:n]); err != nil {
+			t.Fatal(err)
+		}
+		samples = samples[n:]
+	}
+
+	if err := e.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testSignal returns frames of a tone with a little noise, in the range of
+// bitDepth the way they're captured.
+func testSignal(pf pcmFormat, frames int) []int32 {
+	samples := make([]int32, frames*pf.channels)
+	seed := uint32(1)
+	for i := range samples {
+		seed = seed*1664525 + 1013904223
+		v := 0.5*math.Sin(float64(i/pf.channels)*2*math.Pi*440/float64(pf.sampleRate)*float64(1+i%pf.channels)) + float64(seed>>24)/4096
+		if pf.bitDepth == 16 {
+			samples[i] = int32(v * math.MaxInt16)
+		} else {
+			samples[i] = int32(v * math.MaxInt32)
+		}
+	}
+	return samples
+}
+
+func TestFLACThreadsSameOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		pf     pcmFormat
+		frames int
+	}{
+		{name: "16 bit stereo", pf: pcmFormat{sampleRate: 44100, channels: 2, bitDepth: 16}, frames: 10*flacBlockSize + 123},
+		{name: "24 bit mono", pf: pcmFormat{sampleRate: 48000, channels: 1, bitDepth: 24}, frames: 5*flacBlockSize + 1},
+		{name: "32 bit captured", pf: pcmFormat{sampleRate: 96000, channels: 2, bitDepth: 32}, frames: 3 * flacBlockSize},
+		{name: "rate without a code", pf: pcmFormat{sampleRate: 11025, channels: 1, bitDepth: 16}, frames: 2*flacBlockSize + 7},
+		{name: "rate in hertz", pf: pcmFormat{sampleRate: 44101, channels: 1, bitDepth: 16}, frames: flacBlockSize + 300},
+		{name: "multibyte frame numbers", pf: pcmFormat{sampleRate: 8000, channels: 1, bitDepth: 16}, frames: 130*flacBlockSize + 5},
+		{name: "shorter than a frame", pf: pcmFormat{sampleRate: 16000, channels: 1, bitDepth: 16}, frames: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := testSignal(tt.pf, tt.frames)
+			want := encodeFLACFile(t, tt.pf, 1, samples)
+
+			for _, threads := range []int{2, 3, 8} {
+				if got := encodeFLACFile(t, tt.pf, threads, samples); !bytes.Equal(got, want) {
+					t.Errorf("--threads %d wrote %d bytes that differ from the %d of --threads 1", threads, len(got), len(want))
+				}
+			}
+		})
+	}
+}
+
+func TestFLACThreadsSameOutputWithoutSeeking(t *testing.T) {
+	pf := pcmFormat{sampleRate: 44100, channels: 2, bitDepth: 16}
+	samples := testSignal(pf, 4*flacBlockSize+10)
+
+	var want, got bytes.Buffer
+	encodeFLAC(t, &want, pf, 1, samples)
+	encodeFLAC(t, &got, pf, 4, samples)
+
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("--threads 4 wrote %d bytes that differ from the %d of --threads 1", got.Len(), want.Len())
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+	"go.coder.com/cli"
+	"go.coder.com/flog"
+)
+
+type formatsCmd struct{}
+
+// Spec returns a command spec containing a description of it's usage.
+func (cmd *formatsCmd) Spec() cli.CommandSpec {
+	return cli.CommandSpec{
+		Name:  "formats",
+		Usage: "",
+		Desc:  "List the output formats the record command supports.",
+	}
+}
+
+// Run prints every registered output format.
+func (cmd *formatsCmd) Run(fl *pflag.FlagSet) {
+	if err := printFormats(os.Stdout, encoders); err != nil {
+		flog.Error("failed to list formats : %v", err)
+	}
+}
+
+// printFormats writes a table of formats with their file extension and bit depths.
+func printFormats(w io.Writer, formats []encoderFormat) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FORMAT\tEXTENSION\tBIT DEPTHS")
+
+	for _, ef := range formats {
+		fmt.Fprintf(tw, "%s\t.%s\t%s\n", ef.name, ef.ext, joinInts(ef.bitDepths))
+	}
+	return tw.Flush()
+}
+
+// joinInts returns values as a comma separated list.
+func joinInts(values []int) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, ", ")
+}
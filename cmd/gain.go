@@ -0,0 +1,33 @@
+package cmd
+
+import "math"
+
+// applyGain multiplies every sample in buf, an []int16 or []int32 capture
+// buffer, by gain. Samples that would overflow are clamped to the limits of
+// their type rather than wrapping, and the number clamped is returned.
+func applyGain(buf interface{}, gain float64) int {
+	var clamped int
+	switch b := buf.(type) {
+	case []int16:
+		for i, v := range b {
+			g := math.Round(float64(v) * gain)
+			if g > math.MaxInt16 {
+				g, clamped = math.MaxInt16, clamped+1
+			} else if g < math.MinInt16 {
+				g, clamped = math.MinInt16, clamped+1
+			}
+			b[i] = int16(g)
+		}
+	case []int32:
+		for i, v := range b {
+			g := math.Round(float64(v) * gain)
+			if g > math.MaxInt32 {
+				g, clamped = math.MaxInt32, clamped+1
+			} else if g < math.MinInt32 {
+				g, clamped = math.MinInt32, clamped+1
+			}
+			b[i] = int32(g)
+		}
+	}
+	return clamped
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+	"go.coder.com/cli"
+	"go.coder.com/flog"
+)
+
+type infoCmd struct {
+	inFile string
+	json   bool
+}
+
+// fileInfo is the summary printed by the info command.
+type fileInfo struct {
+	Format       string   `json:"format"`
+	SampleRate   int      `json:"sampleRate"`
+	Channels     int      `json:"channels"`
+	BitDepth     int      `json:"bitDepth"`
+	SampleFormat string   `json:"sampleFormat"`
+	Frames       int      `json:"frames"`
+	Duration     float64  `json:"durationSeconds"`
+	Title        string   `json:"title,omitempty"`
+	Author       string   `json:"author,omitempty"`
+	Comment      string   `json:"comment,omitempty"`
+	Checksum     string   `json:"checksum,omitempty"`
+	Warnings     []string `json:"warnings,omitempty"`
+}
+
+// Spec returns a command spec containing a description of it's usage.
+func (cmd *infoCmd) Spec() cli.CommandSpec {
+	return cli.CommandSpec{
+		Name:  "info",
+		Usage: "[flags]",
+		Desc:  "Print the properties of an AIFF or WAV recording.",
+	}
+}
+
+// RegisterFlags initializes how a flag set is processed for a particular command.
+func (cmd *infoCmd) RegisterFlags(fl *pflag.FlagSet) {
+	fl.StringVarP(&cmd.inFile, "in", "i", cmd.inFile, "Name the input file.")
+	fl.BoolVar(&cmd.json, "json", false, "Print the properties as JSON.")
+}
+
+// Run parses the header of the input file and prints a summary of it.
+func (cmd *infoCmd) Run(fl *pflag.FlagSet) {
+	if cmd.inFile == "" {
+		flog.Error("no input file provided")
+		fl.Usage()
+		return
+	}
+
+	f, err := os.Open(cmd.inFile)
+	if err != nil {
+		flog.Error("failed to open %s : %v", cmd.inFile, err)
+		fl.Usage()
+		return
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			flog.Error("failed to close %s : %v", cmd.inFile, err)
+		}
+	}()
+
+	fi, err := f.Stat()
+	if err != nil {
+		flog.Error("failed to stat %s : %v", cmd.inFile, err)
+		return
+	}
+
+	af, err := readHeader(f)
+	if err != nil {
+		flog.Error("failed to read header of %s : %v", cmd.inFile, err)
+		return
+	}
+
+	info := fileInfo{
+		Format:       af.format,
+		SampleRate:   af.sampleRate,
+		Channels:     af.channels,
+		BitDepth:     af.bitDepth,
+		SampleFormat: sampleFormatInt,
+		Frames:       af.numFrames,
+		Duration:     float64(af.numFrames) / float64(af.sampleRate),
+		Warnings:     af.sizeWarnings(fi.Size()),
+	}
+
+	if af.float {
+		info.SampleFormat = sampleFormatFloat32
+	}
+
+	meta, err := readMetadata(f, af)
+	if err != nil {
+		flog.Error("failed to read metadata of %s : %v", cmd.inFile, err)
+	}
+	info.Title, info.Author, info.Comment, info.Checksum = meta.title, meta.author, meta.comment, meta.checksum
+
+	if cmd.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(info); err != nil {
+			flog.Error("failed to encode info : %v", err)
+		}
+		return
+	}
+
+	fmt.Printf("format:      %s\n", info.Format)
+	fmt.Printf("sample rate: %d Hz\n", info.SampleRate)
+	fmt.Printf("channels:    %d\n", info.Channels)
+	fmt.Printf("bit depth:   %d\n", info.BitDepth)
+	fmt.Printf("samples:     %s\n", info.SampleFormat)
+	fmt.Printf("frames:      %d\n", info.Frames)
+	fmt.Printf("duration:    %s\n", time.Duration(info.Duration*float64(time.Second)).Round(time.Millisecond))
+
+	for _, field := range []struct{ name, value string }{{"title", info.Title}, {"author", info.Author}, {"comment", info.Comment}, {"checksum", info.Checksum}} {
+		if field.value != "" {
+			fmt.Printf("%-12s %s\n", field.name+":", field.value)
+		}
+	}
+
+	for _, w := range info.Warnings {
+		flog.Error("%s", w)
+	}
+}
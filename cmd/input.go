@@ -0,0 +1,334 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// maxReadRetries is how many times in a row a failed read is retried
+// before the recording is stopped.
+const maxReadRetries = 3
+
+// readRetryDelay is the wait before the first retry of a failed read,
+// which doubles for each retry after it.
+const readRetryDelay = 100 * time.Millisecond
+
+// input fills the capture buffer of a recording.
+type input interface {
+	// Read fills the buffer and returns the number of samples in it.
+	// It returns io.EOF once there's nothing left to read.
+	Read() (int, error)
+	// Available returns the number of frames that can be read without waiting.
+	Available() (int, error)
+	// Restart tries to recover the input after a failed read.
+	Restart() error
+	Close() error
+}
+
+// readInput reads the next buffer from src. A failed read restarts src
+// and is retried after a growing delay, so that a passing fault costs a
+// few buffers instead of the recording, and every failure is counted in
+// failures. It gives up with an error after maxReadRetries failed retries.
+// An overflow isn't a failure, its buffer is still filled.
+func readInput(src input, failures *int) (int, error) {
+	delay := readRetryDelay
+	for retry := 0; ; retry++ {
+		n, err := src.Read()
+		if err == nil || err == io.EOF || err == portaudio.InputOverflowed {
+			return n, err
+		}
+
+		*failures++
+		log.Error("failed to read from audio stream : %v", err)
+
+		if retry == maxReadRetries {
+			return 0, fmt.Errorf("failed to read from audio stream %d times in a row, stopping the recording", retry+1)
+		}
+
+		log.Info("restarting audio stream in %s", delay)
+		time.Sleep(delay)
+		delay *= 2
+
+		if err := src.Restart(); err != nil {
+			log.Error("failed to restart audio stream : %v", err)
+		} else {
+			log.Success("successfully restarted audio stream")
+		}
+	}
+}
+
+// captureDevice is the part of portaudio that capturing from an input
+// device goes through, so that the capture path can run without one.
+type captureDevice interface {
+	Initialize() error
+	// OpenStream opens a stream from the device opts picks, as openStream
+	// picks it, that captures framesPerBuffer frames of pf into buf,
+	// an []int16, []int32 or []float32, on every Read.
+	OpenStream(opts streamOptions, pf pcmFormat, framesPerBuffer int, buf interface{}) error
+	Start() error
+	// Read fills the buffer given to OpenStream. An overflow is reported
+	// with portaudio.InputOverflowed, but the buffer is still filled.
+	Read() error
+	// Available returns the number of frames captured but not yet read.
+	Available() (int, error)
+	Stop() error
+	Close() error
+	Terminate() error
+}
+
+// portaudioDevice captures from an input device through portaudio.
+type portaudioDevice struct{ stream *portaudio.Stream }
+
+// Initialize initializes portaudio.
+func (d *portaudioDevice) Initialize() error { return portaudio.Initialize() }
+
+// OpenStream opens the input stream.
+func (d *portaudioDevice) OpenStream(opts streamOptions, pf pcmFormat, framesPerBuffer int, buf interface{}) error {
+	stream, err := openStream(opts, pf, framesPerBuffer, buf)
+	if err != nil {
+		return err
+	}
+	d.stream = stream
+	return nil
+}
+
+// Start starts the stream.
+func (d *portaudioDevice) Start() error { return d.stream.Start() }
+
+// Read fills the buffer from the stream.
+func (d *portaudioDevice) Read() error { return d.stream.Read() }
+
+// Available returns the number of frames the stream has captured but that haven't been read.
+func (d *portaudioDevice) Available() (int, error) { return d.stream.AvailableToRead() }
+
+// Stop stops the stream.
+func (d *portaudioDevice) Stop() error { return d.stream.Stop() }
+
+// Close closes the stream.
+func (d *portaudioDevice) Close() error { return d.stream.Close() }
+
+// Terminate terminates portaudio.
+func (d *portaudioDevice) Terminate() error { return portaudio.Terminate() }
+
+// deviceInput captures from a captureDevice.
+type deviceInput struct {
+	dev  captureDevice
+	size int
+
+	// picks, when set, are the channels of the device copied from each
+	// frame of raw, which holds frames of rawChannels samples, to buf.
+	picks       []int
+	raw, buf    interface{}
+	rawChannels int
+}
+
+// openDeviceInput initializes dev and starts an input
+// stream from it for rec that captures into buf.
+func openDeviceInput(dev captureDevice, rec recording, buf interface{}) (*deviceInput, error) {
+	if err := dev.Initialize(); err != nil {
+		return nil, fmt.Errorf("failed to initialize portaudio : %v", err)
+	}
+
+	log.Success("successfully initialized portaudio")
+
+	pf := rec.capturePCMFormat()
+	d := &deviceInput{dev: dev, size: rec.buffer * pf.channels}
+
+	// a channel map captures every channel up to the last one it picks.
+	opened, streamBuf := pf, buf
+	if rec.channelMap != nil {
+		d.picks, d.buf, d.rawChannels = rec.channelMap, buf, mappedChannels(rec.channelMap)
+		d.raw = newCaptureBuffer(buf, rec.buffer*d.rawChannels)
+		opened.channels, streamBuf = d.rawChannels, d.raw
+	}
+
+	err := dev.OpenStream(rec.streamOptions(), opened, rec.buffer, streamBuf)
+	switch {
+	case err == portaudio.InvalidSampleRate:
+		err = fmt.Errorf("sample rate %d Hz is not supported by the input device", pf.sampleRate)
+	case err == portaudio.InvalidDevice || err == portaudio.DeviceUnavailable:
+		// the device was found, so it went away or another program holds it.
+		err = fmt.Errorf("the input device can't be opened, it may have been disconnected or be in use : %s", noInputDeviceHint)
+	case err != nil:
+		err = fmt.Errorf("failed to open audio stream : %v", err)
+	}
+	if err != nil {
+		terminate(dev)
+		return nil, err
+	}
+
+	log.Success("successfully opened audio stream")
+
+	if err := dev.Start(); err != nil {
+		closeStream(dev)
+		terminate(dev)
+		return nil, fmt.Errorf("failed to start audio stream : %v", err)
+	}
+
+	return d, nil
+}
+
+// Read fills the buffer from the stream. An overflow is reported
+// with portaudio.InputOverflowed, but the buffer is still filled.
+func (d *deviceInput) Read() (int, error) {
+	err := d.dev.Read()
+	if d.picks != nil {
+		selectChannels(d.buf, d.raw, d.rawChannels, d.picks)
+	}
+	return d.size, err
+}
+
+// Available returns the number of frames the stream has captured but that haven't been read.
+func (d *deviceInput) Available() (int, error) {
+	return d.dev.Available()
+}
+
+// Restart stops and starts the stream again.
+func (d *deviceInput) Restart() error {
+	// the stream may have stopped itself, so failing to stop it isn't fatal.
+	if err := d.dev.Stop(); err != nil {
+		log.Info("failed to stop audio stream : %v", err)
+	}
+	return d.dev.Start()
+}
+
+// Close stops and closes the stream, then terminates the device.
+func (d *deviceInput) Close() error {
+	log.Info("stopping audio stream")
+
+	if err := d.dev.Stop(); err != nil {
+		log.Error("failed to stop audio stream : %v", err)
+	} else {
+		log.Success("successfully stopped audio stream")
+	}
+
+	closeStream(d.dev)
+	terminate(d.dev)
+	return nil
+}
+
+// closeStream closes the stream of dev and logs the result.
+func closeStream(dev captureDevice) {
+	log.Info("closing audio stream")
+
+	if err := dev.Close(); err != nil {
+		log.Error("failed to close audio stream : %v", err)
+	} else {
+		log.Success("successfully closed audio stream")
+	}
+}
+
+// terminate terminates dev and logs the result.
+func terminate(dev captureDevice) {
+	log.Info("terminating portaudio")
+
+	if err := dev.Terminate(); err != nil {
+		log.Error("failed to terminate portaudio : %v", err)
+	} else {
+		log.Success("successfully terminated port audio")
+	}
+}
+
+// fileInput reads raw samples from a file instead of an input device.
+type fileInput struct {
+	f     *os.File
+	order binary.ByteOrder
+	buf   interface{}
+	bytes []byte
+	width int
+}
+
+// openFileInput opens name to read raw samples in order into buf,
+// an []int16, []int32 or []float32 capture buffer. 24 bit samples are
+// read into the high 3 bytes of an []int32 buffer.
+func openFileInput(name string, order binary.ByteOrder, bitDepth int, buf interface{}) (*fileInput, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s : %v", name, err)
+	}
+
+	log.Success("successfully opened %s", name)
+
+	in := &fileInput{f: f, order: order, buf: buf}
+	switch b := buf.(type) {
+	case []int16:
+		in.width, in.bytes = 2, make([]byte, 2*len(b))
+	case []int32:
+		in.width = 4
+		if bitDepth == 24 {
+			in.width = 3
+		}
+		in.bytes = make([]byte, in.width*len(b))
+	case []float32:
+		in.width, in.bytes = 4, make([]byte, 4*len(b))
+	}
+	return in, nil
+}
+
+// Read fills the buffer with the next samples in the file.
+// The last buffer holds fewer samples when the file ends part way through it.
+func (in *fileInput) Read() (int, error) {
+	n, err := io.ReadFull(in.f, in.bytes)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	n /= in.width
+	switch b := in.buf.(type) {
+	case []int16:
+		for i := 0; i < n; i++ {
+			b[i] = int16(in.order.Uint16(in.bytes[2*i:]))
+		}
+	case []int32:
+		if in.width == 3 {
+			for i := 0; i < n; i++ {
+				s := in.bytes[3*i : 3*i+3]
+				if in.order == binary.BigEndian {
+					b[i] = int32(uint32(s[0])<<24 | uint32(s[1])<<16 | uint32(s[2])<<8)
+				} else {
+					b[i] = int32(uint32(s[2])<<24 | uint32(s[1])<<16 | uint32(s[0])<<8)
+				}
+			}
+			break
+		}
+		for i := 0; i < n; i++ {
+			b[i] = int32(in.order.Uint32(in.bytes[4*i:]))
+		}
+	case []float32:
+		for i := 0; i < n; i++ {
+			b[i] = math.Float32frombits(in.order.Uint32(in.bytes[4*i:]))
+		}
+	}
+	return n, nil
+}
+
+// Available returns 0, the file is read as fast as it's encoded.
+func (in *fileInput) Available() (int, error) { return 0, nil }
+
+// Restart does nothing, a file has no stream to restart.
+func (in *fileInput) Restart() error { return nil }
+
+// Close closes the file.
+func (in *fileInput) Close() error { return in.f.Close() }
+
+// truncateBuffer returns the first n samples of an []int16, []int32 or []float32 capture buffer.
+func truncateBuffer(buf interface{}, n int) interface{} {
+	switch b := buf.(type) {
+	case []int16:
+		return b[:n]
+	case []int32:
+		return b[:n]
+	case []float32:
+		return b[:n]
+	}
+	return buf
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// stopKeyEnter is the --stop-key that reads lines from stdin, stopping on any that isn't a command.
+const stopKeyEnter = "enter"
+
+// The keys that control a recording when single keys are read from a terminal.
+const (
+	keyPause  = 'p'
+	keyMute   = 'm'
+	keyMarker = 'c'
+)
+
+// stopKeyUsage is the help of the --stop-key flag.
+const stopKeyUsage = "Key that stops the recording: enter, a single character like q, or ctrl- and a letter like ctrl-d. " +
+	"Any other key reads single keys from the terminal, so p, m and c act as soon as they're pressed and markers can't be named. " +
+	"The terminal is put back the way it was when the recording stops, but a recording that's killed can leave it not echoing what's typed, which stty sane fixes. " +
+	"When stdin isn't a terminal, lines are read like with enter."
+
+// parseStopKey returns the byte a terminal sends for key, or 0 for stopKeyEnter.
+func parseStopKey(key string) (byte, error) {
+	if key == stopKeyEnter {
+		return 0, nil
+	}
+
+	if letter := strings.TrimPrefix(strings.ToLower(key), "ctrl-"); letter != strings.ToLower(key) {
+		if len(letter) != 1 || letter[0] < 'a' || letter[0] > 'z' {
+			return 0, fmt.Errorf("invalid stop key %q : ctrl- must be followed by a letter", key)
+		}
+
+		// ctrl-c, ctrl-z and ctrl-\ send signals, ctrl-s and ctrl-q pause and resume
+		// the terminal, and ctrl-j and ctrl-m are enter.
+		switch letter[0] {
+		case 'c', 'z', 's', 'q', 'j', 'm':
+			return 0, fmt.Errorf("invalid stop key %q : the terminal uses it", key)
+		}
+		return letter[0] & 0x1f, nil
+	}
+
+	if len(key) != 1 || key[0] <= ' ' || key[0] > '~' {
+		return 0, fmt.Errorf("invalid stop key %q : must be %s, a single character or ctrl- and a letter", key, stopKeyEnter)
+	}
+
+	switch key[0] {
+	case keyPause, keyMute, keyMarker:
+		return 0, fmt.Errorf("invalid stop key %q : it already pauses, mutes or adds markers", key)
+	}
+	return key[0], nil
+}
+
+// keyName returns how a key parsed by parseStopKey is typed.
+func keyName(key byte) string {
+	switch {
+	case key == 0:
+		return stopKeyEnter
+	case key < ' ':
+		return "ctrl-" + string(rune(key|0x60))
+	default:
+		return string(rune(key))
+	}
+}
+
+// controls carry what's typed to stop, pause, mute and mark a recording.
+type controls struct {
+	done, pause, mute chan bool
+	markers           chan string
+}
+
+// newControls returns controls that nothing is typed to yet.
+func newControls() *controls {
+	return &controls{
+		done:    make(chan bool, 1),
+		pause:   make(chan bool, 1),
+		mute:    make(chan bool, 1),
+		markers: make(chan string, 1),
+	}
+}
+
+// readControls returns the controls of rec typed on stdin, which are read as
+// single keys when rec.stopKey is set and stdin is a terminal, or as lines
+// otherwise. The returned function puts the terminal back the way it was.
+func readControls(rec recording) (*controls, func()) {
+	c := newControls()
+	restore := func() {}
+
+	// a stop key other than enter reads single keys when stdin is a terminal.
+	stdin := os.Stdin
+	keys := rec.stopKey != 0 && isTerminal(stdin)
+	if keys {
+		reset, err := makeCbreak(int(stdin.Fd()))
+		if err != nil {
+			log.Info("failed to read single keys from the terminal, reading lines instead : %v", err)
+			keys = false
+		} else {
+			restore = func() {
+				if err := reset(); err != nil {
+					log.Error("failed to restore the terminal : %v", err)
+				}
+			}
+		}
+	}
+
+	if keys {
+		go func() {
+			key := make([]byte, 1)
+			for {
+				if _, err := stdin.Read(key); err != nil {
+					return
+				}
+
+				switch key[0] {
+				case rec.stopKey:
+					c.done <- true
+				case keyPause:
+					c.pause <- true
+				case keyMute:
+					c.mute <- true
+				case keyMarker:
+					if rec.cue {
+						c.markers <- ""
+					}
+				}
+			}
+		}()
+
+		log.Info("press %s to stop recording, or p to pause and resume", keyName(rec.stopKey))
+		log.Info("press m to mute and unmute, which records silence in place of the input")
+		if rec.cue {
+			log.Info("press c to add a marker")
+		}
+		return c, restore
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(stdin)
+		for scanner.Scan() {
+			switch strings.TrimSpace(scanner.Text()) {
+			case "p":
+				c.pause <- true
+				continue
+			case "m":
+				c.mute <- true
+				continue
+			}
+			if name, ok := parseMarker(scanner.Text()); ok && rec.cue {
+				c.markers <- name
+				continue
+			}
+			c.done <- true
+		}
+	}()
+
+	log.Info("press enter to stop recording, or type p and press enter to pause and resume")
+	log.Info("type m and press enter to mute and unmute, which records silence in place of the input")
+	if rec.cue {
+		log.Info("type c and an optional name then press enter to add a marker")
+	}
+	return c, restore
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+)
+
+// channelLevels tracks the peak and RMS level of each channel of a recording.
+type channelLevels struct {
+	peaks  []float64
+	sums   []float64
+	frames int
+}
+
+// newChannelLevels returns channelLevels for frames of channels samples.
+func newChannelLevels(channels int) *channelLevels {
+	return &channelLevels{peaks: make([]float64, channels), sums: make([]float64, channels)}
+}
+
+// add measures buf, an []int16 or []int32 capture buffer of interleaved samples.
+func (c *channelLevels) add(buf interface{}) {
+	channels := len(c.peaks)
+	measure := func(i int, v float64) {
+		c.peaks[i%channels] = math.Max(c.peaks[i%channels], math.Abs(v))
+		c.sums[i%channels] += v * v
+	}
+
+	switch b := buf.(type) {
+	case []int16:
+		for i, v := range b {
+			measure(i, float64(v)/(1<<15))
+		}
+		c.frames += len(b) / channels
+	case []int32:
+		for i, v := range b {
+			measure(i, float64(v)/(1<<31))
+		}
+		c.frames += len(b) / channels
+	}
+}
+
+// peak returns the largest sample magnitude of channel as a fraction of full scale.
+func (c *channelLevels) peak(channel int) float64 { return c.peaks[channel] }
+
+// rms returns the RMS level of channel as a fraction of full scale.
+func (c *channelLevels) rms(channel int) float64 {
+	if c.frames == 0 {
+		return 0
+	}
+	return math.Sqrt(c.sums[channel] / float64(c.frames))
+}
+
+// summary returns a line describing the levels of each channel, numbered from 1.
+func (c *channelLevels) summary() []string {
+	lines := make([]string, len(c.peaks))
+	for i := range c.peaks {
+		if c.peak(i) == 0 {
+			lines[i] = fmt.Sprintf("channel %d : silent, check that its input is connected", i+1)
+			continue
+		}
+		lines[i] = fmt.Sprintf("channel %d : peak %.1f dBFS, rms %.1f dBFS", i+1, dbfs(c.peak(i)), dbfs(c.rms(i)))
+	}
+	return lines
+}
+
+// dbfs converts a level as a fraction of full scale to decibels relative to full scale.
+func dbfs(level float64) float64 { return 20 * math.Log10(level) }
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"math"
+	"testing"
+)
+
+// TestChannelLevels checks the peak and RMS level measured for each channel
+// of buffers whose channels differ: a square wave at half scale, a single
+// full scale negative sample and silence.
+func TestChannelLevels(t *testing.T) {
+	narrow := [][]int16{
+		{16384, 0, 0, -16384, 0, 0},
+		{16384, -32768, 0, -16384, 0, 0},
+	}
+
+	wide := make([][]int32, len(narrow))
+	for i, buf := range narrow {
+		for _, v := range buf {
+			wide[i] = append(wide[i], int32(v)<<16)
+		}
+	}
+
+	for name, bufs := range map[string][]interface{}{
+		"int16": {narrow[0], narrow[1]},
+		"int32": {wide[0], wide[1]},
+	} {
+		t.Run(name, func(t *testing.T) {
+			l := newChannelLevels(3)
+			for _, buf := range bufs {
+				l.add(buf)
+			}
+
+			for _, want := range []struct {
+				channel   int
+				peak, rms float64
+			}{
+				{0, 0.5, 0.5},
+				{1, 1, 0.5},
+				{2, 0, 0},
+			} {
+				if got := l.peak(want.channel); got != want.peak {
+					t.Errorf("channel %d peaks at %v, want %v", want.channel, got, want.peak)
+				}
+				if got := l.rms(want.channel); math.Abs(got-want.rms) > 1e-9 {
+					t.Errorf("channel %d has an rms of %v, want %v", want.channel, got, want.rms)
+				}
+			}
+
+			lines := l.summary()
+			for i, want := range []string{
+				"channel 1 : peak -6.0 dBFS, rms -6.0 dBFS",
+				"channel 2 : peak 0.0 dBFS, rms -6.0 dBFS",
+				"channel 3 : silent, check that its input is connected",
+			} {
+				if lines[i] != want {
+					t.Errorf("summary line %d is %q, want %q", i, lines[i], want)
+				}
+			}
+		})
+	}
+}
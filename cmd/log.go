@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"go.coder.com/flog"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// logger receives the progress and errors of a recording.
+// *flog.Logger is the human readable implementation.
+type logger interface {
+	Info(msg string, args ...interface{})
+	Success(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// log is the logger used while recording.
+var log logger = flog.New()
+
+// newLogger returns a logger that writes format to w.
+func newLogger(format string, w io.Writer) logger {
+	if format == logFormatJSON {
+		return jsonLogger{w: w}
+	}
+
+	l := flog.New()
+	l.W = w
+	return l
+}
+
+// quietLogger drops everything but errors before they reach the logger it wraps.
+type quietLogger struct{ logger }
+
+// Info discards an informational message.
+func (quietLogger) Info(msg string, args ...interface{}) {}
+
+// Success discards a success message.
+func (quietLogger) Success(msg string, args ...interface{}) {}
+
+// jsonLogger writes each message as a line of JSON.
+type jsonLogger struct{ w io.Writer }
+
+// logEntry is a single line written by jsonLogger.
+type logEntry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"msg"`
+	// Summary is set on the line logged when a recording stops.
+	Summary *summary `json:"summary,omitempty"`
+}
+
+// Info logs an informational message.
+func (l jsonLogger) Info(msg string, args ...interface{}) { l.log("info", msg, args...) }
+
+// Success logs that an operation succeeded.
+func (l jsonLogger) Success(msg string, args ...interface{}) { l.log("success", msg, args...) }
+
+// Error logs that an operation failed.
+func (l jsonLogger) Error(msg string, args ...interface{}) { l.log("error", msg, args...) }
+
+func (l jsonLogger) log(level, msg string, args ...interface{}) {
+	l.writeEntry(logEntry{
+		Time:    time.Now(),
+		Level:   level,
+		Message: fmt.Sprintf(msg, args...),
+	})
+}
+
+// writeEntry writes e as a line of JSON.
+func (l jsonLogger) writeEntry(e logEntry) {
+	// there's nowhere left to report a failure to write a log.
+	_ = json.NewEncoder(l.w).Encode(e)
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// metadata is the text a recording is tagged with.
+type metadata struct {
+	title   string
+	author  string
+	comment string
+	// checksum is the SHA-256 of the sample data, which aiff holds in an
+	// ANNO chunk of its own after the comment.
+	checksum string
+}
+
+// empty reports whether m has no text to write.
+func (m metadata) empty() bool { return m == metadata{} }
+
+// metadataChunk is a text chunk and the metadata field it holds.
+type metadataChunk struct {
+	aiff, wav string
+	field     func(m *metadata) *string
+}
+
+// metadataChunks lists the ids of each metadata field in the order they're written.
+var metadataChunks = []metadataChunk{
+	{aiff: "NAME", wav: "INAM", field: func(m *metadata) *string { return &m.title }},
+	{aiff: "AUTH", wav: "IART", field: func(m *metadata) *string { return &m.author }},
+	{aiff: "ANNO", wav: "ICMT", field: func(m *metadata) *string { return &m.comment }},
+}
+
+// encodeMetadata returns the chunks holding m for format. AIFF gets a NAME,
+// AUTH and ANNO chunk for each field that's set, WAV a LIST chunk of INFO
+// subchunks. Only AIFF holds the checksum, in a second ANNO chunk. The
+// chunks follow the sample data, so the header's layout and the offsets of
+// its size fields don't depend on them.
+func encodeMetadata(format string, m metadata) []byte {
+	var chunks bytes.Buffer
+	order := binary.ByteOrder(binary.BigEndian)
+	if format == formatWAV {
+		order = binary.LittleEndian
+	}
+
+	for _, c := range metadataChunks {
+		text := *c.field(&m)
+		if text == "" {
+			continue
+		}
+
+		id := c.aiff
+		if format == formatWAV {
+			// INFO text is read as a C string.
+			id, text = c.wav, text+"\x00"
+		}
+		writeTextChunk(&chunks, order, id, text)
+	}
+
+	if m.checksum != "" && format == formatAIFF {
+		writeTextChunk(&chunks, order, "ANNO", checksumPrefix+m.checksum)
+	}
+
+	if format != formatWAV || chunks.Len() == 0 {
+		return chunks.Bytes()
+	}
+
+	var list bytes.Buffer
+	list.WriteString("LIST")
+	binary.Write(&list, order, uint32(4+chunks.Len()))
+	list.WriteString("INFO")
+	list.Write(chunks.Bytes())
+	return list.Bytes()
+}
+
+// writeTextChunk writes a chunk holding text, padded to an even length.
+func writeTextChunk(w *bytes.Buffer, order binary.ByteOrder, id, text string) {
+	w.WriteString(id)
+	binary.Write(w, order, uint32(len(text)))
+	w.WriteString(text)
+	if len(text)%2 == 1 {
+		w.WriteByte(0)
+	}
+}
+
+// readMetadata reads the text chunks of the recording af was parsed from.
+// Chunks that aren't metadata are skipped.
+func readMetadata(r io.ReadSeeker, af audioFile) (metadata, error) {
+	var m metadata
+	order := af.order()
+	end := af.formSize + 8
+
+	// walk reads the chunks between pos and end, descending into LIST chunks.
+	var walk func(pos, end int64) error
+	walk = func(pos, end int64) error {
+		for pos+8 <= end {
+			if _, err := r.Seek(pos, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to seek to chunk : %v", err)
+			}
+
+			var chunk struct {
+				ID   [4]byte
+				Size uint32
+			}
+			err := binary.Read(r, order, &chunk)
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				// the sizes of a recording that was cut short can run past its end.
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read chunk header : %v", err)
+			}
+			id, body := string(chunk.ID[:]), pos+8
+
+			if id == "LIST" && chunk.Size >= 4 {
+				var listType [4]byte
+				if _, err := io.ReadFull(r, listType[:]); err != nil {
+					return fmt.Errorf("failed to read list type : %v", err)
+				}
+				if string(listType[:]) == "INFO" {
+					if err := walk(body+4, body+int64(chunk.Size)); err != nil {
+						return err
+					}
+				}
+			}
+
+			for _, c := range metadataChunks {
+				if id != c.aiff && id != c.wav {
+					continue
+				}
+
+				text := make([]byte, chunk.Size)
+				if _, err := io.ReadFull(r, text); err != nil {
+					return fmt.Errorf("failed to read %s chunk : %v", id, err)
+				}
+				s := strings.TrimRight(string(text), "\x00")
+				if id == "ANNO" && strings.HasPrefix(s, checksumPrefix) {
+					m.checksum = strings.TrimPrefix(s, checksumPrefix)
+					continue
+				}
+				*c.field(&m) = s
+			}
+
+			// chunks are padded to an even length.
+			pos = body + int64(chunk.Size) + int64(chunk.Size&1)
+		}
+		return nil
+	}
+
+	return m, walk(12, end)
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// TestRecordMetadata checks the text chunks a recording's tagged with
+// after its sample data, that the FORM or RIFF size covers them and that
+// they read back as the text they were written from.
+func TestRecordMetadata(t *testing.T) {
+	meta := metadata{title: "Take 1", author: "Ada", comment: "room mic, second take"}
+
+	tests := []struct {
+		format string
+		order  binary.ByteOrder
+		// chunks are the ids and text expected after the sample data, in order.
+		chunks [][2]string
+	}{
+		{formatAIFF, binary.BigEndian, [][2]string{{"NAME", "Take 1"}, {"AUTH", "Ada"}, {"ANNO", "room mic, second take"}}},
+		// INFO text is NUL terminated.
+		{formatWAV, binary.LittleEndian, [][2]string{{"INAM", "Take 1\x00"}, {"IART", "Ada\x00"}, {"ICMT", "room mic, second take\x00"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			rec := recording{
+				format:    tt.format,
+				order:     tt.order,
+				pcmFormat: pcmFormat{sampleRate: 8000, channels: 2, bitDepth: 16},
+				buffer:    64,
+				maxFrames: 320,
+				gain:      1,
+				meta:      meta,
+				dev:       &fakeCaptureDevice{},
+			}
+
+			f := &memoryFile{}
+			if _, err := record(f, rec); err != nil {
+				t.Fatal(err)
+			}
+			checkFinalized(t, f, rec, 320)
+
+			b := f.Bytes()
+			if size := int(tt.order.Uint32(b[4:])); size != len(b)-8 {
+				t.Errorf("%s size is %d, want %d", b[:4], size, len(b)-8)
+			}
+
+			chunks := b[headerSize(tt.format, rec.pcmFormat)+320*4:]
+			if tt.format == formatWAV {
+				if id, size := string(chunks[:4]), int(tt.order.Uint32(chunks[4:])); id != "LIST" || size != len(chunks)-8 {
+					t.Fatalf("metadata starts with a %q chunk of %d bytes, want a LIST chunk of %d", id, size, len(chunks)-8)
+				}
+				if listType := string(chunks[8:12]); listType != "INFO" {
+					t.Fatalf("list type is %q, want INFO", listType)
+				}
+				chunks = chunks[12:]
+			}
+
+			for _, want := range tt.chunks {
+				if len(chunks) < 8 {
+					t.Fatalf("metadata ends before the %s chunk", want[0])
+				}
+				id, size := string(chunks[:4]), int(tt.order.Uint32(chunks[4:]))
+				if text := string(chunks[8 : 8+size]); id != want[0] || text != want[1] {
+					t.Errorf("chunk %s holds %q, want %s holding %q", id, text, want[0], want[1])
+				}
+				chunks = chunks[8+size+size%2:]
+			}
+			if len(chunks) > 0 {
+				t.Errorf("%d bytes follow the metadata chunks", len(chunks))
+			}
+
+			if _, err := f.Seek(0, 0); err != nil {
+				t.Fatal(err)
+			}
+			af, err := readHeader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := readMetadata(f, af)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != meta {
+				t.Errorf("metadata reads back as %+v, want %+v", got, meta)
+			}
+		})
+	}
+}
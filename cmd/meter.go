@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// meterWidth is the number of characters in a full scale level bar.
+const meterWidth = 40
+
+// meter renders the level of each captured buffer as a bar, followed
+// by a status, on a line that is redrawn in place on a terminal.
+// A nil meter renders nothing.
+type meter struct {
+	w io.Writer
+	// bar draws the level bar, which is left out when only the status is shown.
+	bar    bool
+	status string
+
+	// drawn is the line last drawn, or empty once it's cleared.
+	drawn string
+}
+
+// render redraws the line for a level between 0 and 1.
+func (m *meter) render(level float64) {
+	if m == nil {
+		return
+	}
+
+	var line string
+	if m.bar {
+		n := int(math.Min(level, 1)*meterWidth + 0.5)
+		line = fmt.Sprintf("[%s%s] %3.0f%%", strings.Repeat("#", n), strings.Repeat(" ", meterWidth-n), level*100)
+	}
+	if m.status != "" {
+		line = strings.TrimPrefix(line+"  "+m.status, "  ")
+	}
+
+	// without a bar the line only changes with the status.
+	if !m.bar && line == m.drawn {
+		return
+	}
+
+	// a shorter line leaves the end of the last one behind unless it's padded.
+	pad := len(m.drawn) - len(line)
+	if pad < 0 {
+		pad = 0
+	}
+	fmt.Fprintf(m.w, "\r%s%s", line, strings.Repeat(" ", pad))
+	m.drawn = line
+}
+
+// clear erases the line so that other output isn't written over it.
+func (m *meter) clear() {
+	if m == nil || m.drawn == "" {
+		return
+	}
+
+	fmt.Fprintf(m.w, "\r%s\r", strings.Repeat(" ", len(m.drawn)))
+	m.drawn = ""
+}
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// peakLevel returns the largest sample magnitude in buf, an []int16,
+// []int32 or []float32 capture buffer, as a fraction of full scale.
+func peakLevel(buf interface{}) float64 {
+	var peak float64
+	switch b := buf.(type) {
+	case []int16:
+		for _, v := range b {
+			peak = math.Max(peak, math.Abs(float64(v))/(1<<15))
+		}
+	case []int32:
+		for _, v := range b {
+			peak = math.Max(peak, math.Abs(float64(v))/(1<<31))
+		}
+	case []float32:
+		for _, v := range b {
+			peak = math.Max(peak, math.Abs(float64(v)))
+		}
+	}
+	return peak
+}
+
+// isZero reports whether every sample in buf, an []int16, []int32 or
+// []float32 capture buffer, is exactly zero. Even the quietest noise of
+// a live input has some samples that aren't.
+func isZero(buf interface{}) bool {
+	switch b := buf.(type) {
+	case []int16:
+		for _, v := range b {
+			if v != 0 {
+				return false
+			}
+		}
+	case []int32:
+		for _, v := range b {
+			if v != 0 {
+				return false
+			}
+		}
+	case []float32:
+		for _, v := range b {
+			if v != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
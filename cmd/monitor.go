@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// monitorBuffers is the number of captured buffers queued for playback
+// before the monitor is considered behind and buffers are dropped.
+const monitorBuffers = 4
+
+// monitor plays captured buffers through the default output device.
+// Playback runs in its own goroutine so that a slow or underflowing
+// output never holds up the recording.
+type monitor struct {
+	stream  *portaudio.Stream
+	out     interface{}
+	buffers chan []int32
+	done    chan struct{}
+	dropped int
+}
+
+// openMonitor starts an output stream for pf that plays buffers of framesPerBuffer frames.
+func openMonitor(pf pcmFormat, framesPerBuffer int) (*monitor, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return nil, fmt.Errorf("failed to initialize portaudio : %v", err)
+	}
+
+	var out interface{} = make([]int32, framesPerBuffer*pf.channels)
+	if pf.bitDepth == 16 {
+		out = make([]int16, framesPerBuffer*pf.channels)
+	}
+
+	stream, err := portaudio.OpenDefaultStream(0, pf.channels, float64(pf.sampleRate), framesPerBuffer, out)
+	if err != nil {
+		portaudio.Terminate()
+		return nil, fmt.Errorf("failed to open monitor stream : %v", err)
+	}
+
+	if err := stream.Start(); err != nil {
+		stream.Close()
+		portaudio.Terminate()
+		return nil, fmt.Errorf("failed to start monitor stream : %v", err)
+	}
+
+	log.Success("successfully started monitoring on the default output device")
+
+	m := &monitor{
+		stream:  stream,
+		out:     out,
+		buffers: make(chan []int32, monitorBuffers),
+		done:    make(chan struct{}),
+	}
+	go m.run()
+	return m, nil
+}
+
+// play queues a copy of samples for playback, or drops it if the output is behind.
+func (m *monitor) play(samples []int32) {
+	if m == nil {
+		return
+	}
+
+	select {
+	case m.buffers <- append([]int32(nil), samples...):
+	default:
+		m.dropped++
+	}
+}
+
+// run writes queued buffers to the output until the monitor is closed.
+func (m *monitor) run() {
+	defer close(m.done)
+
+	var failed bool
+	for samples := range m.buffers {
+		switch out := m.out.(type) {
+		case []int16:
+			for i := range out {
+				out[i] = 0
+				if i < len(samples) {
+					out[i] = int16(samples[i])
+				}
+			}
+		case []int32:
+			n := copy(out, samples)
+			for i := n; i < len(out); i++ {
+				out[i] = 0
+			}
+		}
+
+		if err := m.stream.Write(); err != nil && err != portaudio.OutputUnderflowed && !failed {
+			log.Error("failed to write to monitor stream : %v", err)
+			failed = true
+		}
+	}
+}
+
+// Close waits for queued buffers to play, then stops the output.
+func (m *monitor) Close() error {
+	if m == nil {
+		return nil
+	}
+
+	close(m.buffers)
+	<-m.done
+
+	if m.dropped > 0 {
+		log.Info("the monitor fell behind and skipped %d buffers", m.dropped)
+	}
+
+	if err := m.stream.Stop(); err != nil {
+		log.Error("failed to stop monitor stream : %v", err)
+	}
+
+	if err := m.stream.Close(); err != nil {
+		log.Error("failed to close monitor stream : %v", err)
+	}
+	return portaudio.Terminate()
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultNameTemplate names recordings after the local time they started.
+const defaultNameTemplate = "recording-{time}"
+
+// nameTimeLayout formats the {time} token without colons,
+// which aren't allowed in file names on every system.
+const nameTimeLayout = "2006-01-02T15-04-05"
+
+// expandName replaces the {time} and {unix} tokens in template with t.
+func expandName(template string, t time.Time) string {
+	return strings.NewReplacer(
+		"{time}", t.Format(nameTimeLayout),
+		"{unix}", strconv.FormatInt(t.Unix(), 10),
+	).Replace(template)
+}
+
+// splitFormatExt returns name without its extension and the output format
+// that extension belongs to. Names without the extension of a registered
+// format are returned unchanged with an empty format.
+func splitFormatExt(name string) (string, string) {
+	ext := filepath.Ext(name)
+	for _, ef := range encoders {
+		if strings.EqualFold(ext, "."+ef.ext) {
+			return strings.TrimSuffix(name, ext), ef.name
+		}
+	}
+	return name, ""
+}
+
+const (
+	dateSubdirDay   = "day"
+	dateSubdirMonth = "month"
+)
+
+// dateSubdir returns the subdirectory a recording started at t is filed
+// under for granularity, like 2024/01/15 for a day or 2024/01 for a month.
+func dateSubdir(granularity string, t time.Time) (string, error) {
+	switch granularity {
+	case dateSubdirDay:
+		return filepath.FromSlash(t.Format("2006/01/02")), nil
+	case dateSubdirMonth:
+		return filepath.FromSlash(t.Format("2006/01")), nil
+	default:
+		return "", fmt.Errorf("unsupported date subdirectory granularity %q : must be %s or %s", granularity, dateSubdirDay, dateSubdirMonth)
+	}
+}
+
+// prepareDir checks that recordings can be written to dir,
+// creating it first if it doesn't exist and mkdir is set.
+func prepareDir(dir string, mkdir bool) error {
+	fi, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		if !mkdir {
+			return fmt.Errorf("output directory %s doesn't exist : create it or pass --mkdir", dir)
+		}
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory %s : %v", dir, err)
+		}
+
+		log.Success("successfully created %s", dir)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat output directory %s : %v", dir, err)
+	}
+
+	if !fi.IsDir() {
+		return fmt.Errorf("output directory %s isn't a directory", dir)
+	}
+
+	// creating a file is the only check of writability that works on every platform.
+	probe, err := ioutil.TempFile(dir, ".audio-recorder-")
+	if err != nil {
+		return fmt.Errorf("output directory %s isn't writable : %v", dir, err)
+	}
+	probe.Close()
+	if err := os.Remove(probe.Name()); err != nil {
+		return fmt.Errorf("failed to remove %s : %v", probe.Name(), err)
+	}
+	return nil
+}
+
+// createOutput creates name for a new recording. An existing file
+// is only truncated when force is set, otherwise os.IsExist reports
+// the returned error.
+func createOutput(name string, force bool) (*os.File, error) {
+	if force {
+		return os.Create(name)
+	}
+	return os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+}
+
+// clobberError explains that name wasn't overwritten.
+func clobberError(name string) error {
+	return fmt.Errorf("%s already exists : pass --force to overwrite it", name)
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/fuskovic/audio-recorder/internal/dsp"
+)
+
+// normalizeFrames is the number of frames read at a time while normalizing.
+const normalizeFrames = 4096
+
+// normalize scales the numSamples samples starting at dataOffset in place so
+// that their peak reaches target dBFS. The samples keep their size, so the
+// header doesn't change. It returns the gain applied, which is 0 when the
+// recording is silent and is left untouched.
+func normalize(rws io.ReadWriteSeeker, dataOffset int64, pf pcmFormat, order binary.ByteOrder, numSamples int, target float64) (float64, error) {
+	var peak float64
+	err := scanSamples(rws, dataOffset, pf, order, numSamples, func(samples []int32) {
+		for _, v := range samples {
+			peak = math.Max(peak, math.Abs(float64(v)))
+		}
+	})
+	if err != nil || peak == 0 {
+		return 0, err
+	}
+
+	gain := math.Pow(10, target/20) * (1 << 31) / peak
+	return gain, scaleSamples(rws, dataOffset, pf, order, numSamples, gain)
+}
+
+// normalizeLoudness scales the numSamples samples starting at dataOffset in
+// place so that their integrated loudness reaches target LUFS, as measured
+// by EBU R128, without raising their peak above 0 dBFS. It returns the gain
+// applied and the loudness before it, and a gain of 0 when the recording is
+// too quiet to measure and is left untouched.
+func normalizeLoudness(rws io.ReadWriteSeeker, dataOffset int64, pf pcmFormat, order binary.ByteOrder, numSamples int, target float64) (gain, loudness float64, err error) {
+	var peak float64
+	meter := dsp.NewLoudnessMeter(pf.sampleRate, pf.channels, 1<<31)
+	err = scanSamples(rws, dataOffset, pf, order, numSamples, func(samples []int32) {
+		meter.Process(samples)
+		for _, v := range samples {
+			peak = math.Max(peak, math.Abs(float64(v)))
+		}
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	loudness = meter.Integrated()
+	if math.IsInf(loudness, -1) {
+		return 0, loudness, nil
+	}
+
+	gain = math.Min(math.Pow(10, (target-loudness)/20), (1<<31)/peak)
+	return gain, loudness, scaleSamples(rws, dataOffset, pf, order, numSamples, gain)
+}
+
+// scanSamples passes the numSamples samples starting at dataOffset to fn, a buffer at a time.
+func scanSamples(rs io.ReadSeeker, dataOffset int64, pf pcmFormat, order binary.ByteOrder, numSamples int, fn func([]int32)) error {
+	if _, err := rs.Seek(dataOffset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to sample data : %v", err)
+	}
+
+	buf := make([]int32, normalizeFrames*pf.channels)
+	r := io.LimitReader(rs, int64(numSamples*pf.bytesPerSample()))
+	for {
+		n, err := readSamples(r, order, pf, buf)
+		fn(buf[:n])
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read samples : %v", err)
+		}
+	}
+}
+
+// scaleSamples multiplies the numSamples samples starting at dataOffset by gain in place.
+func scaleSamples(rws io.ReadWriteSeeker, dataOffset int64, pf pcmFormat, order binary.ByteOrder, numSamples int, gain float64) error {
+	buf := make([]int32, normalizeFrames*pf.channels)
+	width := pf.bytesPerSample()
+	raw := make([]byte, len(buf)*width)
+
+	for pos, end := dataOffset, dataOffset+int64(numSamples*width); pos < end; {
+		size := int64(len(raw))
+		if end-pos < size {
+			size = end - pos
+		}
+		chunk := raw[:size]
+
+		if _, err := rws.Seek(pos, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek to samples : %v", err)
+		}
+		if _, err := io.ReadFull(rws, chunk); err != nil {
+			return fmt.Errorf("failed to read samples : %v", err)
+		}
+
+		n, _ := readSamples(bytes.NewReader(chunk), order, pf, buf)
+		for i, v := range buf[:n] {
+			putScaled(chunk[i*width:], order, pf, float64(v)*gain)
+		}
+
+		if _, err := rws.Seek(pos, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek to samples : %v", err)
+		}
+		if _, err := rws.Write(chunk); err != nil {
+			return fmt.Errorf("failed to write samples : %v", err)
+		}
+		pos += size
+	}
+	return nil
+}
+
+// putScaled encodes v, a sample scaled to the int32 range, into b at the
+// bit depth and sample type of pf, clamping it to the limits of the type.
+func putScaled(b []byte, order binary.ByteOrder, pf pcmFormat, v float64) {
+	clamp := func(v, min, max float64) float64 { return math.Max(min, math.Min(max, math.Round(v))) }
+
+	switch {
+	case pf.float:
+		order.PutUint32(b, math.Float32bits(float32(v/(1<<31))))
+	case pf.bitDepth == 16:
+		order.PutUint16(b, uint16(int16(clamp(v/(1<<16), math.MinInt16, math.MaxInt16))))
+	case pf.bitDepth == 24:
+		s := uint32(int32(clamp(v/(1<<8), -1<<23, 1<<23-1)))
+		if order == binary.BigEndian {
+			b[0], b[1], b[2] = byte(s>>16), byte(s>>8), byte(s)
+		} else {
+			b[0], b[1], b[2] = byte(s), byte(s>>8), byte(s>>16)
+		}
+	default:
+		order.PutUint32(b, uint32(int32(clamp(v, math.MinInt32, math.MaxInt32))))
+	}
+}
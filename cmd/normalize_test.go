@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/fuskovic/audio-recorder/internal/dsp"
+)
+
+// sineFile returns a file holding frames frames of 16 bit samples of a
+// 997 Hz sine that peaks at amplitude of full scale, in every channel of pf.
+func sineFile(pf pcmFormat, frames int, amplitude float64) *memoryFile {
+	samples := make([]int16, frames*pf.channels)
+	for i := range samples {
+		phase := 2 * math.Pi * 997 * float64(i/pf.channels) / float64(pf.sampleRate)
+		samples[i] = int16(math.Round(amplitude * math.MaxInt16 * math.Sin(phase)))
+	}
+
+	f := &memoryFile{}
+	binary.Write(f, binary.LittleEndian, samples)
+	return f
+}
+
+// loudnessOf measures the integrated loudness of the numSamples samples in f.
+func loudnessOf(t *testing.T, f *memoryFile, pf pcmFormat, numSamples int) float64 {
+	meter := dsp.NewLoudnessMeter(pf.sampleRate, pf.channels, 1<<31)
+	if err := scanSamples(f, 0, pf, binary.LittleEndian, numSamples, meter.Process); err != nil {
+		t.Fatal(err)
+	}
+	return meter.Integrated()
+}
+
+// TestNormalizeLoudness checks the loudness measured of sines of known
+// level, that the gain brings them to the target without clipping their
+// peak and that a silent recording is left as it is.
+func TestNormalizeLoudness(t *testing.T) {
+	pf := pcmFormat{sampleRate: 48000, channels: 1, bitDepth: 16}
+	frames := 2 * pf.sampleRate
+
+	// BS.1770 measures a full scale 997 Hz sine in one channel at -3.01 LUFS.
+	for _, tc := range []struct {
+		name      string
+		amplitude float64
+		target    float64
+	}{
+		{"raise", 0.1, -16},
+		{"lower", 0.5, -23},
+		// the 12 dB asked for would clip the peak, so it's held at full scale.
+		{"peak limited", 0.5, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := sineFile(pf, frames, tc.amplitude)
+			gain, loudness, err := normalizeLoudness(f, 0, pf, binary.LittleEndian, frames, tc.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := 20*math.Log10(tc.amplitude) - 3.01; math.Abs(loudness-want) > 0.1 {
+				t.Errorf("loudness = %.2f LUFS, want %.2f", loudness, want)
+			}
+
+			want := math.Min(math.Pow(10, (tc.target-loudness)/20), 1/tc.amplitude)
+			if math.Abs(gain-want) > 0.01*want {
+				t.Errorf("gain = %.3f, want %.3f", gain, want)
+			}
+
+			wantLoudness := math.Min(tc.target, -3.01)
+			if got := loudnessOf(t, f, pf, frames); math.Abs(got-wantLoudness) > 0.1 {
+				t.Errorf("loudness after normalizing = %.2f LUFS, want %.2f", got, wantLoudness)
+			}
+		})
+	}
+
+	t.Run("silent", func(t *testing.T) {
+		f := &memoryFile{}
+		binary.Write(f, binary.LittleEndian, make([]int16, frames))
+		before := append([]byte(nil), f.Bytes()...)
+
+		gain, loudness, err := normalizeLoudness(f, 0, pf, binary.LittleEndian, frames, -16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gain != 0 || !math.IsInf(loudness, -1) {
+			t.Errorf("gain, loudness = %v, %v, want 0, -Inf", gain, loudness)
+		}
+		if !bytes.Equal(f.Bytes(), before) {
+			t.Error("silent recording was changed")
+		}
+	})
+}
+
+// TestNormalize checks that a quiet recording is scaled so that its peak,
+// a negative sample here, reaches the target, and that a silent one is left
+// as it is.
+func TestNormalize(t *testing.T) {
+	pf := pcmFormat{sampleRate: 8000, channels: 1, bitDepth: 16}
+	samples := []int16{1000, -2000, 500, 0, 3}
+
+	for _, tc := range []struct {
+		name   string
+		target float64
+		gain   float64
+		want   []int16
+	}{
+		{"half scale", 20 * math.Log10(0.5), 8.192, []int16{8192, -16384, 4096, 0, 25}},
+		{"full scale", 0, 16.384, []int16{16384, -32768, 8192, 0, 49}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &memoryFile{}
+			binary.Write(f, binary.LittleEndian, samples)
+
+			gain, err := normalize(f, 0, pf, binary.LittleEndian, len(samples), tc.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(gain-tc.gain) > 1e-9 {
+				t.Errorf("gain = %v, want %v", gain, tc.gain)
+			}
+
+			got := make([]int16, len(samples))
+			if err := binary.Read(bytes.NewReader(f.Bytes()), binary.LittleEndian, got); err != nil {
+				t.Fatal(err)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("normalized samples are %v, want %v", got, tc.want)
+					break
+				}
+			}
+		})
+	}
+
+	t.Run("silent", func(t *testing.T) {
+		f := &memoryFile{}
+		binary.Write(f, binary.LittleEndian, make([]int16, 8))
+
+		gain, err := normalize(f, 0, pf, binary.LittleEndian, 8, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gain != 0 {
+			t.Errorf("gain = %v, want 0", gain)
+		}
+		if !bytes.Equal(f.Bytes(), make([]byte, 16)) {
+			t.Error("silent recording was changed")
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// outputBufferSize is the number of bytes buffered before they're written to the output file.
+const outputBufferSize = 64 * 1024
+
+// bufferedFile collects small writes to a file into larger ones, so that
+// every captured buffer doesn't cost a write syscall. It flushes before
+// anything that reads or moves within the file, so seeking back to fill
+// in the header sizes sees every sample written so far.
+type bufferedFile struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+// newBufferedFile returns a bufferedFile that writes to f.
+func newBufferedFile(f *os.File) *bufferedFile {
+	return &bufferedFile{f: f, w: bufio.NewWriterSize(f, outputBufferSize)}
+}
+
+// Write buffers p, writing the buffer to the file once it's full.
+func (b *bufferedFile) Write(p []byte) (int, error) { return b.w.Write(p) }
+
+// Read flushes the buffer and reads from the file.
+func (b *bufferedFile) Read(p []byte) (int, error) {
+	if err := b.w.Flush(); err != nil {
+		return 0, err
+	}
+	return b.f.Read(p)
+}
+
+// Seek flushes the buffer and sets the offset of the next read or write.
+func (b *bufferedFile) Seek(offset int64, whence int) (int64, error) {
+	if err := b.w.Flush(); err != nil {
+		return 0, err
+	}
+	return b.f.Seek(offset, whence)
+}
+
+// Truncate flushes the buffer and changes the size of the file.
+func (b *bufferedFile) Truncate(size int64) error {
+	if err := b.w.Flush(); err != nil {
+		return err
+	}
+	return b.f.Truncate(size)
+}
+
+// Flush writes the buffer to the file.
+func (b *bufferedFile) Flush() error { return b.w.Flush() }
+
+// Close flushes the buffer and closes the file.
+func (b *bufferedFile) Close() error {
+	err := b.w.Flush()
+	if cerr := b.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// memoryFile is an io.ReadWriteSeeker that holds a recording in memory,
+// so that its header sizes can be filled in before it's written somewhere
+// that can't seek.
+type memoryFile struct {
+	buf []byte
+	off int64
+}
+
+// Write writes p at the current offset, growing the buffer as needed.
+func (m *memoryFile) Write(p []byte) (int, error) {
+	if end := m.off + int64(len(p)); end > int64(len(m.buf)) {
+		if end > int64(cap(m.buf)) {
+			grown := make([]byte, len(m.buf), 2*end)
+			copy(grown, m.buf)
+			m.buf = grown
+		}
+
+		// a write past the end leaves a gap of zeros, like a file.
+		size := int64(len(m.buf))
+		m.buf = m.buf[:end]
+		for i := size; i < m.off; i++ {
+			m.buf[i] = 0
+		}
+	}
+
+	n := copy(m.buf[m.off:], p)
+	m.off += int64(n)
+	return n, nil
+}
+
+// Read reads from the current offset.
+func (m *memoryFile) Read(p []byte) (int, error) {
+	if m.off >= int64(len(m.buf)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, m.buf[m.off:])
+	m.off += int64(n)
+	return n, nil
+}
+
+// Seek sets the offset of the next read or write.
+func (m *memoryFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += m.off
+	case io.SeekEnd:
+		offset += int64(len(m.buf))
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	m.off = offset
+	return offset, nil
+}
+
+// Truncate changes the size of the buffer.
+func (m *memoryFile) Truncate(size int64) error {
+	if size < 0 || size > int64(len(m.buf)) {
+		return fmt.Errorf("invalid size %d : must be between 0 and %d", size, len(m.buf))
+	}
+	m.buf = m.buf[:size]
+	return nil
+}
+
+// Bytes returns the contents of the buffer.
+func (m *memoryFile) Bytes() []byte { return m.buf }
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// TestMemoryFile checks that a memoryFile behaves like a file for filling
+// in header sizes: writes after seeking back overwrite in place, writes past
+// the end leave zeros and it can be read back and truncated.
+func TestMemoryFile(t *testing.T) {
+	m := &memoryFile{}
+	write := func(s string) {
+		t.Helper()
+		if n, err := io.WriteString(m, s); err != nil || n != len(s) {
+			t.Fatalf("wrote %d of %d bytes : %v", n, len(s), err)
+		}
+	}
+	seek := func(offset int64, whence int) {
+		t.Helper()
+		if _, err := m.Seek(offset, whence); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("hdr:0000")
+	write("samples")
+	seek(4, io.SeekStart)
+	write("0015")
+	if got := string(m.Bytes()); got != "hdr:0015samples" {
+		t.Errorf("buffer holds %q after filling in the size, want %q", got, "hdr:0015samples")
+	}
+
+	seek(2, io.SeekEnd)
+	write("!")
+	if got := string(m.Bytes()); got != "hdr:0015samples\x00\x00!" {
+		t.Errorf("buffer holds %q after writing past the end, want a gap of zeros", got)
+	}
+
+	seek(-3, io.SeekCurrent)
+	if b, err := ioutil.ReadAll(m); err != nil || string(b) != "\x00\x00!" {
+		t.Errorf("read %q : %v, want %q", b, err, "\x00\x00!")
+	}
+
+	if err := m.Truncate(15); err != nil || string(m.Bytes()) != "hdr:0015samples" {
+		t.Errorf("truncated to %q : %v", m.Bytes(), err)
+	}
+	if err := m.Truncate(16); err == nil {
+		t.Error("truncating past the end didn't fail")
+	}
+	if _, err := m.Seek(-1, io.SeekStart); err == nil {
+		t.Error("seeking before the start didn't fail")
+	}
+}
+
+// TestRecordMaxBytesInMemory records into a memoryFile, as a --max-bytes
+// recording to stdout is held, and checks that it's capped at the limit
+// with its header sizes filled in.
+func TestRecordMaxBytesInMemory(t *testing.T) {
+	for _, format := range []string{formatWAV, formatAIFF, formatRaw} {
+		t.Run(format, func(t *testing.T) {
+			order := binary.ByteOrder(binary.BigEndian)
+			if format == formatWAV {
+				order = binary.LittleEndian
+			}
+
+			rec := recording{
+				format:    format,
+				order:     order,
+				pcmFormat: pcmFormat{sampleRate: 8000, channels: 2, bitDepth: 16},
+				buffer:    64,
+				gain:      1,
+				dev:       &fakeCaptureDevice{},
+			}
+			rec.maxBytes = headerSize(format, rec.pcmFormat) + 300*4
+
+			m := &memoryFile{}
+			stats, err := record(m, rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.stopReason != stopSizeLimit {
+				t.Errorf("stopped by %q, want %q", stats.stopReason, stopSizeLimit)
+			}
+			if size := int64(len(m.Bytes())); size != rec.maxBytes {
+				t.Errorf("recording is %d bytes, want the limit of %d", size, rec.maxBytes)
+			}
+
+			if format != formatRaw {
+				checkFinalized(t, m, rec, 300)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gordonklaus/portaudio"
+	"github.com/spf13/pflag"
+	"go.coder.com/cli"
+	"go.coder.com/flog"
+)
+
+type playCmd struct{ inFile string }
+
+// Spec returns a command spec containing a description of it's usage.
+func (cmd *playCmd) Spec() cli.CommandSpec {
+	return cli.CommandSpec{
+		Name:  "play",
+		Usage: "[flags]",
+		Desc:  "Play back an AIFF or WAV recording.",
+	}
+}
+
+// RegisterFlags initializes how a flag set is processed for a particular command.
+func (cmd *playCmd) RegisterFlags(fl *pflag.FlagSet) {
+	fl.StringVarP(&cmd.inFile, "in", "i", cmd.inFile, "Name the input file.")
+}
+
+// Run plays the input file through the default output device.
+func (cmd *playCmd) Run(fl *pflag.FlagSet) {
+	if cmd.inFile == "" {
+		flog.Error("no input file provided")
+		fl.Usage()
+		return
+	}
+
+	f, err := os.Open(cmd.inFile)
+	if err != nil {
+		flog.Error("failed to open %s : %v", cmd.inFile, err)
+		fl.Usage()
+		return
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			flog.Error("failed to close %s : %v", cmd.inFile, err)
+		}
+	}()
+
+	af, err := readHeader(f)
+	if err != nil {
+		flog.Error("failed to read header of %s : %v", cmd.inFile, err)
+		return
+	}
+
+	flog.Info("%s is %s at %d Hz, %d channels, %d bits", cmd.inFile, af.format, af.sampleRate, af.channels, af.bitDepth)
+
+	if err := portaudio.Initialize(); err != nil {
+		flog.Error("failed to initialize portaudio : %v", err)
+		return
+	}
+
+	defer func() {
+		if err := portaudio.Terminate(); err != nil {
+			flog.Error("failed to terminate portaudio : %v", err)
+		}
+	}()
+
+	const framesPerBuffer = 1024
+	out := make([]int32, framesPerBuffer*af.channels)
+
+	stream, err := portaudio.OpenDefaultStream(0, af.channels, float64(af.sampleRate), framesPerBuffer, out)
+	if err != nil {
+		flog.Error("failed to open audio stream : %v", err)
+		return
+	}
+
+	defer func() {
+		if err := stream.Close(); err != nil {
+			flog.Error("failed to close audio stream : %v", err)
+		}
+	}()
+
+	if err := stream.Start(); err != nil {
+		flog.Error("failed to start audio stream : %v", err)
+		return
+	}
+
+	// stopping a blocking stream waits for queued buffers to finish playing.
+	defer func() {
+		if err := stream.Stop(); err != nil {
+			flog.Error("failed to stop audio stream : %v", err)
+		}
+	}()
+
+	flog.Info("playing %s", cmd.inFile)
+
+	frames, err := play(io.LimitReader(f, af.dataSize), af, out, stream.Write)
+	if err != nil {
+		flog.Error("%v", err)
+		return
+	}
+
+	flog.Success("successfully played %d frames", frames)
+}
+
+// play decodes the samples in r into out one buffer at a time and calls write
+// after each, zero padding the final buffer. It returns the number of frames played.
+func play(r io.Reader, af audioFile, out []int32, write func() error) (int, error) {
+	var frames int
+	for {
+		n, err := readSamples(r, af.sampleOrder(), af.pcmFormat, out)
+		if n > 0 {
+			for i := n; i < len(out); i++ {
+				out[i] = 0
+			}
+
+			if err := write(); err == portaudio.OutputUnderflowed {
+				flog.Error("audio stream underflowed, playback may have gaps")
+			} else if err != nil {
+				return frames, fmt.Errorf("failed to write to audio stream : %v", err)
+			}
+			frames += af.frames(n)
+		}
+
+		if err == io.EOF {
+			return frames, nil
+		}
+		if err != nil {
+			return frames, fmt.Errorf("failed to read samples : %v", err)
+		}
+	}
+}
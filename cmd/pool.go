@@ -0,0 +1,87 @@
+package cmd
+
+import "sync"
+
+// orderedPool runs jobs on a fixed number of goroutines and passes their
+// results to sink one at a time, in the order the jobs were submitted,
+// so that work done in parallel still comes out deterministic.
+type orderedPool struct {
+	jobs  chan poolJob
+	order chan chan interface{}
+	sink  func(interface{}) error
+	done  chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// poolJob is a submitted job and where its result goes.
+type poolJob struct {
+	fn  func() interface{}
+	res chan interface{}
+}
+
+// newOrderedPool starts workers goroutines that run jobs and one that
+// passes their results to sink. Once sink fails it's no longer called.
+func newOrderedPool(workers int, sink func(interface{}) error) *orderedPool {
+	p := &orderedPool{
+		jobs: make(chan poolJob, workers),
+		// results are queued for up to twice as many jobs as there are workers,
+		// so that a slow job doesn't stall the others.
+		order: make(chan chan interface{}, 2*workers),
+		sink:  sink,
+		done:  make(chan struct{}),
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range p.jobs {
+				j.res <- j.fn()
+			}
+		}()
+	}
+
+	go func() {
+		defer close(p.done)
+		for res := range p.order {
+			v := <-res
+			if p.error() != nil {
+				continue
+			}
+			if err := p.sink(v); err != nil {
+				p.mu.Lock()
+				p.err = err
+				p.mu.Unlock()
+			}
+		}
+	}()
+	return p
+}
+
+// submit queues fn, blocking while the queue is full.
+// It returns the error sink failed with, if it has.
+func (p *orderedPool) submit(fn func() interface{}) error {
+	if err := p.error(); err != nil {
+		return err
+	}
+
+	res := make(chan interface{}, 1)
+	p.order <- res
+	p.jobs <- poolJob{fn: fn, res: res}
+	return nil
+}
+
+// close waits for every submitted job to be passed to sink, stops the
+// goroutines and returns the error sink failed with, if it has.
+func (p *orderedPool) close() error {
+	close(p.jobs)
+	close(p.order)
+	<-p.done
+	return p.error()
+}
+
+func (p *orderedPool) error() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
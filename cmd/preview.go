@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+const (
+	// previewRows is the number of rows drawn above and below the centre line of a preview.
+	previewRows = 4
+	// defaultPreviewWidth is used when the width of the terminal can't be found.
+	defaultPreviewWidth = 80
+)
+
+// printPreviewFile reads back the recording in name, made with rec,
+// and prints a preview of its waveform width columns wide to w.
+func printPreviewFile(w io.Writer, name string, rec recording, width int) error {
+	f, af, order, err := openRecording(name, rec)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return printPreview(w, f, order, af.pcmFormat, af.numFrames, width)
+}
+
+// printPreview reads numFrames frames of pf samples in order from r and
+// draws the loudest sample of each column's share of them as a bar.
+func printPreview(w io.Writer, r io.Reader, order binary.ByteOrder, pf pcmFormat, numFrames, width int) error {
+	if numFrames == 0 {
+		_, err := fmt.Fprintln(w, "(empty recording)")
+		return err
+	}
+
+	if numFrames < width {
+		width = numFrames
+	}
+	framesPerColumn := (numFrames + width - 1) / width
+
+	peaks := make([]float64, 0, width)
+	buf := make([]int32, framesPerColumn*pf.channels)
+	for len(peaks) < width {
+		n, err := readSamples(r, order, pf, buf)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+
+		var peak float64
+		for _, s := range buf[:n] {
+			peak = math.Max(peak, math.Abs(float64(s))/(1<<31))
+		}
+		peaks = append(peaks, peak)
+	}
+
+	var b strings.Builder
+	for row := previewRows; row >= -previewRows; row-- {
+		for _, peak := range peaks {
+			h := int(math.Round(peak * previewRows))
+			switch {
+			case row == 0 && h == 0:
+				b.WriteByte('-')
+			case h >= row && h >= -row:
+				b.WriteByte('#')
+			default:
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteByte('\n')
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
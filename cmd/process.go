@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"math"
+	"time"
+
+	"github.com/fuskovic/audio-recorder/internal/dsp"
+	"github.com/fuskovic/audio-recorder/internal/resample"
+)
+
+// processor runs every captured buffer through the processing chain of a
+// recording before it's written: gain, high-pass, noise gate, auto gain,
+// dither, muting, downmixing and resampling, in that order.
+type processor struct {
+	// channels is the number of captured channels.
+	channels int
+	gain     float64
+
+	// frames holds a buffer converted to int32, which is processed in place.
+	frames []int32
+
+	hp    *dsp.Biquad
+	gate  *dsp.Gate
+	agc   *dsp.AGC
+	quant *dsp.Quantizer
+
+	// mon, when set, plays what's captured before it's dithered or muted.
+	mon *monitor
+
+	// mixed, when set, holds the downmixed buffer.
+	mixed []int32
+
+	rs        *resample.Resampler
+	resampled []int32
+}
+
+// newProcessor returns the processor for buffers captured for rec in
+// frames, the int32 scratch the size of a captured buffer.
+func newProcessor(rec recording, frames []int32, mon *monitor) *processor {
+	captureFormat := rec.capturePCMFormat()
+	p := &processor{channels: captureFormat.channels, gain: rec.gain, frames: frames, mon: mon}
+
+	if rec.highpass > 0 {
+		p.hp = dsp.NewHighPass(rec.highpass, float64(captureFormat.sampleRate), captureFormat.channels)
+	}
+
+	fullScale := float64(1 << 31)
+	if captureFormat.bitDepth == 16 {
+		fullScale = 1 << 15
+	}
+
+	if rec.noiseGate > 0 {
+		p.gate = dsp.NewGate(rec.noiseGate, fullScale, captureFormat.sampleRate, captureFormat.channels, rec.gateAttack, rec.gateRelease)
+	}
+
+	if rec.autoGain {
+		target, maxGain := math.Pow(10, rec.autoGainTarget/20), math.Pow(10, rec.autoGainMax/20)
+		p.agc = dsp.NewAGC(target, maxGain, fullScale, captureFormat.sampleRate, captureFormat.channels, autoGainAttack, autoGainRelease)
+	}
+
+	if rec.captureBitDepth != 0 {
+		p.quant = dsp.NewQuantizer(uint(rec.captureBitDepth-rec.bitDepth), rec.dither, time.Now().UnixNano())
+	}
+
+	if rec.captureChannels != 0 {
+		p.mixed = make([]int32, rec.buffer)
+	}
+
+	if rec.captureRate != 0 {
+		p.rs = resample.New(rec.captureRate, rec.sampleRate, rec.channels)
+	}
+	return p
+}
+
+// process runs the n samples in buf, an []int16, []int32 or []float32
+// buffer as it was captured, through the chain, silencing them while muted
+// and counting the samples the gain clamped in clamped. It returns the
+// buffer the level and clip checks read, which holds the processed samples
+// at the captured bit depth, and the samples to write.
+func (p *processor) process(buf interface{}, n int, muted bool, clamped *int) (interface{}, []int32) {
+	// float samples are scaled to int32 as soon as they're
+	// captured, then scaled back by the encoder.
+	if f, ok := buf.([]float32); ok {
+		for i, v := range f {
+			p.frames[i] = floatToSample(v)
+		}
+		buf = p.frames[:n]
+	}
+
+	if p.gain != 1 {
+		*clamped += applyGain(buf, p.gain)
+	}
+
+	// encoders take every bit depth as int32.
+	narrow, isNarrow := buf.([]int16)
+	if isNarrow {
+		for i, s := range narrow {
+			p.frames[i] = int32(s)
+		}
+	}
+	frames := p.frames[:n]
+
+	if p.hp != nil {
+		if isNarrow {
+			p.hp.Process(frames, math.MinInt16, math.MaxInt16)
+		} else {
+			p.hp.Process(frames, math.MinInt32, math.MaxInt32)
+		}
+	}
+	if p.gate != nil {
+		p.gate.Process(frames)
+	}
+	// the gate runs first, so the gain holds through gated silence.
+	if p.agc != nil {
+		if isNarrow {
+			p.agc.Process(frames, math.MinInt16, math.MaxInt16)
+		} else {
+			p.agc.Process(frames, math.MinInt32, math.MaxInt32)
+		}
+	}
+
+	// the level and clip checks read buf, so it
+	// has to hold the processed samples too.
+	if isNarrow && (p.hp != nil || p.gate != nil || p.agc != nil) {
+		for i := range narrow {
+			narrow[i] = int16(frames[i])
+		}
+	}
+
+	// the monitor plays the input as it was captured, so
+	// it can still be heard when to unmute.
+	p.mon.play(frames)
+
+	if p.quant != nil {
+		p.quant.Process(frames)
+	}
+
+	if muted {
+		for i := range frames {
+			frames[i] = 0
+		}
+	}
+
+	out := frames
+	if p.mixed != nil {
+		out = downmix(p.mixed, out, p.channels)
+	}
+	if p.rs != nil {
+		p.resampled = p.rs.Resample(p.resampled[:0], out)
+		out = p.resampled
+	}
+	return buf, out
+}
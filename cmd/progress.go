@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+// progressInterval is how often --progress updates on a terminal.
+const progressInterval = time.Second
+
+// progressLogInterval is how often --progress logs a line when stderr
+// isn't a terminal, so that a log file doesn't fill up with them.
+const progressLogInterval = 10 * time.Second
+
+// progress shows how long a recording has been running and roughly how
+// large its output is, as the status of a meter on a terminal or as a log
+// line otherwise. A nil progress shows nothing.
+type progress struct {
+	// lvl, when set, shows the progress in place of logging it.
+	lvl     *meter
+	started time.Time
+	logged  time.Time
+}
+
+// update shows the progress of a recording whose output holds size bytes,
+// or an unknown number of bytes if size is negative.
+func (p *progress) update(size int64, paused bool) {
+	if p == nil {
+		return
+	}
+
+	now := time.Now()
+	status := formatElapsed(now.Sub(p.started))
+	if size >= 0 {
+		status += ", " + formatSize(size)
+	}
+	if paused {
+		status += ", paused"
+	}
+
+	if p.lvl != nil {
+		p.lvl.status = status
+		return
+	}
+
+	if now.Sub(p.logged) >= progressLogInterval {
+		p.logged = now
+		log.Info("recording for %s", status)
+	}
+}
+
+// formatElapsed formats d as hours, minutes and seconds like 1:02:03.
+func formatElapsed(d time.Duration) string {
+	s := int(d / time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+}
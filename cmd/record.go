@@ -1,15 +1,20 @@
 package cmd
 
 import (
-	"bufio"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/fuskovic/audio-recorder/internal/dsp"
 	"github.com/gordonklaus/portaudio"
 	"github.com/spf13/pflag"
 	"go.coder.com/cli"
@@ -18,7 +23,167 @@ import (
 
 var signals = []os.Signal{syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT}
 
-type recordCmd struct{ outFile string }
+const (
+	formatAIFF = "aiff"
+	formatWAV  = "wav"
+	formatRaw  = "raw"
+	formatFLAC = "flac"
+	formatOpus = "opus"
+	formatMP3  = "mp3"
+)
+
+const (
+	sampleFormatInt     = "int"
+	sampleFormatFloat32 = "float32"
+)
+
+// minBufferWarning is the buffer size in frames below which
+// recording warns that audio is likely to be dropped.
+const minBufferWarning = 64
+
+// verboseInterval is the least time between the buffers logged by --verbose.
+const verboseInterval = 500 * time.Millisecond
+
+// The attack and release of --auto-gain. The gain drops quickly when the
+// input gets louder, so it doesn't clip, and rises slowly when it gets
+// quieter, so that short pauses don't pump up the background.
+const (
+	autoGainAttack  = 200 * time.Millisecond
+	autoGainRelease = 2 * time.Second
+)
+
+// sizeField is a header field that can only be filled in after recording.
+type sizeField struct {
+	name   string
+	offset int64
+	value  int32
+}
+
+// pcmFormat describes the sample data that follows a file header.
+type pcmFormat struct {
+	sampleRate int
+	channels   int
+	bitDepth   int
+
+	// float samples are 32 bit IEEE floats in [-1, 1] instead of integers.
+	float bool
+	// sowt integer samples of an aiff are stored little endian, which
+	// AIFF-C marks with the sowt compression type.
+	sowt bool
+}
+
+// bytesPerSample returns the width of a single sample.
+func (pf pcmFormat) bytesPerSample() int { return pf.bitDepth / 8 }
+
+// frames returns the number of frames, one sample per channel,
+// in numSamples interleaved samples.
+func (pf pcmFormat) frames(numSamples int) int { return numSamples / pf.channels }
+
+// dataPad returns the pad byte that follows numSamples samples of sample
+// data when they have an odd length, as every AIFF and WAV chunk is padded
+// to an even length, or nothing.
+func (pf pcmFormat) dataPad(numSamples int) []byte {
+	if pf.bytesPerSample()*numSamples%2 == 1 {
+		return []byte{0}
+	}
+	return nil
+}
+
+type recordCmd struct {
+	outFile    string
+	dir        string
+	mkdir      bool
+	dateSubdir bool
+	dateGrain  string
+	force      bool
+	noClobber  bool
+	nameTmpl   string
+	title      string
+	author     string
+	comment    string
+	format     string
+	aifc       bool
+	sampleRate int
+	resample   int
+	channels   int
+	channelMap string
+	downmix    bool
+	duration   time.Duration
+	frames     int
+	at         string
+	after      time.Duration
+	maxBytes   int64
+	maxSize    string
+	device     string
+	hostAPI    string
+	latency    string
+	loopback   bool
+	endian     string
+	stdout     bool
+	streamWAV  bool
+	buffer     int
+	bitDepth   int
+	dither     string
+	sampleFmt  string
+	meter      bool
+	progress   bool
+	failOnClip bool
+	trim       bool
+	trimStart  time.Duration
+	trimEnd    time.Duration
+	normalize  bool
+	target     float64
+	loudness   float64
+	gain       float64
+	highpass   float64
+	logFormat  string
+	logFile    string
+	quiet      bool
+	verbose    bool
+	append     bool
+	split      time.Duration
+	check      bool
+	inputFile  string
+	stream     string
+	monitor    bool
+	bitrate    int
+	threads    int
+	cue        bool
+
+	checksum      bool
+	embedChecksum bool
+
+	noiseGate   float64
+	gateAttack  time.Duration
+	gateRelease time.Duration
+
+	autoGain       bool
+	autoGainTarget float64
+	autoGainMax    float64
+
+	minFree      string
+	requireSpace bool
+
+	incrementalFlush bool
+	flushInterval    time.Duration
+
+	retroactive time.Duration
+	stopKey     string
+
+	spectrogram       bool
+	spectrogramWindow int
+	spectrogramHop    int
+
+	preview      bool
+	previewWidth int
+
+	stopOnSilence    bool
+	silenceDuration  time.Duration
+	zeroTimeout      time.Duration
+	startOnSound     bool
+	prebuffer        time.Duration
+	silenceThreshold float64
+}
 
 // Spec returns a command spec containing a description of it's usage.
 func (cmd *recordCmd) Spec() cli.CommandSpec {
@@ -31,252 +196,1251 @@ func (cmd *recordCmd) Spec() cli.CommandSpec {
 
 // RegisterFlags initializes how a flag set is processed for a particular command.
 func (cmd *recordCmd) RegisterFlags(fl *pflag.FlagSet) {
-	fl.StringVarP(&cmd.outFile, "out", "o", cmd.outFile, "Name the output file.")
+	fl.StringVarP(&cmd.outFile, "out", "o", cmd.outFile, "Name the output file, or - to write to stdout. The extension of the format is added unless the name already has it, and an extension like .wav selects that format when --format isn't set.")
+	fl.StringVar(&cmd.dir, "dir", "", "Directory to write the recording to. Relative names given with --out are inside it.")
+	fl.BoolVar(&cmd.mkdir, "mkdir", false, "Create the --dir directory if it doesn't exist.")
+	fl.BoolVar(&cmd.dateSubdir, "append-date-subdir", false, "Write the recording to a subdirectory named after the date it starts, like 2024/01/15, inside the directory it would otherwise go to. The subdirectories are created as needed.")
+	fl.StringVar(&cmd.dateGrain, "date-subdir-granularity", dateSubdirDay, "How finely --append-date-subdir files recordings: day for 2024/01/15 or month for 2024/01.")
+	fl.BoolVar(&cmd.force, "force", false, "Overwrite an output file that already exists.")
+	fl.BoolVar(&cmd.noClobber, "no-clobber", false, "Refuse to overwrite an output file that already exists. This is the default, and overrides force in a config file.")
+	fl.StringVar(&cmd.nameTmpl, "name-template", defaultNameTemplate, "Name of the output file when --out isn't set. {time} is replaced by the local time as 2006-01-02T15-04-05 and {unix} by the seconds since the epoch. The extension of the format is added.")
+	fl.BoolVar(&cmd.stdout, "stdout", false, "Write the recording to stdout instead of a file.")
+	fl.BoolVar(&cmd.streamWAV, "stream-wav", false, "Write a wav stream to stdout, implying --stdout and --format wav. Its header gives the largest sizes instead of zero, so players that read it as a stream play it until it ends.")
+	fl.StringVarP(&cmd.format, "format", "f", formatAIFF, "Output format (aiff, wav, flac, opus, mp3 or raw). Raw files have no header, so the sample rate and channel count must be known to read them. FLAC stores at most 24 bits, so 32 bit samples lose their lowest 8 bits. Opus is encoded by ffmpeg in 20ms packets and only records at 48000 Hz, which is the default sample rate for it. MP3 is encoded by ffmpeg from 16 bit samples, which is the default bit depth for it, with at most 2 channels at 8000, 11025, 12000, 16000, 22050, 24000, 32000, 44100 or 48000 Hz.")
+	fl.BoolVar(&cmd.aifc, "aifc", false, "Write an aiff recording as AIFF-C with little endian samples, marked with the sowt compression type, which some tools read faster.")
+	fl.IntVar(&cmd.bitrate, "bitrate", 0, "Target bitrate in kbps for opus (6 to 510) and mp3 (8 to 320). Defaults to 128 for mp3 and the encoder's choice for opus.")
+	fl.IntVar(&cmd.threads, "threads", 0, "Number of goroutines that compress flac frames, which are still written in order, so the file is the same for any number. Defaults to the number of CPUs Go uses (GOMAXPROCS). Opus and mp3 are compressed by ffmpeg, which picks its own.")
+	fl.StringVar(&cmd.endian, "endian", "big", "Byte order of raw samples written with --format raw or read with --input-file (big or little).")
+	fl.StringVar(&cmd.stream, "stream", "", "Also send the recording to a udp://host:port address as it's captured. Each datagram has a 16 byte header of the magic \"AREC\", a sequence number, the sample rate, channels and bit depth, followed by big endian samples.")
+	fl.StringVar(&cmd.inputFile, "input-file", "", "Read raw samples from this file instead of an input device. The samples must match --bit-depth, --channels and --endian, like a file recorded with --format raw.")
+	fl.IntVarP(&cmd.sampleRate, "sample-rate", "r", 44100, "Sample rate in Hz.")
+	fl.IntVar(&cmd.resample, "resample", 0, "Resample the audio captured at --sample-rate to this rate in Hz before writing it. Linear interpolation is cheap and only delays the audio by a frame, but it doesn't filter out aliasing, so it suits speech better than music.")
+	fl.IntVarP(&cmd.channels, "channels", "c", 1, "Number of input channels to record.")
+	fl.StringVar(&cmd.channelMap, "channel-map", "", "Record these channels of the input device, counted from 0 and separated by commas, like 0,2 to record the first and third inputs of an interface into a 2 channel file. Sets --channels to the number listed.")
+	fl.BoolVar(&cmd.downmix, "downmix", false, "Average the --channels captured into a single channel before writing it.")
+	fl.StringVar(&cmd.logFormat, "log-format", logFormatText, "Format of the log (text or json).")
+	fl.StringVar(&cmd.logFile, "log-file", "", "Append the log to this file instead of writing it to stderr.")
+	fl.BoolVarP(&cmd.quiet, "quiet", "q", false, "Only log errors.")
+	fl.BoolVarP(&cmd.verbose, "verbose", "v", false, "Log the index, peak level, bytes written and elapsed time of a captured buffer every half second.")
+	fl.BoolVar(&cmd.monitor, "monitor", false, "Play the input through the default output device while recording. Use headphones, speakers near the microphone will feed back.")
+	fl.BoolVar(&cmd.meter, "meter", false, "Show the input level while recording (only when stderr is a terminal).")
+	fl.BoolVar(&cmd.progress, "progress", false, "Show how long the recording has been running and the approximate size of aiff, wav and raw output on stderr, updated every second on a terminal and logged every 10 seconds otherwise.")
+	fl.BoolVar(&cmd.stopOnSilence, "stop-on-silence", false, "Stop recording once the input has been silent for --silence-duration.")
+	fl.DurationVar(&cmd.silenceDuration, "silence-duration", 2*time.Second, "How long the input must stay silent to stop with --stop-on-silence.")
+	fl.DurationVar(&cmd.zeroTimeout, "abort-on-silence-timeout", 0, "Abort the recording, still finalizing it, once every sample captured for this long is exactly zero, which a disconnected device often sends while even a quiet microphone picks up some noise (0 never aborts). The recording exits with status 1.")
+	fl.BoolVar(&cmd.startOnSound, "start-on-sound", false, "Capture without writing anything until the input first peaks at --silence-threshold, like for someone who starts talking some time after the recorder.")
+	fl.DurationVar(&cmd.prebuffer, "prebuffer", 0, "With --start-on-sound, keep this much of what's captured before the input gets loud enough, like 500ms, and start the recording with it so the first syllable isn't cut off.")
+	fl.Float64Var(&cmd.silenceThreshold, "silence-threshold", 0.01, "Peak level, as a fraction of full scale, below which input counts as silence.")
+	fl.Float64Var(&cmd.noiseGate, "noise-gate", 0, "Silence the input while its peak level, as a fraction of full scale, is below this threshold (0 disables the gate).")
+	fl.DurationVar(&cmd.gateAttack, "gate-attack", 5*time.Millisecond, "How long the noise gate takes to open once the input is louder than its threshold.")
+	fl.DurationVar(&cmd.gateRelease, "gate-release", 200*time.Millisecond, "How long the noise gate takes to close once the input is quieter than its threshold.")
+	fl.BoolVar(&cmd.autoGain, "auto-gain", false, "Adjust the gain as the input gets louder and quieter to keep its RMS level near --auto-gain-target, like for a speaker who moves around the microphone.")
+	fl.Float64Var(&cmd.autoGainTarget, "auto-gain-target", -20, "RMS level in dBFS that --auto-gain aims for.")
+	fl.Float64Var(&cmd.autoGainMax, "auto-gain-max", 20, "Most gain in dB that --auto-gain applies, which limits how far it raises quiet input and noise.")
+	fl.Float64Var(&cmd.gain, "gain", 1, "Multiply every sample by this amount, clamping instead of wrapping.")
+	fl.Float64Var(&cmd.highpass, "highpass", 0, "Filter out rumble below this frequency in Hz with a 12 dB per octave high-pass filter (0 disables it). 80 to 100 Hz suits voice.")
+	fl.DurationVar(&cmd.split, "split-duration", 0, "Start a new file every interval. Files are named <out>-001.<format>, <out>-002.<format> and so on.")
+	fl.BoolVar(&cmd.append, "append", false, "Append to the output file if it's an existing recording with the same format, sample rate, channels and bit depth.")
+	fl.BoolVar(&cmd.spectrogram, "spectrogram", false, "Write a grayscale spectrogram of the recording next to it as <out>.png once recording stops.")
+	fl.IntVar(&cmd.spectrogramWindow, "spectrogram-window", 1024, "Frames in each column of the spectrogram, a power of two. Larger windows resolve frequencies more finely and time more coarsely.")
+	fl.IntVar(&cmd.spectrogramHop, "spectrogram-hop", 256, "Frames between the starts of neighbouring spectrogram columns.")
+	fl.BoolVar(&cmd.cue, "cue", false, "Write the wall-clock time of the start, pauses, resumes and end of the recording, and of markers added by typing c and an optional name then pressing enter, with their frame offsets to <out>.cue.tsv. Markers, pauses and resumes are also written to aiff recordings as AIFF markers.")
+	fl.BoolVar(&cmd.checksum, "checksum", false, "Write the SHA-256 of an aiff or wav recording's sample data to <out>.sha256 once it stops, which the verify command checks it against. The header isn't covered, since its sizes are filled in last.")
+	fl.BoolVar(&cmd.embedChecksum, "embed-checksum", false, "Also write the --checksum to an aiff recording as an ANNO chunk.")
+	fl.BoolVar(&cmd.preview, "preview", false, "Print an outline of the recording's waveform to stderr once recording stops.")
+	fl.IntVar(&cmd.previewWidth, "preview-width", 0, "Columns in the --preview waveform (defaults to the width of the terminal, or 80).")
+	fl.StringVar(&cmd.title, "title", "", "Tag an aiff or wav recording with a title.")
+	fl.StringVar(&cmd.author, "author", "", "Tag an aiff or wav recording with its author.")
+	fl.StringVar(&cmd.comment, "comment", "", "Tag an aiff or wav recording with a comment.")
+	fl.BoolVar(&cmd.trim, "trim", false, "Remove silence below --silence-threshold from the start and end of the recording.")
+	fl.DurationVar(&cmd.trimStart, "trim-start", 0, "Remove this much from the start of the recording once it stops, like 2s.")
+	fl.DurationVar(&cmd.trimEnd, "trim-end", 0, "Remove this much from the end of the recording once it stops, before --trim removes silence.")
+	fl.BoolVar(&cmd.normalize, "normalize", false, "Scale the recording once it stops so that its peak reaches --normalize-target.")
+	fl.Float64Var(&cmd.target, "normalize-target", -1, "Peak level in dBFS that --normalize scales the recording to.")
+	fl.Float64Var(&cmd.loudness, "loudness", 0, "Scale the recording once it stops so that its integrated loudness, measured like EBU R128, reaches this many LUFS, such as -16 for podcasts. The gain is held back if it would raise the peak above 0 dBFS.")
+	fl.BoolVar(&cmd.check, "check", false, "Read a single buffer from the input and report its level without recording. Exits with a nonzero status if capture fails or the input is silent.")
+	fl.BoolVar(&cmd.failOnClip, "fail-on-clip", false, "Exit with a nonzero status if any samples clipped.")
+	fl.IntVar(&cmd.bitDepth, "bit-depth", 32, "Bits per sample (16, 24 or 32). 24 bit samples are captured as 32 bits and stored in 3 bytes each.")
+	fl.StringVar(&cmd.dither, "dither", ditherNone, ditherUsage+" A dithered 16 bit recording is captured at 32 bits and reduced before it's written.")
+	fl.StringVar(&cmd.sampleFmt, "sample-format", sampleFormatInt, "Sample type (int or float32). Float samples are 32 bits and are written to aiff as AIFF-C, to wav as IEEE float and to raw as is.")
+	fl.StringVarP(&cmd.device, "device", "D", "", "Input device name or index as listed by the devices command (defaults to the system default).")
+	fl.StringVar(&cmd.hostAPI, "host-api", "", hostAPIUsage)
+	fl.StringVar(&cmd.latency, "latency", latencyHigh, latencyUsage)
+	fl.BoolVar(&cmd.loopback, "loopback", false, "Record what the system is playing from the first input device named like a monitor or loopback device. Whether there is one depends on the host audio system.")
+	fl.DurationVarP(&cmd.duration, "duration", "d", 0, "Stop recording after this long (0 records until stopped).")
+	fl.IntVar(&cmd.frames, "frames", 0, "Stop recording once exactly this many frames have been written at the output sample rate, like for clips that must all be the same length (0 doesn't limit it). Unlike --duration it counts samples rather than time on the clock.")
+	fl.StringVar(&cmd.at, "at", "", "Wait until this time to start recording, either a clock time later today like 15:30 or an RFC 3339 timestamp.")
+	fl.DurationVar(&cmd.after, "after", 0, "Wait this long before starting to record.")
+	fl.BoolVar(&cmd.requireSpace, "require-space", false, "Refuse to start unless the filesystem of the output has room for the whole recording, estimated from --duration or the size limit. Without it a recording that doesn't look like it fits only logs a warning.")
+	fl.StringVar(&cmd.minFree, "min-free-space", "100MB", "Stop recording once less than this much space is free on the filesystem of the output, which is checked every 10 seconds, so the recording is finalized before the disk fills up (0 disables it). Free space can't be checked on windows.")
+	fl.BoolVar(&cmd.incrementalFlush, "incremental-flush", false, "Fill in the header sizes of an aiff or wav file every --flush-interval while recording, so a recording that's killed before it can be finalized still plays up to about then. Each flush costs a pair of seeks.")
+	fl.DurationVar(&cmd.flushInterval, "flush-interval", 5*time.Second, "How often --incremental-flush fills in the header sizes.")
+	fl.StringVar(&cmd.stopKey, "stop-key", stopKeyEnter, stopKeyUsage)
+	fl.DurationVar(&cmd.retroactive, "retroactive", 0, "Keep only the last this long of audio in memory while capturing, like 30s, and write it out when the recording stops, like an instant replay. The buffer takes 4 bytes per sample, so 60s of 44100 Hz stereo takes about 21MB.")
+	fl.StringVar(&cmd.maxSize, "max-size", "", "Stop recording before the output grows past this size, like 500MB, 2GB or 64MiB. The same as --max-bytes, but easier to read.")
+	fl.Int64Var(&cmd.maxBytes, "max-bytes", 0, "Stop recording before the output grows past this many bytes (0 doesn't limit it). On stdout the recording is held in memory until it stops, so its header sizes can be filled in.")
+	fl.IntVarP(&cmd.buffer, "buffer", "b", 1024, "Frames captured per read. Larger buffers use less CPU and are less likely to drop audio, smaller buffers reduce latency.")
 }
 
 // Run starts recording microphone audio and stops when input is received from stdin.
+// It exits with a nonzero status if the recording fails.
 func (cmd *recordCmd) Run(fl *pflag.FlagSet) {
-	if cmd.outFile == "" {
-		cmd.outFile = fmt.Sprintf("%d.aiff", time.Now().Unix())
-	} else {
-		cmd.outFile += ".aiff"
+	closeLog, err := cmd.openLog()
+	if err != nil {
+		flog.Error("%v", err)
+		if _, ok := err.(usageError); ok {
+			fl.Usage()
+		}
+		os.Exit(1)
 	}
 
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, signals...)
+	err = cmd.run(fl)
+	if intErr, ok := err.(interruptedError); ok {
+		// the recording was finalized before run returned, so exiting here loses nothing.
+		closeLog()
+		os.Exit(intErr.exitCode())
+	}
 
-	f, err := os.Create(cmd.outFile)
 	if err != nil {
-		flog.Error("failed to create %s : %v", cmd.outFile, err)
-		fl.Usage()
-		return
+		log.Error("%v", err)
+		if _, ok := err.(usageError); ok {
+			fl.Usage()
+		}
 	}
 
-	defer func() {
-		flog.Info("closing %s", cmd.outFile)
+	// closed after the error is logged, which os.Exit would skip if it were deferred.
+	closeLog()
 
-		if err := f.Close(); err != nil {
-			flog.Error("failed to close %s : %v", cmd.outFile, err)
-		} else {
-			flog.Success("successfully closed %s", cmd.outFile)
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// openLog points log at stderr or the log file in the configured format,
+// and returns a func that closes the log file.
+func (cmd *recordCmd) openLog() (func(), error) {
+	if cmd.logFormat != logFormatText && cmd.logFormat != logFormatJSON {
+		return nil, usageErrorf("unsupported log format %q : must be %s or %s", cmd.logFormat, logFormatText, logFormatJSON)
+	}
+
+	var logOut io.Writer = os.Stderr
+	closeLog := func() {}
+
+	if cmd.logFile != "" {
+		f, err := os.OpenFile(cmd.logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file %s : %v", cmd.logFile, err)
 		}
-	}()
 
-	flog.Success("successfully created %s", cmd.outFile)
+		closeLog = func() {
+			if err := f.Close(); err != nil {
+				flog.Error("failed to close log file %s : %v", cmd.logFile, err)
+			}
+		}
+		logOut = f
+	}
 
-	if err := writeFormChunk(f); err != nil {
-		flog.Error("failed to write form chunk : %v", err)
-		fl.Usage()
-		return
+	log = newLogger(cmd.logFormat, logOut)
+	if cmd.quiet {
+		log = quietLogger{log}
 	}
+	return closeLog, nil
+}
 
-	flog.Success("successfully wrote form chunk")
+// run records with the configured flags. Errors from invalid
+// flags are returned as a usageError.
+func (cmd *recordCmd) run(fl *pflag.FlagSet) error {
+	rec, err := cmd.newRecording(fl)
+	if err != nil {
+		return err
+	}
+	ef, _ := lookupEncoder(rec.format)
+	toStdout := cmd.toStdout()
 
-	if err := writeCommonChunk(f); err != nil {
-		flog.Error("failed to write common chunk : %v", err)
-		fl.Usage()
-		return
+	// start is when recording begins, or the zero time to begin right away.
+	var start time.Time
+	if cmd.at != "" {
+		if start, err = parseStartTime(cmd.at, time.Now()); err != nil {
+			return usageError{err}
+		}
+	} else if cmd.after > 0 {
+		start = time.Now().Add(cmd.after)
 	}
 
-	flog.Success("successfully wrote common chunk")
+	if cmd.check {
+		peak, err := checkInput(rec)
+		if err != nil {
+			return err
+		}
+
+		if peak == 0 {
+			return errors.New("input level is flat zero, the input may be muted")
+		}
 
-	if err := writeSoundChunk(f); err != nil {
-		flog.Error("failed to write sound chunk : %v", err)
-		fl.Usage()
-		return
+		log.Success("successfully captured from the input at a peak level of %.1f%% of full scale", 100*peak)
+		return nil
 	}
 
-	flog.Success("successfully wrote sound chunk")
+	if cmd.stream != "" {
+		stream, err := dialStream(cmd.stream, rec.pcmFormat)
+		if err != nil {
+			return err
+		}
 
-	numSamples := 0
+		log.Success("successfully opened stream to %s", stream.addr)
 
-	defer func() {
-		flog.Info("filling in missing sizes")
+		defer func() {
+			if err := stream.Close(); err != nil {
+				log.Error("failed to close stream to %s : %v", stream.addr, err)
+			}
+		}()
+		rec.stream = stream
+	}
 
-		totalBytes := 50 * numSamples
+	if cmd.dir != "" && !toStdout {
+		if err := prepareDir(cmd.dir, cmd.mkdir); err != nil {
+			return err
+		}
+	}
 
-		// fill in missing sizes
-		_, err = f.Seek(4, 0)
-		err = binary.Write(f, binary.BigEndian, int32(totalBytes))
-		_, err = f.Seek(22, 0)
-		err = binary.Write(f, binary.BigEndian, int32(numSamples))
-		_, err = f.Seek(42, 0)
-		err = binary.Write(f, binary.BigEndian, int32(4*numSamples+8))
+	if !start.IsZero() {
+		log.Info("recording will start at %s, press ctrl+c to cancel", start.Format("2006-01-02 15:04:05"))
+
+		if err := waitUntil(start); err != nil {
+			return err
+		}
+		log.Info("starting the scheduled recording")
+	}
+
+	named := time.Now()
+	base := cmd.baseName(named)
+	if cmd.dir != "" && !toStdout {
+		base = filepath.Join(cmd.dir, base)
+	}
 
+	if cmd.dateSubdir {
+		sub, err := dateSubdir(cmd.dateGrain, named)
 		if err != nil {
-			flog.Error("failed to fill in missing sizes : %v", err)
+			return usageError{err}
+		}
+
+		dir := filepath.Join(filepath.Dir(base), sub)
+		if err := prepareDir(dir, true); err != nil {
+			return err
+		}
+		base = filepath.Join(dir, filepath.Base(base))
+	}
+
+	// segments are numbered from 1 in the order they're recorded.
+	segment := 1
+	segmentName := func() string { return fmt.Sprintf("%s-%03d.%s", base, segment, ef.ext) }
+
+	if toStdout {
+		cmd.outFile = "stdout"
+	} else if cmd.split > 0 {
+		cmd.outFile = segmentName()
+	} else {
+		cmd.outFile = base + "." + ef.ext
+	}
+	// outputs are the files written, which the summary adds up the size of.
+	outputs := []string{cmd.outFile}
+
+	if !toStdout {
+		dir := filepath.Dir(cmd.outFile)
+		if err := checkFreeSpace(dir, rec, cmd.requireSpace); err != nil {
+			return err
+		}
+		rec.spaceDir = dir
+	}
+
+	// stdout is wrapped so that record doesn't try to seek back
+	// into a pipe to fill in the header sizes.
+	var out io.Writer = struct{ io.Writer }{os.Stdout}
+	var f *bufferedFile
+	var mem *memoryFile
+
+	if toStdout && cmd.maxBytes > 0 {
+		log.Info("holding up to %d bytes in memory until recording stops", cmd.maxBytes)
+		mem = &memoryFile{}
+		out = mem
+	} else if toStdout {
+		if cmd.format != formatRaw && !cmd.streamWAV {
+			log.Info("header sizes can't be filled in on stdout, use --format %s for a headerless stream", formatRaw)
+		}
+		if cmd.trim {
+			log.Info("silence can't be trimmed on stdout, ignoring --trim")
+		}
+		if cmd.trimStart > 0 || cmd.trimEnd > 0 {
+			log.Info("recordings can't be trimmed on stdout, ignoring --trim-start and --trim-end")
+		}
+		if cmd.normalize {
+			log.Info("recordings can't be normalized on stdout, ignoring --normalize")
+		}
+		if cmd.loudness != 0 {
+			log.Info("recordings can't be normalized on stdout, ignoring --loudness")
+		}
+		if !rec.meta.empty() {
+			log.Info("metadata can't be written on stdout, ignoring --title, --author and --comment")
+		}
+	} else {
+		open := func(name string) (*os.File, error) { return createOutput(name, cmd.force) }
+		if cmd.append {
+			open = func(name string) (*os.File, error) { return openAppend(name, &rec) }
+		}
+
+		file, err := open(cmd.outFile)
+		if os.IsExist(err) {
+			return clobberError(cmd.outFile)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to open %s : %v", cmd.outFile, err)
+		}
+		f = newBufferedFile(file)
+
+		defer func() {
+			// f is nil if the next segment couldn't be created.
+			if f == nil {
+				return
+			}
+
+			log.Info("closing %s", cmd.outFile)
+
+			if err := f.Close(); err != nil {
+				log.Error("failed to close %s : %v", cmd.outFile, err)
+			} else {
+				log.Success("successfully closed %s", cmd.outFile)
+			}
+		}()
+
+		if rec.appending {
+			log.Success("successfully opened %s to append %d frames", cmd.outFile, rec.frames(rec.existingSamples))
 		} else {
-			flog.Success("successfully filled in missing sizes.")
+			log.Success("successfully created %s", cmd.outFile)
 		}
-	}()
+		out = f
+
+		if cmd.split > 0 {
+			rec.splitFrames = int(cmd.split.Seconds() * float64(rec.sampleRate))
+			rec.nextSegment = func() (io.Writer, error) {
+				if err := f.Close(); err != nil {
+					log.Error("failed to close %s : %v", cmd.outFile, err)
+				} else {
+					log.Success("successfully closed %s", cmd.outFile)
+				}
+				f = nil
+
+				segment++
+				cmd.outFile = segmentName()
+				outputs = append(outputs, cmd.outFile)
+
+				next, err := createOutput(cmd.outFile, cmd.force)
+				if os.IsExist(err) {
+					return nil, clobberError(cmd.outFile)
+				}
+				if err != nil {
+					return nil, err
+				}
 
-	if err := portaudio.Initialize(); err != nil {
-		flog.Error("failed to initialize portaudio : %v", err)
-		fl.Usage()
-		return
+				log.Success("successfully created %s", cmd.outFile)
+				f = newBufferedFile(next)
+				return f, nil
+			}
+		}
 	}
 
-	flog.Success("successfully initialized portaudio")
+	stats, err := record(out, rec)
 
-	defer func() {
-		flog.Info("terminating portaudio")
+	// the recording is read back by name below, so what
+	// the encoder left buffered has to reach the file first.
+	if f != nil {
+		if err := f.Flush(); err != nil {
+			log.Error("failed to write %s : %v", cmd.outFile, err)
+		}
+	}
+
+	if stats.stopReason != "" {
+		size := int64(-1)
+		if mem != nil {
+			size = int64(len(mem.Bytes()))
+		} else if !toStdout {
+			total, err := outputFilesSize(outputs)
+			if err != nil {
+				log.Error("%v", err)
+			} else {
+				size = total
+			}
+		}
+
+		s := newSummary(cmd.outFile, size, rec, stats)
+		if cmd.split > 0 {
+			s.Segments = len(outputs)
+		}
+		logSummary(s)
+	}
 
-		if err := portaudio.Terminate(); err != nil {
-			flog.Error("failed to terminate portaudio : %v", err)
+	intErr, interrupted := err.(interruptedError)
+	if err != nil && !interrupted {
+		return err
+	}
+
+	if cmd.cue {
+		name := base + ".cue.tsv"
+		if err := writeCues(name, stats.cues, rec.sampleRate, rec.appending); err != nil {
+			log.Error("%v", err)
 		} else {
-			flog.Success("successfully terminated port audio")
+			log.Success("successfully wrote %d cues to %s", len(stats.cues), name)
 		}
-	}()
+	}
 
-	in := make([]int32, 64)
+	if cmd.checksum && stats.checksum != "" {
+		if err := writeChecksumFile(cmd.outFile, stats.checksum); err != nil {
+			log.Error("%v", err)
+		} else {
+			log.Success("successfully wrote sha256 %s to %s", stats.checksum, cmd.outFile+checksumExt)
+		}
+	}
 
-	stream, err := portaudio.OpenDefaultStream(1, 0, 44100, len(in), in)
-	if err != nil {
-		flog.Error("failed to open audio stream : %v", err)
-		fl.Usage()
-		return
+	if mem != nil {
+		if _, err := os.Stdout.Write(mem.Bytes()); err != nil {
+			return fmt.Errorf("failed to write the recording to stdout : %v", err)
+		}
+		log.Success("successfully wrote %d bytes to stdout", len(mem.Bytes()))
 	}
 
-	flog.Success("successfully opened audio stream")
+	var clipErr error
+	if cmd.failOnClip && stats.clippedFrames > 0 {
+		clipErr = fmt.Errorf("%d frames clipped and --fail-on-clip is set", stats.clippedFrames)
+	}
 
-	defer func() {
-		flog.Info("closing audio stream")
+	if interrupted {
+		if clipErr != nil {
+			log.Error("%v", clipErr)
+		}
+		return intErr
+	}
+
+	if toStdout || cmd.split > 0 {
+		return clipErr
+	}
+
+	if cmd.spectrogram {
+		name := base + ".png"
+		log.Info("writing spectrogram to %s", name)
 
-		if err := stream.Close(); err != nil {
-			flog.Error("failed to close audio stream : %v", err)
+		if err := writeSpectrogramFile(name, cmd.outFile, rec, cmd.spectrogramWindow, cmd.spectrogramHop); err != nil {
+			log.Error("%v", err)
 		} else {
-			flog.Success("successfully closed audio stream")
+			log.Success("successfully wrote %s", name)
+		}
+	}
+
+	if cmd.preview {
+		width := cmd.previewWidth
+		if width == 0 {
+			width = terminalWidth(os.Stderr)
 		}
-	}()
 
-	if err := stream.Start(); err != nil {
-		flog.Error("failed to start audio stream : %v", err)
-		fl.Usage()
-		return
+		if err := printPreviewFile(os.Stderr, cmd.outFile, rec, width); err != nil {
+			log.Error("failed to preview %s : %v", cmd.outFile, err)
+		}
+	}
+
+	// the recording is already written, so not being able to play it back doesn't fail the command.
+	play := exec.Command("ffplay", cmd.outFile)
+	if err := play.Start(); err != nil {
+		log.Error("failed to playback %s : %v", cmd.outFile, err)
+		return clipErr
+	}
+	log.Info("playing %s", cmd.outFile)
+	return clipErr
+}
+
+// capturePCMFormat returns the format the input is captured in, before any downmixing or resampling.
+func (rec recording) capturePCMFormat() pcmFormat {
+	pf := rec.pcmFormat
+	if rec.captureRate != 0 {
+		pf.sampleRate = rec.captureRate
+	}
+	if rec.captureChannels != 0 {
+		pf.channels = rec.captureChannels
+	}
+	if rec.captureBitDepth != 0 {
+		pf.bitDepth = rec.captureBitDepth
+	}
+	return pf
+}
+
+// inputDevice returns the device rec captures from when it isn't reading a file.
+func (rec recording) inputDevice() captureDevice {
+	if rec.dev != nil {
+		return rec.dev
+	}
+	return &portaudioDevice{}
+}
+
+// usageError is returned by recordCmd.run for invalid flags,
+// so that Run prints the usage after logging it.
+type usageError struct{ error }
+
+// usageErrorf returns a usageError with a formatted message.
+func usageErrorf(format string, args ...interface{}) error {
+	return usageError{fmt.Errorf(format, args...)}
+}
+
+// interruptedError is returned by record when a signal stops the recording.
+// The recording is still finalized, but it isn't played back, and Run exits
+// with the shell's code for the signal so that scripts can tell it apart
+// from a recording that was stopped normally.
+type interruptedError struct{ sig os.Signal }
+
+func (e interruptedError) Error() string { return fmt.Sprintf("interrupted by %s", e.sig) }
+
+// exitCode returns 128 plus the signal number, or 1 for a signal without one.
+func (e interruptedError) exitCode() int {
+	if sig, ok := e.sig.(syscall.Signal); ok {
+		return 128 + int(sig)
+	}
+	return 1
+}
+
+// recordStats summarizes a finished recording.
+type recordStats struct {
+	// samples counts interleaved samples written across all channels,
+	// which pcmFormat.frames turns into a frame count.
+	samples int
+	// overflows counts reads where portaudio dropped input because
+	// it wasn't read quickly enough.
+	overflows int
+	// capturedFrames counts frames read from the input, before any resampling.
+	capturedFrames int
+	// clippedFrames counts captured frames with a sample above clipPercent of full scale.
+	clippedFrames int
+	// gainClamped counts samples clamped because the gain pushed them out of range.
+	gainClamped int
+	// readErrors counts reads from the input that failed, including retries.
+	readErrors int
+	// mutedFrames counts frames written as silence while muted.
+	mutedFrames int
+	// levels measures each captured channel.
+	levels *channelLevels
+	// cues are the moments recorded for --cue, in the order they happened.
+	cues []cuePoint
+	// checksum is the SHA-256 of the sample data for --checksum, once it's finalized.
+	checksum string
+	// stopReason says why the recording stopped, or is empty if it never started.
+	stopReason string
+}
+
+// recording holds the parameters of a single recording.
+type recording struct {
+	format string
+	order  binary.ByteOrder
+	pcmFormat
+	device   string
+	duration time.Duration
+	// maxFrames, when nonzero, stops the recording once it has written that many frames.
+	maxFrames int
+	buffer    int
+	// maxBytes, when nonzero, stops the recording before the output grows past it.
+	maxBytes int64
+	// minFree, when nonzero, stops the recording once less than
+	// that many bytes are free on the filesystem holding spaceDir.
+	minFree  int64
+	spaceDir string
+	meter    bool
+	monitor  bool
+	// progress shows the elapsed time and output size, in
+	// place on a terminal and logged to anywhere else.
+	progress bool
+	// flushInterval, when nonzero, is how often the header sizes are
+	// filled in while recording, for encoders that can do so.
+	flushInterval time.Duration
+
+	// loopback selects the first monitor or loopback device instead of device.
+	loopback bool
+
+	// hostAPI, when set, picks device, or the default device, from that host API.
+	hostAPI string
+
+	// lowLatency opens the input with the device's low latency instead of its high one.
+	lowLatency bool
+
+	// streamWAV writes a wav header whose sizes are the largest
+	// instead of zero, for output that can't seek back to fill them in.
+	streamWAV bool
+
+	// verbose logs the stats of a captured buffer every verboseInterval.
+	verbose bool
+
+	// cue records the time and frame of the start, pauses, resumes,
+	// markers typed on stdin and end of the recording in recordStats.
+	cue bool
+	// cues points at those recordStats.cues while recording, so that
+	// aiff can write them as markers once it stops.
+	cues *[]cuePoint
+
+	// checksum hashes the sample data once it's finalized into recordStats.checksum.
+	checksum bool
+	// embedChecksum also writes the checksum to an aiff recording as an ANNO chunk.
+	embedChecksum bool
+	// sum points at recordStats.checksum while recording, so that finalize can fill it in.
+	sum *string
+
+	// captureRate, when nonzero, is the rate the input is captured at
+	// before it's resampled to the sample rate of the output.
+	captureRate int
+	// captureChannels, when nonzero, is the number of channels captured
+	// before they're downmixed to the single channel of the output.
+	captureChannels int
+	// channelMap, when set, lists the channels of the input device that
+	// are captured, in the order they're recorded.
+	channelMap []int
+	// captureBitDepth, when nonzero, is the bit depth the input is
+	// captured at before it's reduced to that of the output with dither.
+	captureBitDepth int
+	dither          dsp.DitherShape
+
+	// inputFile, when set, is read for raw samples in inputOrder
+	// instead of capturing from an input device.
+	inputFile  string
+	inputOrder binary.ByteOrder
+
+	// dev, when set, is captured from instead of portaudio.
+	dev captureDevice
+	// controls, when set, stop, pause, mute and mark the recording in
+	// place of what's typed on stdin.
+	controls *controls
+	// signals, when set, tells record of the signals that stop it in place
+	// of subscribing to them.
+	signals chan os.Signal
+
+	// stream, when set, is sent every captured buffer.
+	stream *udpStream
+
+	// bitrate is the target kbps of lossy formats, or 0 for their default.
+	bitrate int
+
+	// threads is the number of goroutines flac frames are prepared on.
+	threads int
+
+	// gain multiplies every captured sample.
+	gain float64
+
+	// highpass, when nonzero, is the cutoff in Hz of a filter applied to every captured buffer.
+	highpass float64
+
+	// noiseGate, when nonzero, silences captured buffers below that fraction
+	// of full scale, fading in and out over gateAttack and gateRelease.
+	noiseGate   float64
+	gateAttack  time.Duration
+	gateRelease time.Duration
+
+	// autoGain keeps the RMS level of captured buffers near autoGainTarget
+	// dBFS, applying at most autoGainMax dB of gain.
+	autoGain       bool
+	autoGainTarget float64
+	autoGainMax    float64
+
+	// trim removes silence from both ends of the recording once it stops.
+	trim bool
+
+	// trimStart and trimEnd are the number of frames removed from
+	// the start and end of the recording once it stops.
+	trimStart, trimEnd int
+
+	// normalize scales the recording once it stops so
+	// that its peak reaches normalizeTarget dBFS.
+	normalize       bool
+	normalizeTarget float64
+
+	// loudness, when nonzero, scales the recording once it stops so
+	// that its integrated loudness reaches that many LUFS.
+	loudness float64
+
+	// meta is the text the recording is tagged with once it stops.
+	meta metadata
+
+	// splitFrames, when nonzero, finishes the output after that many
+	// frames and continues the recording in the writer from nextSegment.
+	splitFrames int
+	nextSegment func() (io.Writer, error)
+
+	// appending continues a recording that already holds existingSamples
+	// samples, so no header is written.
+	appending       bool
+	existingSamples int
+
+	// silenceDuration, when nonzero, stops the recording once every
+	// buffer read for that long peaks below silenceThreshold.
+	silenceDuration  time.Duration
+	silenceThreshold float64
+
+	// startOnSound holds off writing until the input first peaks at
+	// silenceThreshold, then starts with up to prebuffer of what came before.
+	startOnSound bool
+	prebuffer    time.Duration
+
+	// zeroTimeout, when nonzero, aborts the recording once every sample
+	// captured for that long is exactly zero, like from a dead device.
+	zeroTimeout time.Duration
+
+	// retroactive, when nonzero, holds only the last that long of the
+	// capture in memory and writes it once the recording stops.
+	retroactive time.Duration
+
+	// stopKey, when nonzero, is the key that stops the recording when
+	// single keys are read from a terminal, in place of enter.
+	stopKey byte
+}
+
+// record encodes audio captured for rec into w until
+// input is received from stdin, a signal arrives or rec.duration elapses.
+// The header sizes are filled in afterwards when w is an io.WriteSeeker.
+// A signal stops the recording with an interruptedError.
+func record(w io.Writer, rec recording) (stats recordStats, err error) {
+	stop := rec.signals
+	if stop == nil {
+		stop = make(chan os.Signal, 1)
+		signal.Notify(stop, signals...)
+		defer signal.Stop(stop)
+	}
+
+	if rec.appending {
+		stats.samples = rec.existingSamples
+	}
+
+	if rec.cue {
+		rec.cues = &stats.cues
+	}
+
+	if rec.checksum {
+		rec.sum = &stats.checksum
+	}
+
+	r := &recorder{rec: rec, stats: &stats, captureFormat: rec.capturePCMFormat()}
+	if r.enc, err = newEncoder(w, rec); err != nil {
+		return stats, err
+	}
+
+	if !rec.appending {
+		if err := r.enc.WriteHeader(); err != nil {
+			return stats, err
+		}
 	}
 
 	defer func() {
-		flog.Info("stopping audio stream")
+		// enc is nil if the next segment couldn't be started.
+		if r.enc == nil {
+			return
+		}
 
-		if err := stream.Stop(); err != nil {
-			flog.Error("failed to stop audio stream : %v", err)
-		} else {
-			flog.Success("successfully stopped audio stream")
+		// failing to finalize matters more than how the recording stopped.
+		if ferr := r.enc.Finalize(); ferr != nil {
+			if _, interrupted := err.(interruptedError); err == nil || interrupted {
+				err = ferr
+			}
+		}
+	}()
+
+	// buffers are encoded in another goroutine, which has to finish
+	// with everything captured before the encoder is finalized.
+	r.wr = newAsyncWriter(r.enc, rec.stream)
+	defer func() {
+		if werr := r.wr.close(); werr != nil && err == nil {
+			err = werr
 		}
 	}()
 
-	done := make(chan bool, 1)
-	flog.Success("successfully started capturing audio")
+	// portaudio fills a single buffer with interleaved frames,
+	// so it needs room for one sample per channel per frame.
+	// The type of the buffer selects the sample format.
+	r.frames = make([]int32, rec.buffer*r.captureFormat.channels)
+	r.in = r.frames
+	if rec.float {
+		r.in = make([]float32, len(r.frames))
+	} else if r.captureFormat.bitDepth == 16 {
+		r.in = make([]int16, len(r.frames))
+	}
+
+	stats.levels = newChannelLevels(r.captureFormat.channels)
 
-	go func() {
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
-			done <- true
+	if rec.inputFile != "" {
+		r.src, err = openFileInput(rec.inputFile, rec.inputOrder, r.captureFormat.bitDepth, r.in)
+	} else {
+		r.src, err = openDeviceInput(rec.inputDevice(), rec, r.in)
+	}
+	if err != nil {
+		return stats, err
+	}
+
+	defer func() {
+		if err := r.src.Close(); err != nil {
+			log.Error("failed to close %s : %v", rec.inputFile, err)
 		}
 	}()
 
-	flog.Info("press enter to stop recording")
+	var mon *monitor
+	if rec.monitor {
+		if mon, err = openMonitor(r.captureFormat, rec.buffer); err != nil {
+			return stats, err
+		}
+
+		defer func() {
+			if err := mon.Close(); err != nil {
+				log.Error("failed to terminate portaudio : %v", err)
+			}
+		}()
+	}
+
+	r.proc = newProcessor(rec, r.frames, mon)
+	defer r.logStats()
+
+	log.Success("successfully started capturing audio")
+
+	ctl := rec.controls
+	if ctl == nil {
+		var restore func()
+		ctl, restore = readControls(rec)
+		defer restore()
+	}
+
+	if rec.cue {
+		r.addCue(cueStart, false)
+	}
+
+	if rec.meter || rec.progress && isTerminal(os.Stderr) {
+		r.lvl = &meter{w: os.Stderr, bar: rec.meter}
+	}
+
+	if rec.retroactive > 0 {
+		r.ring = newSampleRing(int(rec.retroactive.Seconds()*float64(rec.sampleRate)) * rec.channels)
+		log.Info("keeping the last %s in %s of memory, which is written when the recording stops", rec.retroactive, formatSize(int64(4*len(r.ring.buf))))
+	}
+
+	var diskTick <-chan time.Time
+	if rec.spaceDir != "" && rec.minFree > 0 {
+		ticker := time.NewTicker(diskCheckInterval)
+		defer ticker.Stop()
+		diskTick = ticker.C
+	}
+
+	var flushTick <-chan time.Time
+	if rec.flushInterval > 0 {
+		ticker := time.NewTicker(rec.flushInterval)
+		defer ticker.Stop()
+		flushTick = ticker.C
+	}
+
+	var prog *progress
+	var tick <-chan time.Time
+	if rec.progress {
+		prog = &progress{lvl: r.lvl, started: time.Now()}
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	r.silence, r.zero = newSilenceWatch(rec), newZeroWatch(rec)
+
+	// a zero duration records until stopped.
+	r.timer = newDurationTimer(rec.duration)
+	defer r.timer.stop()
+	if rec.duration > 0 {
+		log.Info("recording will stop after %s", rec.duration)
+	}
+
+	r.limit = newSampleLimit(rec, stats.samples)
+	r.started = time.Now()
+	r.trigger = newSoundTrigger(rec)
+
+	var (
+		interrupted os.Signal
+		// stopErr stops the recording once the input can't be recovered
+		// or the output can't be written.
+		stopErr error
+	)
 
 recording:
 	for {
 		select {
-		case <-done:
+		case <-ctl.done:
+			r.lvl.clear()
+			stats.stopReason = stopInput
+			break recording
+		case <-ctl.pause:
+			r.togglePause()
+		case <-ctl.mute:
+			r.toggleMute()
+		case name := <-ctl.markers:
+			r.mark(name)
+		case <-diskTick:
+			low, err := r.lowDisk()
+			if err != nil {
+				// a platform that can't check once won't manage it later.
+				log.Info("failed to check free space in %s : %v", rec.spaceDir, err)
+				diskTick = nil
+				break
+			}
+
+			if low {
+				stats.stopReason = stopDiskSpace
+				break recording
+			}
+		case <-flushTick:
+			r.flushSizes()
+		case <-tick:
+			prog.update(r.outputSize(), r.paused)
+			if r.paused {
+				r.lvl.render(0)
+			}
+		case <-r.timer.C():
+			r.lvl.clear()
+			log.Info("reached recording duration of %s", rec.duration)
+			stats.stopReason = stopDuration
+			break recording
+		case sig := <-stop:
+			r.lvl.clear()
+			log.Info("received %s", sig)
+			interrupted = sig
+			stats.stopReason = stopSignal
 			break recording
-		case <-stop:
-			return
 		default:
-			if err := stream.Read(); err != nil {
-				flog.Error("failed to read from audio stream : %v", err)
+			if stats.stopReason, stopErr = r.step(); stats.stopReason != "" {
+				break recording
 			}
 
-			if err := binary.Write(f, binary.BigEndian, in); err != nil {
-				flog.Error("failed to write audio data to file as binary : %v", err)
+			if err := r.split(); err != nil {
+				return stats, err
 			}
-			numSamples += len(in)
 		}
 	}
 
-	flog.Info("recording stopped")
-	play := exec.Command("ffplay", cmd.outFile)
-	if err := play.Start(); err != nil {
-		flog.Error("failed to playback %s : %v", cmd.outFile, err)
-		fl.Usage()
-		return
+	r.finish(stopErr)
+
+	if stopErr != nil {
+		return stats, stopErr
 	}
-	flog.Info("playing %s", cmd.outFile)
+	if interrupted != nil {
+		return stats, interruptedError{interrupted}
+	}
+	return stats, nil
 }
 
-func writeFormChunk(f *os.File) error {
-	// http://paulbourke.net/dataformats/audio/
+// finalize trims and normalizes the recording in w if requested, computes the
+// checksum of its samples, writes its metadata and fills in its header sizes
+// when w can seek. A step that fails doesn't stop the ones after it, so
+// that the header sizes are still filled in, and the first error is returned.
+func finalize(w io.Writer, rec recording, numSamples int) error {
+	var first error
+	fail := func(err error) {
+		if first == nil {
+			first = err
+		} else {
+			log.Error("%v", err)
+		}
+	}
 
-	// header
-	if _, err := f.WriteString("FORM"); err != nil {
-		return err
+	// truncate drops what follows the first n samples once they've been trimmed.
+	truncate := func(n int) {
+		if t, ok := w.(interface{ Truncate(int64) error }); ok {
+			if err := t.Truncate(headerSize(rec.format, rec.pcmFormat) + int64(n*rec.bytesPerSample()+len(rec.trailingPad(n)))); err != nil {
+				fail(fmt.Errorf("failed to truncate trimmed recording : %v", err))
+			}
+		}
 	}
 
-	// total bytes
-	if err := binary.Write(f, binary.BigEndian, int32(0)); err != nil {
-		return err
+	if rws, ok := w.(io.ReadWriteSeeker); ok && (rec.trimStart > 0 || rec.trimEnd > 0) {
+		log.Info("trimming %d frames from the start and %d from the end", rec.trimStart, rec.trimEnd)
+
+		n, err := trimOffsets(rws, headerSize(rec.format, rec.pcmFormat), rec.pcmFormat, numSamples, rec.trimStart, rec.trimEnd)
+		if err != nil {
+			fail(fmt.Errorf("failed to trim recording : %v", err))
+		} else {
+			log.Success("successfully trimmed recording to %d frames", rec.frames(n))
+			numSamples = n
+			truncate(n)
+		}
 	}
 
-	// header
-	if _, err := f.WriteString("AIFF"); err != nil {
-		return err
+	if rws, ok := w.(io.ReadWriteSeeker); ok && rec.trim {
+		log.Info("trimming silence")
+
+		n, err := trimSilence(rws, headerSize(rec.format, rec.pcmFormat), rec.pcmFormat, rec.order, numSamples, rec.silenceThreshold)
+		if err != nil {
+			fail(fmt.Errorf("failed to trim silence : %v", err))
+		} else {
+			log.Success("successfully trimmed %d silent frames", rec.frames(numSamples-n))
+			numSamples = n
+			truncate(n)
+		}
 	}
 
-	return nil
+	if rws, ok := w.(io.ReadWriteSeeker); ok && rec.normalize {
+		log.Info("normalizing to %g dBFS", rec.normalizeTarget)
+
+		gain, err := normalize(rws, headerSize(rec.format, rec.pcmFormat), rec.pcmFormat, rec.order, numSamples, rec.normalizeTarget)
+		switch {
+		case err != nil:
+			fail(fmt.Errorf("failed to normalize recording : %v", err))
+		case gain == 0:
+			log.Info("recording is silent, skipping normalization")
+		default:
+			log.Success("successfully normalized recording by %.1f dB", 20*math.Log10(gain))
+		}
+	}
+
+	if rws, ok := w.(io.ReadWriteSeeker); ok && rec.loudness != 0 {
+		log.Info("normalizing to %g LUFS", rec.loudness)
+
+		gain, loudness, err := normalizeLoudness(rws, headerSize(rec.format, rec.pcmFormat), rec.pcmFormat, rec.order, numSamples, rec.loudness)
+		switch {
+		case err != nil:
+			fail(fmt.Errorf("failed to normalize recording : %v", err))
+		case gain == 0:
+			log.Info("recording is too quiet to measure its loudness, skipping normalization")
+		default:
+			db := 20 * math.Log10(gain)
+			log.Success("successfully normalized recording from %.1f LUFS by %.1f dB", loudness, db)
+			if loudness+db < rec.loudness-0.1 {
+				log.Info("the gain was held back to keep the peak below 0 dBFS, so the recording is at %.1f LUFS", loudness+db)
+			}
+		}
+	}
+
+	meta := rec.meta
+	if rs, ok := w.(io.ReadSeeker); ok && rec.sum != nil {
+		log.Info("computing the checksum of the sample data")
+
+		sum, err := sampleChecksum(rs, headerSize(rec.format, rec.pcmFormat), int64(numSamples*rec.bytesPerSample()))
+		if err != nil {
+			fail(fmt.Errorf("failed to compute checksum : %v", err))
+		} else {
+			log.Success("successfully computed checksum")
+			*rec.sum = sum
+			if rec.embedChecksum {
+				meta.checksum = sum
+			}
+		}
+	}
+
+	chunks := encodeMetadata(rec.format, meta)
+	if rec.format == formatAIFF && rec.cues != nil {
+		chunks = append(chunks, encodeMarkChunk(*rec.cues)...)
+	}
+
+	// the pad byte has to be written even without chunks to follow it.
+	trailing := append(rec.trailingPad(numSamples), chunks...)
+
+	var trailer int
+	if ws, ok := w.(io.WriteSeeker); ok && len(trailing) > 0 {
+		if len(chunks) > 0 {
+			log.Info("writing metadata")
+		}
+
+		if _, err := ws.Seek(headerSize(rec.format, rec.pcmFormat)+int64(numSamples*rec.bytesPerSample()), io.SeekStart); err != nil {
+			fail(fmt.Errorf("failed to seek to the end of the sample data : %v", err))
+		} else if _, err := ws.Write(trailing); err != nil {
+			fail(fmt.Errorf("failed to write metadata : %v", err))
+		} else {
+			if len(chunks) > 0 {
+				log.Success("successfully wrote metadata")
+			}
+			trailer = len(trailing)
+		}
+	}
+
+	if ws, ok := w.(io.WriteSeeker); ok && rec.format != formatRaw {
+		log.Info("filling in missing sizes")
+
+		if err := fillSizes(ws, rec.format, rec.pcmFormat, numSamples, trailer); err != nil {
+			fail(fmt.Errorf("failed to fill in missing sizes : %v", err))
+		} else {
+			log.Success("successfully filled in missing sizes.")
+		}
+	}
+	return first
 }
 
-func writeCommonChunk(f *os.File) error {
-	// http://paulbourke.net/dataformats/audio/
+// trailingPad returns the pad byte that follows numSamples samples of a recording
+// with a header, which raw recordings don't need.
+func (rec recording) trailingPad(numSamples int) []byte {
+	if rec.format == formatRaw {
+		return nil
+	}
+	return rec.dataPad(numSamples)
+}
 
-	sr := []byte{0x40, 0x0e, 0xac, 0x44, 0, 0, 0, 0, 0, 0}
+// writeHeader writes the chunks that precede the sample data for the given format.
+func writeHeader(w io.Writer, format string, pf pcmFormat) error {
+	if format == formatRaw {
+		return nil
+	}
 
-	// header
-	if _, err := f.WriteString("COMM"); err != nil {
-		return err
+	if format == formatWAV {
+		if err := writeRiffChunk(w); err != nil {
+			return fmt.Errorf("failed to write riff chunk : %v", err)
+		}
+
+		log.Success("successfully wrote riff chunk")
+
+		if err := writeFmtChunk(w, pf); err != nil {
+			return fmt.Errorf("failed to write fmt chunk : %v", err)
+		}
+
+		log.Success("successfully wrote fmt chunk")
+
+		if err := writeDataChunk(w); err != nil {
+			return fmt.Errorf("failed to write data chunk : %v", err)
+		}
+
+		log.Success("successfully wrote data chunk")
+		return nil
 	}
-	// size
-	if err := binary.Write(f, binary.BigEndian, int32(18)); err != nil {
-		return err
+
+	if err := writeFormChunk(w, pf); err != nil {
+		return fmt.Errorf("failed to write form chunk : %v", err)
 	}
-	// channels
-	if err := binary.Write(f, binary.BigEndian, int16(1)); err != nil {
-		return err
+
+	log.Success("successfully wrote form chunk")
+
+	if aifcExtra(pf) > 0 {
+		if err := writeVersionChunk(w); err != nil {
+			return fmt.Errorf("failed to write version chunk : %v", err)
+		}
+
+		log.Success("successfully wrote version chunk")
 	}
-	// number of samples
-	if err := binary.Write(f, binary.BigEndian, int32(0)); err != nil {
-		return err
+
+	if err := writeCommonChunk(w, pf); err != nil {
+		return fmt.Errorf("failed to write common chunk : %v", err)
 	}
-	// bits per sample
-	if err := binary.Write(f, binary.BigEndian, int16(32)); err != nil {
-		return err
+
+	log.Success("successfully wrote common chunk")
+
+	if err := writeSoundChunk(w); err != nil {
+		return fmt.Errorf("failed to write sound chunk : %v", err)
 	}
-	//80-bit sample rate 44100
-	if _, err := f.Write(sr); err != nil {
-		return err
+
+	log.Success("successfully wrote sound chunk")
+	return nil
+}
+
+// The --latency hints, which pick the device's default low or high input latency.
+const (
+	latencyLow  = "low"
+	latencyHigh = "high"
+)
+
+// latencyUsage is the help of the --latency flag of the commands that capture.
+const latencyUsage = "Input latency the stream asks the device for, low or high. Low latency buffers less audio in the device, " +
+	"which suits monitoring but drops audio when the system is busy. High latency is safer for long unattended recordings."
+
+// checkLatency returns an error unless latency is a --latency hint.
+func checkLatency(latency string) error {
+	if latency != latencyLow && latency != latencyHigh {
+		return fmt.Errorf("unsupported latency %q : must be %s or %s", latency, latencyLow, latencyHigh)
 	}
 	return nil
 }
 
-func writeSoundChunk(f *os.File) error {
-	// http://paulbourke.net/dataformats/audio/
+// streamOptions pick the input device a stream is opened on and how it's configured.
+type streamOptions struct {
+	device string
+	// hostAPI, when set, limits the devices to those of that host API.
+	hostAPI  string
+	loopback bool
+	// lowLatency asks for the device's low input latency instead of its high one.
+	lowLatency bool
+}
 
-	// header
-	if _, err := f.WriteString("SSND"); err != nil {
-		return err
+// streamOptions returns the options rec opens its input stream with.
+func (rec recording) streamOptions() streamOptions {
+	return streamOptions{device: rec.device, hostAPI: rec.hostAPI, loopback: rec.loopback, lowLatency: rec.lowLatency}
+}
+
+// openStream opens an input stream on the first loopback device when
+// loopback is set, otherwise on the named device, or on the default input
+// device when device is empty. With a host API, the device is looked for
+// among that host API's devices and the default is the host API's default.
+func openStream(opts streamOptions, pf pcmFormat, framesPerBuffer int, in interface{}) (*portaudio.Stream, error) {
+	var api *portaudio.HostApiInfo
+	var err error
+	if opts.hostAPI != "" {
+		if api, err = resolveHostAPI(opts.hostAPI); err != nil {
+			return nil, err
+		}
 	}
-	// size
-	if err := binary.Write(f, binary.BigEndian, int32(0)); err != nil {
-		return err
+
+	var dev *portaudio.DeviceInfo
+	switch {
+	case opts.loopback:
+		dev, err = findLoopbackDevice(api)
+	case opts.device != "":
+		dev, err = resolveDevice(opts.device, api)
+	case api != nil:
+		dev, err = hostAPIInputDevice(api)
+	default:
+		dev, err = defaultInputDevice()
 	}
-	// offset
-	if err := binary.Write(f, binary.BigEndian, int32(0)); err != nil {
-		return err
+	if err != nil {
+		return nil, err
 	}
-	// block
-	if err := binary.Write(f, binary.BigEndian, int32(0)); err != nil {
-		return err
+
+	if api != nil {
+		log.Info("using input device %q of %s", dev.Name, api.Name)
+	} else if opts.device != "" || opts.loopback {
+		log.Info("using input device %q", dev.Name)
+	}
+
+	if pf.channels > dev.MaxInputChannels {
+		return nil, fmt.Errorf("input device %q has %d input channels, fewer than the %d needed", dev.Name, dev.MaxInputChannels, pf.channels)
+	}
+
+	p := portaudio.HighLatencyParameters(dev, nil)
+	if opts.lowLatency {
+		p = portaudio.LowLatencyParameters(dev, nil)
+	}
+	log.Info("requesting an input latency of %s", p.Input.Latency)
+	p.Input.Channels = pf.channels
+	p.SampleRate = float64(pf.sampleRate)
+	p.FramesPerBuffer = framesPerBuffer
+	return portaudio.OpenStream(p, in)
+}
+
+// headerSize returns the number of bytes writeHeader writes for format and pf.
+func headerSize(format string, pf pcmFormat) int64 {
+	switch format {
+	case formatAIFF:
+		return aiffHeaderSize + int64(aifcExtra(pf))
+	case formatWAV:
+		return wavHeaderSize
+	}
+	return 0
+}
+
+// fillSizes writes the size fields of the header that are only known once
+// recording has finished, counting trailer bytes of padding and chunks after
+// the sample data. Every failed seek or write is reported.
+func fillSizes(w io.WriteSeeker, format string, pf pcmFormat, numSamples, trailer int) error {
+	fields, order := aiffSizes(pf, numSamples, trailer), binary.ByteOrder(binary.BigEndian)
+	if format == formatWAV {
+		fields, order = wavSizes(pf, numSamples, trailer), binary.LittleEndian
+	}
+
+	var errs []string
+	for _, field := range fields {
+		if _, err := w.Seek(field.offset, io.SeekStart); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to seek to %s : %v", field.name, err))
+			continue
+		}
+
+		if err := binary.Write(w, order, field.value); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to write %s : %v", field.name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
 	}
 	return nil
 }
@@ -0,0 +1,561 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// fakeCaptureDevice captures a ramp of 16 bit samples, or buffers in turn
+// followed by silence when it's set, and sends a signal once it has filled
+// signalAfter buffers when signals is set. onRead, when set, is called with
+// the number of buffers filled after each one. The reads counted from 1 in
+// failReads fail without filling the buffer, and opening the stream fails
+// with openErr when it's set.
+type fakeCaptureDevice struct {
+	buf     []int16
+	next    int16
+	reads   int
+	buffers [][]int16
+
+	failReads        map[int]bool
+	attempts, starts int
+	openErr          error
+	terminated       bool
+
+	signals     chan os.Signal
+	signalAfter int
+
+	onRead func(reads int)
+}
+
+func (d *fakeCaptureDevice) Initialize() error { return nil }
+
+func (d *fakeCaptureDevice) OpenStream(opts streamOptions, pf pcmFormat, framesPerBuffer int, buf interface{}) error {
+	if d.openErr != nil {
+		return d.openErr
+	}
+	d.buf = buf.([]int16)
+	return nil
+}
+
+func (d *fakeCaptureDevice) Start() error {
+	d.starts++
+	return nil
+}
+
+func (d *fakeCaptureDevice) Read() error {
+	if d.attempts++; d.failReads[d.attempts] {
+		return errors.New("device unavailable")
+	}
+
+	switch {
+	case d.buffers == nil:
+		for i := range d.buf {
+			d.buf[i] = d.next
+			d.next++
+		}
+	case d.reads < len(d.buffers):
+		copy(d.buf, d.buffers[d.reads])
+	default:
+		for i := range d.buf {
+			d.buf[i] = 0
+		}
+	}
+
+	d.reads++
+	if d.signals != nil && d.reads == d.signalAfter {
+		d.signals <- os.Interrupt
+	}
+	if d.onRead != nil {
+		d.onRead(d.reads)
+	}
+	return nil
+}
+
+func (d *fakeCaptureDevice) Available() (int, error) { return 0, nil }
+func (d *fakeCaptureDevice) Stop() error             { return nil }
+func (d *fakeCaptureDevice) Close() error            { return nil }
+func (d *fakeCaptureDevice) Terminate() error {
+	d.terminated = true
+	return nil
+}
+
+// checkFinalized checks that the recording in f holds frames frames of the
+// ramp the fake device captures, and that its header sizes match them and
+// count each frame of rec.channels samples once.
+func checkFinalized(t *testing.T, f *memoryFile, rec recording, frames int) {
+	t.Helper()
+	checkFinalizedFrom(t, f, rec, 0, frames)
+}
+
+// checkFinalizedFrom is checkFinalized for a recording whose ramp starts at frame first.
+func checkFinalizedFrom(t *testing.T, f *memoryFile, rec recording, first, frames int) {
+	t.Helper()
+
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	af, err := readHeader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := af.sizeWarnings(int64(len(f.Bytes()))); len(w) > 0 {
+		t.Errorf("header sizes don't match the file : %v", w)
+	}
+	if af.numFrames != frames {
+		t.Errorf("header records %d frames, want %d", af.numFrames, frames)
+	}
+	if af.channels != rec.channels {
+		t.Errorf("header records %d channels, want %d", af.channels, rec.channels)
+	}
+	if samples := int(af.dataSize) / af.bytesPerSample(); af.numFrames != af.frames(samples) {
+		t.Errorf("header records %d frames for %d samples of %d channels, want %d", af.numFrames, samples, af.channels, af.frames(samples))
+	}
+	if want := int64(frames * rec.channels * rec.bytesPerSample()); af.dataSize != want {
+		t.Errorf("header records %d bytes of samples, want %d", af.dataSize, want)
+	}
+
+	buf := make([]int32, frames*rec.channels)
+	n, err := readSamples(f, af.sampleOrder(), af.pcmFormat, buf)
+	if err != nil || n != len(buf) {
+		t.Fatalf("read %d of %d samples : %v", n, len(buf), err)
+	}
+	for i, v := range buf {
+		if want := int32(int16(first*rec.channels+i)) << 16; v != want {
+			t.Fatalf("sample %d is %d, want %d", i, v, want)
+		}
+	}
+}
+
+func TestRecordStopFinalizes(t *testing.T) {
+	const buffer, buffers = 64, 5
+
+	tests := []struct {
+		name   string
+		format string
+		signal bool
+		// frames is the frame limit and the frames recorded, or buffers
+		// buffers when it's 0.
+		frames int
+	}{
+		{name: "signal wav", format: formatWAV, signal: true},
+		{name: "signal aiff", format: formatAIFF, signal: true},
+		{name: "frame limit wav", format: formatWAV},
+		{name: "frame limit aiff", format: formatAIFF},
+		{name: "partial buffer frame limit wav", format: formatWAV, frames: buffers*buffer - buffer/2 - 1},
+		{name: "partial buffer frame limit aiff", format: formatAIFF, frames: buffers*buffer - buffer/2 - 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := binary.ByteOrder(binary.BigEndian)
+			if tt.format == formatWAV {
+				order = binary.LittleEndian
+			}
+
+			dev := &fakeCaptureDevice{}
+			rec := recording{
+				format:    tt.format,
+				order:     order,
+				pcmFormat: pcmFormat{sampleRate: 8000, channels: 2, bitDepth: 16},
+				buffer:    buffer,
+				gain:      1,
+				dev:       dev,
+			}
+
+			frames := tt.frames
+			if frames == 0 {
+				frames = buffers * buffer
+			}
+
+			wantReason := stopFrames
+			if tt.signal {
+				rec.signals = make(chan os.Signal, 1)
+				dev.signals, dev.signalAfter = rec.signals, buffers
+				wantReason = stopSignal
+			} else {
+				rec.maxFrames = frames
+			}
+
+			f := &memoryFile{}
+			stats, err := record(f, rec)
+			if _, interrupted := err.(interruptedError); tt.signal != interrupted || (!tt.signal && err != nil) {
+				t.Fatalf("record returned %v", err)
+			}
+			if stats.stopReason != wantReason {
+				t.Errorf("stopped by %q, want %q", stats.stopReason, wantReason)
+			}
+			if rec.frames(stats.samples) != frames {
+				t.Errorf("recorded %d samples, or %d frames of %d channels, want %d frames", stats.samples, rec.frames(stats.samples), rec.channels, frames)
+			}
+
+			checkFinalized(t, f, rec, frames)
+		})
+	}
+}
+
+// fullFile is a memoryFile that fails writes past limit bytes, like a full disk.
+type fullFile struct {
+	memoryFile
+	limit int64
+}
+
+func (f *fullFile) Write(p []byte) (int, error) {
+	if f.off+int64(len(p)) > f.limit {
+		return 0, errors.New("no space left on device")
+	}
+	return f.memoryFile.Write(p)
+}
+
+func TestRecordWriteErrorStops(t *testing.T) {
+	rec := recording{
+		format:    formatWAV,
+		order:     binary.LittleEndian,
+		pcmFormat: pcmFormat{sampleRate: 8000, channels: 1, bitDepth: 16},
+		buffer:    64,
+		gain:      1,
+		dev:       &fakeCaptureDevice{},
+	}
+
+	f := &fullFile{limit: 1024}
+	stats, err := record(f, rec)
+	if err == nil {
+		t.Fatal("record succeeded writing to a full file")
+	}
+	if stats.stopReason != stopWriteError {
+		t.Errorf("stopped by %q, want %q", stats.stopReason, stopWriteError)
+	}
+}
+
+// brokenSeekFile is a memoryFile that can't seek back to fill in its header.
+type brokenSeekFile struct{ memoryFile }
+
+func (f *brokenSeekFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, errors.New("seek failed")
+}
+
+func TestRecordFinalizeErrorFails(t *testing.T) {
+	rec := recording{
+		format:    formatWAV,
+		order:     binary.LittleEndian,
+		pcmFormat: pcmFormat{sampleRate: 8000, channels: 1, bitDepth: 16},
+		buffer:    64,
+		maxFrames: 256,
+		gain:      1,
+		dev:       &fakeCaptureDevice{},
+	}
+
+	if _, err := record(&brokenSeekFile{}, rec); err == nil {
+		t.Fatal("record succeeded without filling in the header sizes")
+	}
+}
+
+func TestRecordControls(t *testing.T) {
+	const buffer = 16
+
+	// ramp returns the samples the fake device captures in buffer n, counting from 1.
+	ramp := func(n int) []int16 {
+		s := make([]int16, buffer)
+		for i := range s {
+			s[i] = int16((n-1)*buffer + i)
+		}
+		return s
+	}
+	silence := make([]int16, buffer)
+
+	tests := []struct {
+		name string
+		// at sends a control once the device has filled that many buffers.
+		at   map[int]func(c *controls)
+		want [][]int16
+		// muted and cues are the muted frames and cue frames expected.
+		muted int
+		cues  []int
+	}{
+		{
+			name:  "mute",
+			at:    map[int]func(c *controls){2: toggleMute, 4: toggleMute},
+			want:  [][]int16{ramp(1), ramp(2), silence, silence, ramp(5), ramp(6)},
+			muted: 2 * buffer,
+			cues:  []int{0, 6 * buffer},
+		},
+		{
+			name: "pause",
+			at:   map[int]func(c *controls){2: togglePause, 4: togglePause},
+			want: [][]int16{ramp(1), ramp(2), ramp(5), ramp(6)},
+			cues: []int{0, 2 * buffer, 2 * buffer, 4 * buffer},
+		},
+		{
+			name: "marker",
+			at:   map[int]func(c *controls){3: func(c *controls) { c.markers <- "" }},
+			want: [][]int16{ramp(1), ramp(2), ramp(3), ramp(4), ramp(5), ramp(6)},
+			cues: []int{0, 3 * buffer, 6 * buffer},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctl := newControls()
+			dev := &fakeCaptureDevice{onRead: func(reads int) {
+				if fn := tt.at[reads]; fn != nil {
+					fn(ctl)
+				}
+				if reads == 6 {
+					ctl.done <- true
+				}
+			}}
+			rec := recording{
+				format:    formatRaw,
+				order:     binary.LittleEndian,
+				pcmFormat: pcmFormat{sampleRate: 8000, channels: 1, bitDepth: 16},
+				buffer:    buffer,
+				gain:      1,
+				cue:       true,
+				dev:       dev,
+				controls:  ctl,
+			}
+
+			f := &memoryFile{}
+			stats, err := record(f, rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.stopReason != stopInput {
+				t.Errorf("stopped by %q, want %q", stats.stopReason, stopInput)
+			}
+			if stats.mutedFrames != tt.muted {
+				t.Errorf("muted %d frames, want %d", stats.mutedFrames, tt.muted)
+			}
+
+			var want []byte
+			for _, b := range tt.want {
+				for _, s := range b {
+					want = append(want, byte(s), byte(s>>8))
+				}
+			}
+			if got := f.Bytes(); string(got) != string(want) {
+				t.Errorf("recorded %d bytes that don't match the %d expected", len(got), len(want))
+			}
+
+			var cues []int
+			for _, c := range stats.cues {
+				cues = append(cues, c.frame)
+			}
+			if fmt.Sprint(cues) != fmt.Sprint(tt.cues) {
+				t.Errorf("cues at frames %v, want %v", cues, tt.cues)
+			}
+		})
+	}
+}
+
+func toggleMute(c *controls)  { c.mute <- true }
+func togglePause(c *controls) { c.pause <- true }
+
+func TestRecordPrebuffer(t *testing.T) {
+	quiet := [][]int16{{1, 2, 3, 4}, {5, 6, 7, 8}, {9, 10, 11, 12}, {13, 14, 15, 16}}
+	loud := [][]int16{{20000, 20001, 20002, 20003}, {20004, 20005, 20006, 20007}}
+
+	rec := recording{
+		format:    formatRaw,
+		order:     binary.LittleEndian,
+		pcmFormat: pcmFormat{sampleRate: 8000, channels: 1, bitDepth: 16},
+		buffer:    4,
+		gain:      1,
+		// 8 frames before the sound, the loud buffers after it.
+		startOnSound:     true,
+		silenceThreshold: 0.5,
+		prebuffer:        time.Millisecond,
+		maxFrames:        16,
+		dev:              &fakeCaptureDevice{buffers: append(quiet, loud...)},
+	}
+
+	f := &memoryFile{}
+	if _, err := record(f, rec); err != nil {
+		t.Fatal(err)
+	}
+
+	// the last two quiet buffers precede the trigger, the first ones are dropped.
+	want := []int16{9, 10, 11, 12, 13, 14, 15, 16, 20000, 20001, 20002, 20003, 20004, 20005, 20006, 20007}
+	got := make([]int16, len(f.Bytes())/2)
+	for i := range got {
+		got[i] = int16(binary.LittleEndian.Uint16(f.Bytes()[2*i:]))
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("recorded %v, want %v", got, want)
+	}
+}
+
+func TestRecordTrimOffsets(t *testing.T) {
+	tests := []struct {
+		name               string
+		format             string
+		trimStart, trimEnd int
+	}{
+		{name: "wav start and end", format: formatWAV, trimStart: 50, trimEnd: 30},
+		{name: "aiff start and end", format: formatAIFF, trimStart: 50, trimEnd: 30},
+		{name: "wav start", format: formatWAV, trimStart: 1},
+		{name: "aiff end", format: formatAIFF, trimEnd: 319},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := binary.ByteOrder(binary.BigEndian)
+			if tt.format == formatWAV {
+				order = binary.LittleEndian
+			}
+
+			rec := recording{
+				format:    tt.format,
+				order:     order,
+				pcmFormat: pcmFormat{sampleRate: 8000, channels: 2, bitDepth: 16},
+				buffer:    64,
+				maxFrames: 320,
+				gain:      1,
+				trimStart: tt.trimStart,
+				trimEnd:   tt.trimEnd,
+				dev:       &fakeCaptureDevice{},
+			}
+
+			f := &memoryFile{}
+			if _, err := record(f, rec); err != nil {
+				t.Fatal(err)
+			}
+			checkFinalizedFrom(t, f, rec, tt.trimStart, 320-tt.trimStart-tt.trimEnd)
+		})
+	}
+}
+
+// TestRecordMaxBytes checks that a size limit that doesn't end on a frame
+// stops the recording with the most frames that fit, which leaves the file
+// short of the limit by less than a frame and never past it.
+func TestRecordMaxBytes(t *testing.T) {
+	const frameBytes = 2 * 2
+
+	for _, format := range []string{formatWAV, formatAIFF} {
+		t.Run(format, func(t *testing.T) {
+			order := binary.ByteOrder(binary.BigEndian)
+			if format == formatWAV {
+				order = binary.LittleEndian
+			}
+
+			rec := recording{
+				format:    format,
+				order:     order,
+				pcmFormat: pcmFormat{sampleRate: 8000, channels: 2, bitDepth: 16},
+				buffer:    64,
+				gain:      1,
+				dev:       &fakeCaptureDevice{},
+			}
+			rec.maxBytes = headerSize(format, rec.pcmFormat) + 250*frameBytes + 3
+
+			f := &memoryFile{}
+			stats, err := record(f, rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.stopReason != stopSizeLimit {
+				t.Errorf("stopped by %q, want %q", stats.stopReason, stopSizeLimit)
+			}
+
+			size := int64(len(f.Bytes()))
+			if size > rec.maxBytes || rec.maxBytes-size >= frameBytes {
+				t.Errorf("recording is %d bytes, want within a frame under the limit of %d", size, rec.maxBytes)
+			}
+			checkFinalized(t, f, rec, 250)
+		})
+	}
+}
+
+// TestRecordReadRetry checks that failed reads are retried after restarting
+// the device, so that the ramp goes on without a gap, and that a recording
+// that can't be read from anymore still stops with everything before the
+// failures finalized.
+func TestRecordReadRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		failReads []int
+		// frames is the frames recorded, of the 320 asked for.
+		frames int
+		// starts counts the start of the stream and every restart.
+		starts  int
+		aborted bool
+	}{
+		{name: "recovers", failReads: []int{3}, frames: 320, starts: 2},
+		{name: "intermittent", failReads: []int{2, 3, 5}, frames: 320, starts: 4},
+		{name: "aborts", failReads: []int{3, 4, 5, 6}, frames: 128, starts: 4, aborted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dev := &fakeCaptureDevice{failReads: map[int]bool{}}
+			for _, n := range tt.failReads {
+				dev.failReads[n] = true
+			}
+			rec := recording{
+				format:    formatWAV,
+				order:     binary.LittleEndian,
+				pcmFormat: pcmFormat{sampleRate: 8000, channels: 2, bitDepth: 16},
+				buffer:    64,
+				maxFrames: 320,
+				gain:      1,
+				dev:       dev,
+			}
+
+			f := &memoryFile{}
+			stats, err := record(f, rec)
+			if tt.aborted != (err != nil) {
+				t.Fatalf("record returned %v", err)
+			}
+			wantReason := stopFrames
+			if tt.aborted {
+				wantReason = stopReadError
+			}
+			if stats.stopReason != wantReason {
+				t.Errorf("stopped by %q, want %q", stats.stopReason, wantReason)
+			}
+			if stats.readErrors != len(tt.failReads) {
+				t.Errorf("counted %d read errors, want %d", stats.readErrors, len(tt.failReads))
+			}
+			if dev.starts != tt.starts {
+				t.Errorf("stream was started %d times, want %d", dev.starts, tt.starts)
+			}
+
+			checkFinalized(t, f, rec, tt.frames)
+		})
+	}
+}
+
+// TestRecordNoInputDevice checks that a device that can't be opened because
+// it's gone or in use fails the recording with an error that tells the user
+// how to pick another, and that portaudio is still terminated.
+func TestRecordNoInputDevice(t *testing.T) {
+	for name, openErr := range map[string]error{"invalid": portaudio.InvalidDevice, "unavailable": portaudio.DeviceUnavailable} {
+		t.Run(name, func(t *testing.T) {
+			dev := &fakeCaptureDevice{openErr: openErr}
+			rec := recording{
+				format:    formatWAV,
+				order:     binary.LittleEndian,
+				pcmFormat: pcmFormat{sampleRate: 8000, channels: 2, bitDepth: 16},
+				buffer:    64,
+				gain:      1,
+				dev:       dev,
+			}
+
+			_, err := record(&memoryFile{}, rec)
+			if err == nil || !strings.Contains(err.Error(), noInputDeviceHint) {
+				t.Errorf("record returned %v, want an error that says to %s", err, noInputDeviceHint)
+			}
+			if !dev.terminated {
+				t.Error("portaudio wasn't terminated")
+			}
+		})
+	}
+}
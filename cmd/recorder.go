@@ -0,0 +1,417 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// recorder holds the state of a recording while record captures it.
+type recorder struct {
+	rec   recording
+	stats *recordStats
+
+	// enc may only be changed between a sync of wr and its next write.
+	enc Encoder
+	wr  *asyncWriter
+
+	src           input
+	captureFormat pcmFormat
+	// in is the buffer the input is read into and frames the int32
+	// buffer it's processed in, which are the same for 32 bit input.
+	in     interface{}
+	frames []int32
+	proc   *processor
+
+	lvl   *meter
+	timer *durationTimer
+	limit sampleLimit
+
+	silence silenceWatch
+	zero    zeroWatch
+	trigger soundTrigger
+
+	// ring, when set, holds what's captured in place of writing it.
+	ring *sampleRing
+
+	paused bool
+	// muted writes silence in place of what's captured, so
+	// the recording keeps time while its content is left out.
+	muted bool
+	// marked counts markers, which are numbered when they aren't named.
+	marked int
+
+	// segmentStart is where the samples of the current output begin.
+	segmentStart int
+
+	// buffers counts captured buffers for --verbose, which logs
+	// one at most every verboseInterval so it doesn't flood the log.
+	buffers     int
+	started     time.Time
+	lastVerbose time.Time
+}
+
+// step reads the next buffer from the input, or drops it while paused,
+// and returns why the recording has to stop when it does, with the error
+// that stopped it.
+func (r *recorder) step() (string, error) {
+	// the input keeps capturing while paused, so its
+	// buffers are read and dropped to keep it from overflowing.
+	if r.paused {
+		_, err := readInput(r.src, &r.stats.readErrors)
+		if err == io.EOF {
+			log.Info("reached the end of %s", r.rec.inputFile)
+			return stopEndOfInput, nil
+		}
+		if err != nil && err != portaudio.InputOverflowed {
+			return stopReadError, err
+		}
+		return "", nil
+	}
+
+	peak, err := r.capture()
+	if err == io.EOF {
+		r.lvl.clear()
+		log.Info("reached the end of %s", r.rec.inputFile)
+		return stopEndOfInput, nil
+	}
+	if err != nil {
+		r.lvl.clear()
+		return stopReadError, err
+	}
+	if err := r.wr.failed(); err != nil {
+		r.lvl.clear()
+		return stopWriteError, err
+	}
+	if r.limit.full && r.limit.frames {
+		r.lvl.clear()
+		log.Info("reached %d frames", r.rec.maxFrames)
+		return stopFrames, nil
+	}
+	if r.limit.full {
+		r.lvl.clear()
+		log.Info("reached the size limit of %d bytes", r.rec.maxBytes)
+		return stopSizeLimit, nil
+	}
+	if r.zero.dead() {
+		r.lvl.clear()
+		return stopDeadInput, fmt.Errorf("aborted after the input was exactly zero for %s, the device was probably disconnected", r.rec.zeroTimeout)
+	}
+	r.lvl.render(peak)
+
+	if !r.trigger.waiting && r.silence.add(peak, r.rec.buffer) {
+		r.lvl.clear()
+		log.Info("input was silent for %s", r.rec.silenceDuration)
+		return stopSilence, nil
+	}
+	return "", nil
+}
+
+// capture reads the next buffer from the input, encodes it
+// and returns its peak level. It returns io.EOF once the input
+// ends, or an error once it can't be read from anymore.
+func (r *recorder) capture() (float64, error) {
+	// an overflow still fills the buffer, but audio
+	// captured before it was discarded.
+	n, err := readInput(r.src, &r.stats.readErrors)
+	switch {
+	case err == io.EOF:
+		return 0, err
+	case err == portaudio.InputOverflowed:
+		r.stats.overflows++
+	case err != nil:
+		return 0, err
+	}
+
+	buf := truncateBuffer(r.in, n)
+	r.zero.add(buf, r.captureFormat.frames(n))
+
+	buf, out := r.proc.process(buf, n, r.muted, &r.stats.gainClamped)
+
+	peak := peakLevel(buf)
+	if !r.trigger.hold(peak, out) {
+		if r.trigger.waiting {
+			r.lvl.clear()
+			r.trigger.release(len(r.frames), r.emit)
+		}
+		r.emit(out)
+	}
+
+	r.stats.capturedFrames += r.captureFormat.frames(n)
+	r.stats.clippedFrames += clippedFrames(buf, r.captureFormat.channels)
+	r.stats.levels.add(buf)
+	r.buffers++
+
+	if r.rec.verbose && time.Since(r.lastVerbose) >= verboseInterval {
+		r.lastVerbose = time.Now()
+		r.lvl.clear()
+		log.Info("buffer %d : peak %.1f%% of full scale, %d bytes of samples written, %s elapsed",
+			r.buffers, 100*peak, r.stats.samples*r.rec.bytesPerSample(), r.lastVerbose.Sub(r.started).Round(time.Millisecond))
+	}
+	return peak, nil
+}
+
+// emit writes processed samples to the output, or to the ring with
+// --retroactive, cutting them off at the limit of the recording.
+func (r *recorder) emit(out []int32) {
+	out = r.limit.cut(out, r.stats.samples)
+
+	if r.muted {
+		r.stats.mutedFrames += r.rec.frames(len(out))
+	}
+	if r.ring != nil {
+		r.ring.write(out)
+	} else {
+		r.wr.write(out)
+		r.stats.samples += len(out)
+	}
+}
+
+// togglePause pauses or resumes the recording, which
+// stops counting toward its duration while it's paused.
+func (r *recorder) togglePause() {
+	r.lvl.clear()
+	r.paused = !r.paused
+
+	if r.paused {
+		r.timer.pause()
+		log.Info("paused, type p and press enter to resume")
+	} else {
+		r.timer.resume()
+		log.Info("resumed")
+	}
+
+	if r.rec.cue {
+		name := cueResume
+		if r.paused {
+			name = cuePause
+		}
+		r.addCue(name, r.paused)
+	}
+}
+
+// toggleMute mutes or unmutes the recording.
+func (r *recorder) toggleMute() {
+	r.lvl.clear()
+	r.muted = !r.muted
+
+	at := float64(r.rec.frames(r.stats.samples)) / float64(r.rec.sampleRate)
+	if r.muted {
+		log.Info("muted at %.3fs, type m and press enter to unmute", at)
+	} else {
+		log.Info("unmuted at %.3fs", at)
+	}
+}
+
+// mark adds a marker cue called name, or numbered when name is empty.
+func (r *recorder) mark(name string) {
+	r.lvl.clear()
+	r.marked++
+	if name == "" {
+		name = fmt.Sprintf("marker %d", r.marked)
+	}
+
+	c := r.addCue(name, r.paused)
+	log.Info("marked %s at %.3fs", name, float64(c.frame)/float64(r.rec.sampleRate))
+}
+
+// addCue records name at the frame being captured now. Buffers the
+// input is still holding were captured before now, so they count
+// unless they're about to be dropped by a pause.
+func (r *recorder) addCue(name string, paused bool) cuePoint {
+	pending := 0
+	if !paused {
+		if n, err := r.src.Available(); err == nil {
+			pending = n
+		}
+	}
+
+	c := cuePoint{time: time.Now(), frame: r.rec.cueFrame(r.stats.samples, pending), name: name}
+	r.stats.cues = append(r.stats.cues, c)
+	return c
+}
+
+// lowDisk reports whether the recording has to stop before the
+// filesystem holding rec.spaceDir fills up.
+func (r *recorder) lowDisk() (bool, error) {
+	free, err := freeSpace(r.rec.spaceDir)
+	if err != nil {
+		return false, err
+	}
+
+	if free >= r.rec.minFree {
+		return false, nil
+	}
+
+	r.lvl.clear()
+	log.Error("only %s is free in %s, stopping the recording before the disk fills up", formatSize(free), r.rec.spaceDir)
+	return true, nil
+}
+
+// flushSizes fills in the header sizes for what's been captured so far, for encoders that can.
+func (r *recorder) flushSizes() {
+	// the encoder can only be used here once the writer's caught up.
+	if sf, ok := r.enc.(sizeFlusher); ok {
+		r.wr.sync()
+		if err := sf.flushSizes(); err != nil {
+			log.Error("failed to flush header sizes : %v", err)
+		}
+	}
+}
+
+// outputSize returns the size of the output so far, or -1 for
+// compressed output, whose size isn't known until the encoder writes it.
+func (r *recorder) outputSize() int64 {
+	if ef, _ := lookupEncoder(r.rec.format); !ef.pcm {
+		return -1
+	}
+	return headerSize(r.rec.format, r.rec.pcmFormat) + int64((r.stats.samples+r.ring.len())*r.rec.bytesPerSample())
+}
+
+// split finishes the output once it holds rec.splitFrames frames and
+// continues the recording in the next segment.
+func (r *recorder) split() error {
+	if r.rec.splitFrames == 0 || r.rec.frames(r.stats.samples-r.segmentStart) < r.rec.splitFrames {
+		return nil
+	}
+
+	r.lvl.clear()
+	r.wr.sync()
+	err := r.enc.Finalize()
+	r.enc = nil
+	if err != nil {
+		return err
+	}
+
+	next, err := r.rec.nextSegment()
+	if err != nil {
+		return fmt.Errorf("failed to start the next segment : %v", err)
+	}
+
+	r.segmentStart = r.stats.samples
+	if r.enc, err = newEncoder(next, r.rec); err != nil {
+		return err
+	}
+
+	if err := r.enc.WriteHeader(); err != nil {
+		return err
+	}
+	r.wr.enc = r.enc
+	return nil
+}
+
+// finish keeps the audio the input captured before the recording
+// stopped but hasn't been read yet, unless it stopped because of
+// stopErr, and writes what the ring holds.
+func (r *recorder) finish(stopErr error) {
+	for !r.paused && !r.limit.full && stopErr == nil {
+		if n, err := r.src.Available(); err != nil || n < r.rec.buffer {
+			break
+		}
+		r.capture()
+	}
+
+	if r.ring != nil {
+		log.Info("writing the last %s captured", time.Duration(float64(r.rec.frames(r.ring.len()))/float64(r.rec.sampleRate)*float64(time.Second)).Round(time.Millisecond))
+		r.ring.drain(len(r.frames), func(samples []int32) {
+			r.wr.write(samples)
+			r.stats.samples += len(samples)
+		})
+	}
+
+	log.Info("recording stopped")
+	log.Info("captured %d frames", r.rec.frames(r.stats.samples-r.rec.existingSamples))
+
+	if r.rec.cue {
+		r.addCue(cueStop, true)
+	}
+}
+
+// logStats logs how capture went once the recording has stopped.
+func (r *recorder) logStats() {
+	stats := r.stats
+	if stats.overflows > 0 {
+		log.Info("input overflowed %d times, some audio was dropped", stats.overflows)
+	} else {
+		log.Info("no input overflows, capture was clean")
+	}
+
+	if stats.readErrors > 0 {
+		log.Error("%d reads from the input failed, the audio they should have captured is missing", stats.readErrors)
+	}
+
+	if stats.mutedFrames > 0 {
+		log.Info("%d frames were muted", stats.mutedFrames)
+	}
+
+	if r.proc.agc != nil {
+		log.Info("auto gain finished at %+.1f dB", 20*math.Log10(r.proc.agc.Gain()))
+	}
+
+	if stats.gainClamped > 0 {
+		log.Error("a gain of %g pushed %d samples past full scale, consider lowering it", r.rec.gain, stats.gainClamped)
+	}
+
+	if stats.clippedFrames > 0 {
+		log.Error("%d of %d frames (%.2f%%) clipped, consider lowering the input gain",
+			stats.clippedFrames, stats.capturedFrames, 100*float64(stats.clippedFrames)/float64(stats.capturedFrames))
+	}
+
+	// a dead input in a stereo pair is easy to miss by ear.
+	if r.captureFormat.channels > 1 && stats.capturedFrames > 0 {
+		for _, line := range stats.levels.summary() {
+			log.Info("%s", line)
+		}
+	}
+}
+
+// durationTimer stops a recording once it has recorded for a duration,
+// not counting the time it spends paused.
+type durationTimer struct {
+	timer     *time.Timer
+	remaining time.Duration
+	resumed   time.Time
+}
+
+// newDurationTimer returns a durationTimer for d, which never fires when d is zero.
+func newDurationTimer(d time.Duration) *durationTimer {
+	t := &durationTimer{remaining: d, resumed: time.Now()}
+	if d > 0 {
+		t.timer = time.NewTimer(d)
+	}
+	return t
+}
+
+// C receives once the duration has been recorded. It's nil, which never
+// receives, for a zero duration.
+func (t *durationTimer) C() <-chan time.Time {
+	if t.timer == nil {
+		return nil
+	}
+	return t.timer.C
+}
+
+// pause stops counting the recorded time.
+func (t *durationTimer) pause() {
+	if t.timer != nil && t.timer.Stop() {
+		t.remaining -= time.Since(t.resumed)
+	}
+}
+
+// resume carries on counting the recorded time.
+func (t *durationTimer) resume() {
+	if t.timer != nil {
+		t.timer.Reset(t.remaining)
+	}
+	t.resumed = time.Now()
+}
+
+// stop releases the timer.
+func (t *durationTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
@@ -0,0 +1,614 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/fuskovic/audio-recorder/internal/dsp"
+	"github.com/fuskovic/audio-recorder/internal/fft"
+	"github.com/spf13/pflag"
+)
+
+// newRecording checks the flags of cmd, filling in the ones that follow
+// from others, and returns the recording they describe.
+func (cmd *recordCmd) newRecording(fl *pflag.FlagSet) (recording, error) {
+	// an extension in the output name picks the format unless one was given.
+	if cmd.outFile != "" && cmd.outFile != "-" {
+		name, format := splitFormatExt(cmd.outFile)
+		switch {
+		case format == "":
+		case !fl.Changed("format"):
+			cmd.outFile, cmd.format = name, format
+		case format == cmd.format:
+			cmd.outFile = name
+		default:
+			return recording{}, usageErrorf("output name %s has the extension of %s but the format is %s", cmd.outFile, format, cmd.format)
+		}
+	}
+
+	if cmd.streamWAV {
+		if cmd.outFile != "" && cmd.outFile != "-" {
+			return recording{}, usageErrorf("--stream-wav writes to stdout, so it can't be used with --out %s", cmd.outFile)
+		}
+
+		if fl.Changed("format") && cmd.format != formatWAV {
+			return recording{}, usageErrorf("--stream-wav can't be used with --format %s", cmd.format)
+		}
+
+		if cmd.maxBytes > 0 || cmd.maxSize != "" {
+			return recording{}, usageErrorf("--stream-wav can't be used with --max-bytes or --max-size, which hold the recording in memory to fill in its real sizes")
+		}
+		cmd.stdout, cmd.format = true, formatWAV
+	}
+
+	if cmd.quiet && cmd.verbose {
+		return recording{}, usageErrorf("--quiet and --verbose can't be used together")
+	}
+
+	if err := checkLatency(cmd.latency); err != nil {
+		return recording{}, usageError{err}
+	}
+
+	var rawOrder binary.ByteOrder
+	switch cmd.endian {
+	case "big":
+		rawOrder = binary.BigEndian
+	case "little":
+		rawOrder = binary.LittleEndian
+	default:
+		return recording{}, usageErrorf("unsupported byte order %q : must be big or little", cmd.endian)
+	}
+
+	if cmd.aifc && (cmd.format != formatAIFF || cmd.sampleFmt == sampleFormatFloat32) {
+		return recording{}, usageErrorf("--aifc only applies to integer samples with --format %s", formatAIFF)
+	}
+
+	var order binary.ByteOrder
+	switch cmd.format {
+	case formatAIFF:
+		order = binary.BigEndian
+		if cmd.aifc {
+			order = binary.LittleEndian
+		}
+	case formatWAV:
+		order = binary.LittleEndian
+	case formatFLAC, formatOpus, formatMP3:
+		// these encode their own frames, so there's no byte order to pick.
+	case formatRaw:
+		order = rawOrder
+	default:
+		return recording{}, usageErrorf("unsupported format %q : must be %s, %s, %s, %s, %s or %s", cmd.format, formatAIFF, formatWAV, formatFLAC, formatOpus, formatMP3, formatRaw)
+	}
+
+	ef, _ := lookupEncoder(cmd.format)
+
+	switch cmd.sampleFmt {
+	case sampleFormatInt:
+	case sampleFormatFloat32:
+		if !ef.pcm {
+			return recording{}, usageErrorf("--sample-format %s can only be used with --format %s, %s or %s", sampleFormatFloat32, formatAIFF, formatWAV, formatRaw)
+		}
+
+		if fl.Changed("bit-depth") && cmd.bitDepth != 32 {
+			return recording{}, usageErrorf("--sample-format %s holds 32 bit samples, which contradicts --bit-depth %d", sampleFormatFloat32, cmd.bitDepth)
+		}
+		cmd.bitDepth = 32
+	default:
+		return recording{}, usageErrorf("unsupported sample format %q : must be %s or %s", cmd.sampleFmt, sampleFormatInt, sampleFormatFloat32)
+	}
+
+	if cmd.resample < 0 {
+		return recording{}, usageErrorf("invalid resample rate %d : must be positive", cmd.resample)
+	}
+
+	if cmd.format == formatOpus && !fl.Changed("sample-rate") && cmd.resample == 0 {
+		cmd.sampleRate = opusSampleRate
+	}
+
+	// rate is the sample rate of the output, which is only
+	// different from the capture rate when resampling.
+	rate := cmd.sampleRate
+	if cmd.resample > 0 {
+		rate = cmd.resample
+	}
+
+	var channelMap []int
+	if cmd.channelMap != "" {
+		picks, err := parseChannelMap(cmd.channelMap)
+		if err != nil {
+			return recording{}, usageError{err}
+		}
+
+		if fl.Changed("channels") && cmd.channels != len(picks) {
+			return recording{}, usageErrorf("--channel-map %s records %d channels, which contradicts --channels %d", cmd.channelMap, len(picks), cmd.channels)
+		}
+
+		if cmd.inputFile != "" {
+			return recording{}, usageErrorf("--channel-map picks channels of an input device, so it can't be used with --input-file")
+		}
+		channelMap, cmd.channels = picks, len(picks)
+	}
+
+	// channels is the channel count of the output, which is only
+	// different from the captured channels when downmixing.
+	channels := cmd.channels
+	if cmd.downmix {
+		channels = 1
+	}
+
+	if cmd.format == formatOpus && rate != opusSampleRate {
+		return recording{}, usageErrorf("unsupported sample rate %d : %s only records at %d Hz", rate, formatOpus, opusSampleRate)
+	}
+
+	if cmd.format == formatMP3 {
+		if !fl.Changed("bit-depth") {
+			cmd.bitDepth = 16
+		}
+
+		if !validMP3SampleRate(rate) {
+			return recording{}, usageErrorf("unsupported sample rate %d : %s records at %s Hz", rate, formatMP3, joinInts(mp3SampleRates))
+		}
+
+		if channels > mp3MaxChannels {
+			return recording{}, usageErrorf("unsupported channel count %d : %s holds at most %d channels", channels, formatMP3, mp3MaxChannels)
+		}
+	}
+
+	if cmd.bitrate != 0 {
+		switch {
+		case cmd.format != formatMP3 && cmd.format != formatOpus:
+			return recording{}, usageErrorf("--bitrate can only be used with --format %s or %s", formatMP3, formatOpus)
+		case cmd.format == formatMP3 && (cmd.bitrate < 8 || cmd.bitrate > 320):
+			return recording{}, usageErrorf("invalid bitrate %d : %s must be between 8 and 320 kbps", cmd.bitrate, formatMP3)
+		case cmd.format == formatOpus && (cmd.bitrate < 6 || cmd.bitrate > 510):
+			return recording{}, usageErrorf("invalid bitrate %d : %s must be between 6 and 510 kbps", cmd.bitrate, formatOpus)
+		}
+	}
+
+	threads := cmd.threads
+	switch {
+	case threads < 0:
+		return recording{}, usageErrorf("invalid thread count %d : must be positive", threads)
+	case threads > 0 && cmd.format != formatFLAC:
+		return recording{}, usageErrorf("--threads can only be used with --format %s", formatFLAC)
+	case threads == 0:
+		threads = runtime.GOMAXPROCS(0)
+	}
+
+	if cmd.sampleRate <= 0 {
+		return recording{}, usageErrorf("invalid sample rate %d : must be positive", cmd.sampleRate)
+	}
+
+	if cmd.duration < 0 {
+		return recording{}, usageErrorf("invalid duration %s : must not be negative", cmd.duration)
+	}
+
+	if cmd.frames < 0 {
+		return recording{}, usageErrorf("invalid frame count %d : must not be negative", cmd.frames)
+	}
+
+	if cmd.after < 0 {
+		return recording{}, usageErrorf("invalid delay %s : must not be negative", cmd.after)
+	}
+
+	if cmd.loopback && cmd.device != "" {
+		return recording{}, usageErrorf("--loopback and --device can't be used together")
+	}
+
+	if cmd.at != "" && cmd.after > 0 {
+		return recording{}, usageErrorf("--at and --after can't be used together")
+	}
+
+	if cmd.channels <= 0 {
+		return recording{}, usageErrorf("invalid channel count %d : must be positive", cmd.channels)
+	}
+
+	if cmd.downmix && cmd.channels == 1 {
+		return recording{}, usageErrorf("--downmix needs more than one channel to mix, set --channels")
+	}
+
+	if cmd.prebuffer < 0 {
+		return recording{}, usageErrorf("invalid prebuffer %s : must not be negative", cmd.prebuffer)
+	}
+
+	if cmd.prebuffer > 0 && !cmd.startOnSound {
+		return recording{}, usageErrorf("--prebuffer can only be used with --start-on-sound")
+	}
+
+	if cmd.zeroTimeout < 0 {
+		return recording{}, usageErrorf("invalid silence timeout %s : must not be negative", cmd.zeroTimeout)
+	}
+
+	if cmd.stopOnSilence && cmd.silenceDuration <= 0 {
+		return recording{}, usageErrorf("invalid silence duration %s : must be positive", cmd.silenceDuration)
+	}
+
+	if cmd.silenceThreshold < 0 || cmd.silenceThreshold > 1 {
+		return recording{}, usageErrorf("invalid silence threshold %g : must be between 0 and 1", cmd.silenceThreshold)
+	}
+
+	if cmd.noiseGate < 0 || cmd.noiseGate > 1 {
+		return recording{}, usageErrorf("invalid noise gate threshold %g : must be between 0 and 1", cmd.noiseGate)
+	}
+
+	if cmd.noiseGate > 0 && (cmd.gateAttack <= 0 || cmd.gateRelease <= 0) {
+		return recording{}, usageErrorf("invalid noise gate attack %s and release %s : must be positive", cmd.gateAttack, cmd.gateRelease)
+	}
+
+	if cmd.gain < 0 {
+		return recording{}, usageErrorf("invalid gain %g : must not be negative", cmd.gain)
+	}
+
+	if cmd.autoGain && (cmd.autoGainTarget >= 0 || math.IsNaN(cmd.autoGainTarget)) {
+		return recording{}, usageErrorf("invalid auto gain target %g : must be below 0 dBFS", cmd.autoGainTarget)
+	}
+
+	if cmd.autoGain && (cmd.autoGainMax < 0 || math.IsNaN(cmd.autoGainMax)) {
+		return recording{}, usageErrorf("invalid auto gain maximum %g : must not be negative", cmd.autoGainMax)
+	}
+
+	if cmd.highpass < 0 || (cmd.highpass > 0 && cmd.highpass >= float64(cmd.sampleRate)/2) {
+		return recording{}, usageErrorf("invalid high-pass cutoff %g Hz : must be between 0 and half the sample rate", cmd.highpass)
+	}
+
+	if cmd.bitDepth != 16 && cmd.bitDepth != 24 && cmd.bitDepth != 32 {
+		return recording{}, usageErrorf("unsupported bit depth %d : must be 16, 24 or 32", cmd.bitDepth)
+	}
+
+	dither, err := parseDither(cmd.dither)
+	if err != nil {
+		return recording{}, usageError{err}
+	}
+
+	if dither != dsp.DitherNone && (cmd.bitDepth != 16 || cmd.inputFile != "") {
+		return recording{}, usageErrorf("--dither only applies to recordings at --bit-depth 16 captured from an input device")
+	}
+
+	if !containsInt(ef.bitDepths, cmd.bitDepth) {
+		return recording{}, usageErrorf("unsupported bit depth %d : %s only supports %s", cmd.bitDepth, cmd.format, joinInts(ef.bitDepths))
+	}
+
+	if cmd.append && (!ef.pcm || cmd.format == formatRaw) {
+		return recording{}, usageErrorf("can't append to a %s file", cmd.format)
+	}
+
+	if cmd.trim && !ef.pcm {
+		return recording{}, usageErrorf("--trim can't be used with --format %s", cmd.format)
+	}
+
+	trimOffsets := cmd.trimStart > 0 || cmd.trimEnd > 0
+	switch {
+	case cmd.trimStart < 0 || cmd.trimEnd < 0:
+		return recording{}, usageErrorf("invalid trim offsets %s and %s : must not be negative", cmd.trimStart, cmd.trimEnd)
+	case trimOffsets && !ef.pcm:
+		return recording{}, usageErrorf("--trim-start and --trim-end can't be used with --format %s", cmd.format)
+	case trimOffsets && (cmd.append || cmd.split > 0):
+		return recording{}, usageErrorf("--trim-start and --trim-end can't be used with --append or --split-duration")
+	case trimOffsets && cmd.duration > 0 && cmd.trimStart+cmd.trimEnd >= cmd.duration:
+		return recording{}, usageErrorf("can't trim %s from a recording of %s", cmd.trimStart+cmd.trimEnd, cmd.duration)
+	}
+
+	if cmd.normalize && !ef.pcm {
+		return recording{}, usageErrorf("--normalize can't be used with --format %s", cmd.format)
+	}
+
+	if cmd.target > 0 || math.IsNaN(cmd.target) {
+		return recording{}, usageErrorf("invalid normalize target %g : must not be above 0 dBFS", cmd.target)
+	}
+
+	if cmd.loudness != 0 {
+		switch {
+		case cmd.loudness > 0 || math.IsNaN(cmd.loudness):
+			return recording{}, usageErrorf("invalid loudness %g : must be below 0 LUFS", cmd.loudness)
+		case !ef.pcm:
+			return recording{}, usageErrorf("--loudness can't be used with --format %s", cmd.format)
+		case cmd.normalize:
+			return recording{}, usageErrorf("--loudness and --normalize can't be used together")
+		case cmd.append:
+			return recording{}, usageErrorf("--append and --loudness can't be used together")
+		case cmd.split > 0:
+			return recording{}, usageErrorf("--split-duration can't be used with --loudness")
+		}
+	}
+
+	if cmd.format == formatFLAC && channels > flacMaxChannels {
+		return recording{}, usageErrorf("unsupported channel count %d : %s holds at most %d channels", channels, formatFLAC, flacMaxChannels)
+	}
+
+	if cmd.split < 0 {
+		return recording{}, usageErrorf("invalid split duration %s : must not be negative", cmd.split)
+	}
+
+	if cmd.split > 0 && (cmd.append || cmd.trim || cmd.normalize) {
+		return recording{}, usageErrorf("--split-duration can't be used with --append, --trim or --normalize")
+	}
+
+	if cmd.force && cmd.noClobber {
+		if fl.Changed("force") == fl.Changed("no-clobber") {
+			return recording{}, usageErrorf("--force and --no-clobber can't be used together")
+		}
+
+		// one came from the config file, so the command line wins.
+		cmd.force = fl.Changed("force")
+	}
+
+	if cmd.append && cmd.trim {
+		return recording{}, usageErrorf("--append and --trim can't be used together")
+	}
+
+	if cmd.append && cmd.normalize {
+		return recording{}, usageErrorf("--append and --normalize can't be used together")
+	}
+
+	meta := metadata{title: cmd.title, author: cmd.author, comment: cmd.comment}
+	if !meta.empty() {
+		if cmd.format != formatAIFF && cmd.format != formatWAV {
+			return recording{}, usageErrorf("--title, --author and --comment can only be used with --format %s or %s", formatAIFF, formatWAV)
+		}
+
+		if cmd.append {
+			return recording{}, usageErrorf("--title, --author and --comment can't be used with --append")
+		}
+	}
+
+	minFree, err := parseSize(cmd.minFree)
+	if err != nil {
+		return recording{}, usageError{err}
+	}
+
+	// limit names the flag the size limit was given with in errors.
+	limit := "--max-bytes"
+	if cmd.maxSize != "" {
+		if fl.Changed("max-bytes") {
+			return recording{}, usageErrorf("--max-size and --max-bytes can't be used together")
+		}
+
+		n, err := parseSize(cmd.maxSize)
+		if err != nil {
+			return recording{}, usageError{err}
+		}
+		cmd.maxBytes, limit = n, "--max-size"
+	}
+
+	if cmd.maxBytes < 0 {
+		return recording{}, usageErrorf("invalid max bytes %d : must not be negative", cmd.maxBytes)
+	}
+
+	if cmd.maxBytes > 0 {
+		if !ef.pcm {
+			return recording{}, usageErrorf("%s can't be used with --format %s", limit, cmd.format)
+		}
+
+		if cmd.split > 0 {
+			return recording{}, usageErrorf("%s can't be used with --split-duration", limit)
+		}
+
+		minBytes := headerSize(cmd.format, pcmFormat{bitDepth: cmd.bitDepth, float: cmd.sampleFmt == sampleFormatFloat32, sowt: cmd.aifc}) + int64(len(encodeMetadata(cmd.format, meta))+channels*cmd.bitDepth/8)
+		if cmd.maxBytes < minBytes {
+			return recording{}, usageErrorf("invalid %s of %d bytes : a %s file needs at least %d bytes to hold its header and a frame", limit, cmd.maxBytes, cmd.format, minBytes)
+		}
+	}
+
+	if cmd.buffer <= 0 {
+		return recording{}, usageErrorf("invalid buffer size %d : must be positive", cmd.buffer)
+	}
+
+	if cmd.spectrogram {
+		if !fft.IsPowerOfTwo(cmd.spectrogramWindow) || cmd.spectrogramWindow < 2 {
+			return recording{}, usageErrorf("invalid spectrogram window %d : must be a power of two", cmd.spectrogramWindow)
+		}
+
+		if cmd.spectrogramHop <= 0 || cmd.spectrogramHop > cmd.spectrogramWindow {
+			return recording{}, usageErrorf("invalid spectrogram hop %d : must be between 1 and the window size", cmd.spectrogramHop)
+		}
+
+		if !ef.pcm {
+			return recording{}, usageErrorf("--spectrogram can't be used with --format %s", cmd.format)
+		}
+	}
+
+	if cmd.inputFile != "" {
+		fi, err := os.Stat(cmd.inputFile)
+		if err != nil {
+			return recording{}, usageErrorf("failed to open %s : %v", cmd.inputFile, err)
+		}
+
+		frameSize := int64(cmd.channels * cmd.bitDepth / 8)
+		if fi.Size()%frameSize != 0 {
+			return recording{}, usageErrorf("%s holds %d bytes, which isn't a whole number of %d byte frames", cmd.inputFile, fi.Size(), frameSize)
+		}
+	}
+
+	if cmd.buffer < minBufferWarning {
+		log.Info("a buffer of %d frames is very small and may cause dropped audio", cmd.buffer)
+	}
+
+	rec := recording{
+		format:    cmd.format,
+		order:     order,
+		pcmFormat: pcmFormat{sampleRate: rate, channels: channels, bitDepth: cmd.bitDepth, float: cmd.sampleFmt == sampleFormatFloat32, sowt: cmd.aifc},
+		device:    cmd.device,
+		loopback:  cmd.loopback,
+		hostAPI:   cmd.hostAPI,
+		duration:  cmd.duration,
+		maxFrames: cmd.frames,
+		maxBytes:  cmd.maxBytes,
+		minFree:   minFree,
+		buffer:    cmd.buffer,
+		meter:     cmd.meter && isTerminal(os.Stderr),
+		progress:  cmd.progress,
+		monitor:   cmd.monitor,
+		verbose:   cmd.verbose,
+		cue:       cmd.cue,
+		checksum:  cmd.checksum,
+		bitrate:   cmd.bitrate,
+		threads:   threads,
+		trim:      cmd.trim,
+		gain:      cmd.gain,
+		highpass:  cmd.highpass,
+
+		normalize:       cmd.normalize,
+		normalizeTarget: cmd.target,
+		loudness:        cmd.loudness,
+		meta:            meta,
+
+		noiseGate:   cmd.noiseGate,
+		gateAttack:  cmd.gateAttack,
+		gateRelease: cmd.gateRelease,
+
+		autoGain:       cmd.autoGain,
+		autoGainTarget: cmd.autoGainTarget,
+		autoGainMax:    cmd.autoGainMax,
+
+		inputFile:  cmd.inputFile,
+		inputOrder: rawOrder,
+		lowLatency: cmd.latency == latencyLow,
+		channelMap: channelMap,
+		streamWAV:  cmd.streamWAV,
+
+		silenceThreshold: cmd.silenceThreshold,
+	}
+
+	if cmd.stopOnSilence {
+		rec.silenceDuration = cmd.silenceDuration
+	}
+	rec.zeroTimeout = cmd.zeroTimeout
+	rec.startOnSound, rec.prebuffer = cmd.startOnSound, cmd.prebuffer
+
+	rec.trimStart = int(cmd.trimStart.Seconds() * float64(rate))
+	rec.trimEnd = int(cmd.trimEnd.Seconds() * float64(rate))
+
+	if dither != dsp.DitherNone {
+		rec.captureBitDepth, rec.dither = 32, dither
+		log.Info("capturing 32 bit samples to dither them to %d bits", rec.bitDepth)
+	}
+
+	if rate != cmd.sampleRate {
+		rec.captureRate = cmd.sampleRate
+		log.Info("resampling from %d Hz to %d Hz", cmd.sampleRate, rate)
+	}
+
+	if channels != cmd.channels {
+		rec.captureChannels = cmd.channels
+		log.Info("downmixing %d channels to mono", cmd.channels)
+	}
+
+	toStdout := cmd.toStdout()
+
+	if toStdout && cmd.split > 0 {
+		return recording{}, usageErrorf("--split-duration can't be used when writing to stdout")
+	}
+
+	if cmd.spectrogram && (toStdout || cmd.split > 0) {
+		return recording{}, usageErrorf("--spectrogram can't be used when writing to stdout or with --split-duration")
+	}
+
+	if cmd.preview && (toStdout || cmd.split > 0 || !ef.pcm) {
+		return recording{}, usageErrorf("--preview can only be used when writing a single %s, %s or %s file", formatAIFF, formatWAV, formatRaw)
+	}
+
+	if cmd.cue && (toStdout || cmd.split > 0 || cmd.trim || trimOffsets) {
+		return recording{}, usageErrorf("--cue can't be used when writing to stdout or with --split-duration, --trim, --trim-start or --trim-end")
+	}
+
+	if cmd.cue && cmd.maxBytes > 0 && cmd.format == formatAIFF {
+		return recording{}, usageErrorf("--cue can't be used with --max-bytes or --max-size for %s, whose markers aren't known until it stops", formatAIFF)
+	}
+
+	if cmd.checksum {
+		switch {
+		case cmd.format != formatAIFF && cmd.format != formatWAV:
+			return recording{}, usageErrorf("--checksum can only be used with --format %s or %s", formatAIFF, formatWAV)
+		case toStdout || cmd.split > 0:
+			return recording{}, usageErrorf("--checksum can't be used when writing to stdout or with --split-duration")
+		}
+	}
+
+	if cmd.embedChecksum {
+		switch {
+		case !cmd.checksum:
+			return recording{}, usageErrorf("--embed-checksum can only be used with --checksum")
+		case cmd.format != formatAIFF:
+			return recording{}, usageErrorf("--embed-checksum can only be used with --format %s", formatAIFF)
+		case cmd.append:
+			return recording{}, usageErrorf("--embed-checksum can't be used with --append")
+		}
+		rec.embedChecksum = true
+	}
+
+	if cmd.incrementalFlush {
+		if toStdout && cmd.maxBytes == 0 {
+			return recording{}, usageErrorf("--incremental-flush can't be used when writing to stdout, whose header can't be rewritten")
+		}
+
+		if cmd.format != formatAIFF && cmd.format != formatWAV {
+			return recording{}, usageErrorf("--incremental-flush can only be used with --format %s or %s", formatAIFF, formatWAV)
+		}
+
+		if cmd.flushInterval <= 0 {
+			return recording{}, usageErrorf("invalid flush interval %s : must be positive", cmd.flushInterval)
+		}
+		rec.flushInterval = cmd.flushInterval
+	}
+
+	stopKey, err := parseStopKey(cmd.stopKey)
+	if err != nil {
+		return recording{}, usageError{err}
+	}
+	rec.stopKey = stopKey
+
+	if cmd.retroactive < 0 {
+		return recording{}, usageErrorf("invalid retroactive duration %s : must not be negative", cmd.retroactive)
+	}
+
+	if cmd.retroactive > 0 {
+		switch {
+		case cmd.append || cmd.split > 0 || cmd.cue:
+			return recording{}, usageErrorf("--retroactive can't be used with --append, --split-duration or --cue")
+		case cmd.maxBytes > 0 || cmd.frames > 0:
+			return recording{}, usageErrorf("--retroactive can't be used with %s or --frames", limit)
+		case cmd.incrementalFlush || cmd.stream != "":
+			return recording{}, usageErrorf("--retroactive can't be used with --incremental-flush or --stream, since nothing is written until it stops")
+		}
+		rec.retroactive = cmd.retroactive
+	}
+
+	if cmd.previewWidth < 0 {
+		return recording{}, usageErrorf("invalid preview width %d : must not be negative", cmd.previewWidth)
+	}
+
+	if cmd.dateSubdir && toStdout {
+		return recording{}, usageErrorf("--append-date-subdir can't be used when writing to stdout")
+	}
+
+	if base := cmd.baseName(time.Now()); base == "" {
+		return recording{}, usageErrorf("--name-template can't be empty when --out isn't set")
+	} else if cmd.dir != "" && !toStdout && filepath.IsAbs(base) {
+		return recording{}, usageErrorf("--dir can't be used with the absolute output name %s", base)
+	}
+
+	if cmd.dateSubdir {
+		if _, err := dateSubdir(cmd.dateGrain, time.Now()); err != nil {
+			return recording{}, usageError{err}
+		}
+	}
+	return rec, nil
+}
+
+// toStdout reports whether the recording is written to stdout.
+func (cmd *recordCmd) toStdout() bool { return cmd.stdout || cmd.outFile == "-" }
+
+// baseName returns the output name without its extension for a recording
+// named at t. A scheduled recording is named once it starts, so that the
+// placeholders and date subdirectory give when it started, but the name
+// is checked before waiting for it.
+func (cmd *recordCmd) baseName(t time.Time) string {
+	if cmd.outFile != "" {
+		return cmd.outFile
+	}
+	return expandName(cmd.nameTmpl, t)
+}
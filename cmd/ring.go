@@ -0,0 +1,60 @@
+package cmd
+
+// sampleRing keeps the most recent samples written to it,
+// overwriting the oldest ones once it's full.
+type sampleRing struct {
+	buf []int32
+	// start is the index of the oldest sample and n the number held.
+	start, n int
+}
+
+// newSampleRing returns an empty sampleRing that holds at most size samples.
+func newSampleRing(size int) *sampleRing {
+	return &sampleRing{buf: make([]int32, size)}
+}
+
+// write adds samples to the ring, dropping the oldest ones it no longer has room for.
+func (r *sampleRing) write(samples []int32) {
+	if len(samples) >= len(r.buf) {
+		copy(r.buf, samples[len(samples)-len(r.buf):])
+		r.start, r.n = 0, len(r.buf)
+		return
+	}
+
+	end := (r.start + r.n) % len(r.buf)
+	copied := copy(r.buf[end:], samples)
+	copy(r.buf, samples[copied:])
+
+	r.n += len(samples)
+	if over := r.n - len(r.buf); over > 0 {
+		r.start = (r.start + over) % len(r.buf)
+		r.n = len(r.buf)
+	}
+}
+
+// len returns the number of samples the ring holds, which is 0 for a nil ring.
+func (r *sampleRing) len() int {
+	if r == nil {
+		return 0
+	}
+	return r.n
+}
+
+// drain passes the samples the ring holds to fn, oldest first,
+// in slices of at most size samples, and empties the ring.
+func (r *sampleRing) drain(size int, fn func([]int32)) {
+	for r.n > 0 {
+		n := r.n
+		if n > size {
+			n = size
+		}
+		if n > len(r.buf)-r.start {
+			n = len(r.buf) - r.start
+		}
+
+		fn(r.buf[r.start : r.start+n])
+		r.start = (r.start + n) % len(r.buf)
+		r.n -= n
+	}
+	r.start = 0
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// seq returns the samples from to, counting from from.
+func seq(from, to int32) []int32 {
+	var s []int32
+	for v := from; v <= to; v++ {
+		s = append(s, v)
+	}
+	return s
+}
+
+func TestSampleRing(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		writes [][]int32
+		// chunk is the most samples drained at a time.
+		chunk int
+		want  []int32
+	}{
+		{name: "not full", size: 8, writes: [][]int32{seq(1, 3), seq(4, 5)}, chunk: 8, want: seq(1, 5)},
+		{name: "exactly full", size: 4, writes: [][]int32{seq(1, 2), seq(3, 4)}, chunk: 4, want: seq(1, 4)},
+		{name: "overfilled in small writes", size: 4, writes: [][]int32{seq(1, 3), seq(4, 6), seq(7, 9)}, chunk: 4, want: seq(6, 9)},
+		{name: "overfilled by one write", size: 4, writes: [][]int32{seq(1, 2), seq(3, 10)}, chunk: 4, want: seq(7, 10)},
+		{name: "wrapped and drained in chunks", size: 5, writes: [][]int32{seq(1, 4), seq(5, 7)}, chunk: 2, want: seq(3, 7)},
+		{name: "empty", size: 4, chunk: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newSampleRing(tt.size)
+			for _, w := range tt.writes {
+				r.write(w)
+			}
+			if r.len() != len(tt.want) {
+				t.Errorf("ring holds %d samples, want %d", r.len(), len(tt.want))
+			}
+
+			var got []int32
+			r.drain(tt.chunk, func(samples []int32) {
+				if len(samples) > tt.chunk {
+					t.Errorf("drained %d samples at once, more than %d", len(samples), tt.chunk)
+				}
+				got = append(got, samples...)
+			})
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("drained %v, want %v", got, tt.want)
+			}
+			if r.len() != 0 {
+				t.Errorf("ring holds %d samples after draining", r.len())
+			}
+
+			// a drained ring starts over.
+			r.write(seq(100, 101))
+			got = nil
+			r.drain(tt.chunk, func(samples []int32) { got = append(got, samples...) })
+			if fmt.Sprint(got) != fmt.Sprint(seq(100, 101)) {
+				t.Errorf("drained %v after reuse, want [100 101]", got)
+			}
+		})
+	}
+}
+
+func TestRecordRetroactive(t *testing.T) {
+	ctl := newControls()
+	rec := recording{
+		format:    formatRaw,
+		order:     binary.LittleEndian,
+		pcmFormat: pcmFormat{sampleRate: 8000, channels: 1, bitDepth: 16},
+		buffer:    64,
+		gain:      1,
+		// the last 80 frames at 8 kHz.
+		retroactive: 10 * time.Millisecond,
+		controls:    ctl,
+		dev: &fakeCaptureDevice{onRead: func(reads int) {
+			if reads == 5 {
+				ctl.done <- true
+			}
+		}},
+	}
+
+	f := &memoryFile{}
+	stats, err := record(f, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.samples != 80 {
+		t.Fatalf("wrote %d samples, want the last 80", stats.samples)
+	}
+
+	// the fake device captured the ramp 0 to 319, so the last 80 are 240 to 319.
+	for i := 0; i < 80; i++ {
+		if v := int16(binary.LittleEndian.Uint16(f.Bytes()[2*i:])); v != int16(240+i) {
+			t.Fatalf("sample %d is %d, want %d", i, v, 240+i)
+		}
+	}
+}
@@ -7,7 +7,9 @@ import (
 )
 
 // Root is the command that starts the program.
-type Root struct{}
+type Root struct {
+	configPath string
+}
 
 // Run prints the usage of a flag set.
 func (r *Root) Run(fl *pflag.FlagSet) { fl.Usage() }
@@ -16,14 +18,36 @@ func (r *Root) Run(fl *pflag.FlagSet) { fl.Usage() }
 func (r *Root) Spec() cli.CommandSpec {
 	return cli.CommandSpec{
 		Name:  "audio-recorder",
-		Usage: "[subcommand] [flags]",
+		Usage: "[flags] [subcommand] [flags]",
 		Desc:  "Record microphone audio from the command line.",
 	}
 }
 
+// RegisterFlags initializes how a flag set is processed for a particular command.
+func (r *Root) RegisterFlags(fl *pflag.FlagSet) {
+	fl.StringVar(&r.configPath, "config", "", "Config file of flag defaults for every subcommand (defaults to ~/.config/"+configFileName+"). Flags given on the command line take precedence over it.")
+}
+
 // Subcommands returns a set of any existing child-commands.
 func (r *Root) Subcommands() []cli.Command {
+	cmds := r.commands()
+	for i, c := range cmds {
+		cmds[i] = &configuredCmd{Command: c, root: r}
+	}
+	return cmds
+}
+
+// commands returns the child-commands without the config file applied.
+func (r *Root) commands() []cli.Command {
 	return []cli.Command{
 		&recordCmd{},
+		&devicesCmd{},
+		&playCmd{},
+		&convertCmd{},
+		&concatCmd{},
+		&verifyCmd{},
+		&infoCmd{},
+		&formatsCmd{},
+		&serveCmd{},
 	}
 }
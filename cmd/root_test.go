@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"go.coder.com/cli"
+)
+
+// runRootEnv is set when the test binary is run again to run the command
+// line in its arguments after --, since asking for help exits the process.
+const runRootEnv = "AUDIO_RECORDER_RUN_ROOT"
+
+// runRoot runs the test binary as audio-recorder with args and returns
+// what it printed and the error it exited with.
+func runRoot(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	if os.Getenv(runRootEnv) == "1" {
+		for i, arg := range os.Args {
+			if arg == "--" {
+				cli.Run(&Root{}, os.Args[i+1:], "")
+				os.Exit(0)
+			}
+		}
+		t.Fatal("no command line to run")
+	}
+
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^" + t.Name() + "$", "--"}, args...)...)
+	cmd.Env = append(os.Environ(), runRootEnv+"=1")
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// TestRecordHelp checks that record --help prints the usage of record
+// with its flags, which means the root command routes to it.
+func TestRecordHelp(t *testing.T) {
+	out, err := runRoot(t, "record", "--help")
+	if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != 2 {
+		t.Fatalf("record --help exited with %v, want exit status 2 :\n%s", err, out)
+	}
+
+	for _, want := range []string{
+		"Usage: audio-recorder record [flags]",
+		"Record microphone audio.",
+		"audio-recorder record flags:",
+		"--format",
+		"--device",
+		"--max-bytes",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("record --help doesn't print %q :\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// clockLayouts are the layouts --at accepts for a time later today.
+var clockLayouts = []string{"15:04", "15:04:05"}
+
+// parseStartTime returns the time at names, either a clock time like 15:30
+// later on the day of now or an RFC 3339 timestamp. Times that have already
+// passed are an error rather than a recording that never starts.
+func parseStartTime(at string, now time.Time) (time.Time, error) {
+	start, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		for _, layout := range clockLayouts {
+			clock, cerr := time.ParseInLocation(layout, at, now.Location())
+			if cerr != nil {
+				continue
+			}
+
+			y, m, d := now.Date()
+			start, err = time.Date(y, m, d, clock.Hour(), clock.Minute(), clock.Second(), 0, now.Location()), nil
+			break
+		}
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid start time %q : must look like 15:30, 15:30:00 or 2025-01-31T15:30:00+01:00", at)
+	}
+
+	if !start.After(now) {
+		return time.Time{}, fmt.Errorf("start time %s has already passed", start.Format("2006-01-02 15:04:05"))
+	}
+	return start, nil
+}
+
+// waitUntil blocks until start, returning an interruptedError if a signal arrives first.
+func waitUntil(start time.Time) error {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, signals...)
+	defer signal.Stop(stop)
+
+	timer := time.NewTimer(time.Until(start))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case sig := <-stop:
+		log.Info("received %s before the recording started", sig)
+		return interruptedError{sig}
+	}
+}
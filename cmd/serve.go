@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/gordonklaus/portaudio"
+	"github.com/spf13/pflag"
+	"go.coder.com/cli"
+	"go.coder.com/flog"
+)
+
+// clientBuffers is the number of captured buffers queued for a client
+// before it's considered too slow and buffers are dropped for it.
+const clientBuffers = 16
+
+type serveCmd struct {
+	addr       string
+	sampleRate int
+	channels   int
+	bitDepth   int
+	device     string
+	hostAPI    string
+	latency    string
+	buffer     int
+	maxClients int
+}
+
+// Spec returns a command spec containing a description of it's usage.
+func (cmd *serveCmd) Spec() cli.CommandSpec {
+	return cli.CommandSpec{
+		Name:  "serve",
+		Usage: "[flags]",
+		Desc:  "Stream live microphone audio as WAV over HTTP at /stream.",
+	}
+}
+
+// RegisterFlags initializes how a flag set is processed for a particular command.
+func (cmd *serveCmd) RegisterFlags(fl *pflag.FlagSet) {
+	fl.StringVar(&cmd.addr, "addr", ":8080", "Address to listen on.")
+	fl.IntVarP(&cmd.sampleRate, "sample-rate", "r", 44100, "Sample rate in Hz.")
+	fl.IntVarP(&cmd.channels, "channels", "c", 1, "Number of input channels to stream.")
+	fl.IntVar(&cmd.bitDepth, "bit-depth", 16, "Bits per sample (16 or 32).")
+	fl.StringVarP(&cmd.device, "device", "D", "", "Input device name or index as listed by the devices command (defaults to the system default).")
+	fl.StringVar(&cmd.hostAPI, "host-api", "", hostAPIUsage)
+	fl.StringVar(&cmd.latency, "latency", latencyHigh, latencyUsage)
+	fl.IntVarP(&cmd.buffer, "buffer", "b", 1024, "Frames captured per read.")
+	fl.IntVar(&cmd.maxClients, "max-clients", 4, "Most clients that can listen at once. Others are turned away until one disconnects.")
+}
+
+// Run captures from the input device and streams it to every client of /stream until a signal arrives.
+func (cmd *serveCmd) Run(fl *pflag.FlagSet) {
+	if cmd.sampleRate <= 0 || cmd.channels <= 0 || cmd.buffer <= 0 {
+		flog.Error("invalid stream : sample rate, channels and buffer must be positive")
+		fl.Usage()
+		return
+	}
+
+	if cmd.bitDepth != 16 && cmd.bitDepth != 32 {
+		flog.Error("unsupported bit depth %d : must be 16 or 32", cmd.bitDepth)
+		fl.Usage()
+		return
+	}
+
+	if err := checkLatency(cmd.latency); err != nil {
+		flog.Error("%v", err)
+		fl.Usage()
+		return
+	}
+
+	if cmd.maxClients <= 0 {
+		flog.Error("invalid client limit %d : must be positive", cmd.maxClients)
+		fl.Usage()
+		return
+	}
+
+	rec := recording{
+		pcmFormat: pcmFormat{sampleRate: cmd.sampleRate, channels: cmd.channels, bitDepth: cmd.bitDepth},
+		device:    cmd.device,
+		hostAPI:   cmd.hostAPI,
+		buffer:    cmd.buffer,
+
+		lowLatency: cmd.latency == latencyLow,
+	}
+
+	header, err := streamingWAVHeader(rec.pcmFormat)
+	if err != nil {
+		flog.Error("%v", err)
+		return
+	}
+
+	var in interface{} = make([]int32, rec.buffer*rec.channels)
+	if rec.bitDepth == 16 {
+		in = make([]int16, rec.buffer*rec.channels)
+	}
+
+	src, err := openDeviceInput(rec.inputDevice(), rec, in)
+	if err != nil {
+		flog.Error("%v", err)
+		return
+	}
+
+	defer src.Close()
+
+	clients := &broadcaster{max: cmd.maxClients, clients: make(map[chan []byte]struct{})}
+	srv := &http.Server{Addr: cmd.addr, Handler: streamHandler(header, clients)}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			flog.Error("failed to serve on %s : %v", cmd.addr, err)
+		}
+	}()
+
+	defer func() {
+		if err := srv.Close(); err != nil {
+			flog.Error("failed to close server : %v", err)
+		}
+	}()
+
+	flog.Info("streaming on http://%s/stream", cmd.addr)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, signals...)
+	defer signal.Stop(stop)
+
+	var readErrors int
+	for {
+		select {
+		case sig := <-stop:
+			flog.Info("received %s", sig)
+			return
+		default:
+		}
+
+		if _, err := readInput(src, &readErrors); err != nil && err != portaudio.InputOverflowed {
+			flog.Error("%v", err)
+			return
+		}
+
+		// every buffer is sent to the clients as its own slice,
+		// so that the next read doesn't change what they're writing.
+		var data []byte
+		switch b := in.(type) {
+		case []int16:
+			data = make([]byte, 2*len(b))
+			for i, v := range b {
+				binary.LittleEndian.PutUint16(data[2*i:], uint16(v))
+			}
+		case []int32:
+			data = make([]byte, 4*len(b))
+			for i, v := range b {
+				binary.LittleEndian.PutUint32(data[4*i:], uint32(v))
+			}
+		}
+		clients.send(data)
+	}
+}
+
+// streamHandler serves header followed by every buffer sent to clients.
+func streamHandler(header []byte, clients *broadcaster) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		c, ok := clients.add()
+		if !ok {
+			http.Error(w, "too many clients", http.StatusServiceUnavailable)
+			return
+		}
+		defer clients.remove(c)
+
+		flog.Info("%s connected", r.RemoteAddr)
+		defer flog.Info("%s disconnected", r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "audio/wav")
+		if _, err := w.Write(header); err != nil {
+			return
+		}
+
+		// flushed so that the client can start playing before the first buffer arrives.
+		flusher, _ := w.(http.Flusher)
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case data := <-c:
+				if _, err := w.Write(data); err != nil {
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+		}
+	})
+	return mux
+}
+
+// broadcaster fans captured buffers out to a limited number of clients.
+type broadcaster struct {
+	mu      sync.Mutex
+	max     int
+	clients map[chan []byte]struct{}
+}
+
+// add registers a client, unless there are already max of them.
+func (b *broadcaster) add() (chan []byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.clients) >= b.max {
+		return nil, false
+	}
+
+	c := make(chan []byte, clientBuffers)
+	b.clients[c] = struct{}{}
+	return c, true
+}
+
+// remove unregisters a client.
+func (b *broadcaster) remove(c chan []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.clients, c)
+}
+
+// send queues data for every client. Clients that have fallen
+// behind miss the buffer instead of holding up the capture.
+func (b *broadcaster) send(data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for c := range b.clients {
+		select {
+		case c <- data:
+		default:
+		}
+	}
+}
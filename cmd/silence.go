@@ -0,0 +1,114 @@
+package cmd
+
+import "time"
+
+// silenceWatch stops a recording once every buffer read for
+// rec.silenceDuration peaks below rec.silenceThreshold.
+type silenceWatch struct {
+	threshold float64
+	// silent counts consecutive frames in buffers below the threshold,
+	// which stops the recording once it reaches limit.
+	silent, limit int
+}
+
+// newSilenceWatch returns the silenceWatch of rec, which never stops a
+// recording without a silence duration.
+func newSilenceWatch(rec recording) silenceWatch {
+	return silenceWatch{
+		threshold: rec.silenceThreshold,
+		limit:     int(rec.silenceDuration.Seconds() * float64(rec.capturePCMFormat().sampleRate)),
+	}
+}
+
+// add counts a buffer of frames frames that peaked at peak and reports
+// whether the input has been silent for long enough to stop.
+func (s *silenceWatch) add(peak float64, frames int) bool {
+	if s.limit == 0 {
+		return false
+	}
+
+	if peak < s.threshold {
+		s.silent += frames
+	} else {
+		s.silent = 0
+	}
+	return s.silent >= s.limit
+}
+
+// zeroWatch aborts a recording once every sample captured for
+// rec.zeroTimeout is exactly zero, like from a dead device.
+type zeroWatch struct {
+	// zero counts consecutive frames captured as exactly zero, which
+	// is only checked once it reaches limit.
+	zero, limit int
+}
+
+// newZeroWatch returns the zeroWatch of rec, which never aborts a
+// recording without a timeout.
+func newZeroWatch(rec recording) zeroWatch {
+	return zeroWatch{limit: int(rec.zeroTimeout.Seconds() * float64(rec.capturePCMFormat().sampleRate))}
+}
+
+// add counts the frames frames of a captured buffer.
+func (z *zeroWatch) add(buf interface{}, frames int) {
+	if isZero(buf) {
+		z.zero += frames
+	} else {
+		z.zero = 0
+	}
+}
+
+// dead reports whether the input has been exactly zero for the whole timeout.
+func (z *zeroWatch) dead() bool { return z.limit > 0 && z.zero >= z.limit }
+
+// soundTrigger holds off writing a recording until the input first peaks
+// at rec.silenceThreshold, keeping up to rec.prebuffer of what came before.
+type soundTrigger struct {
+	waiting   bool
+	threshold float64
+	started   time.Time
+	pf        pcmFormat
+
+	// pre, when set, holds what's captured while waiting.
+	pre *sampleRing
+}
+
+// newSoundTrigger returns the soundTrigger of rec, which
+// isn't waiting unless rec.startOnSound is set.
+func newSoundTrigger(rec recording) soundTrigger {
+	t := soundTrigger{waiting: rec.startOnSound, threshold: rec.silenceThreshold, started: time.Now(), pf: rec.pcmFormat}
+	if !t.waiting {
+		return t
+	}
+
+	log.Info("waiting for the input to peak at %.1f%% of full scale before recording", 100*rec.silenceThreshold)
+	if rec.prebuffer > 0 {
+		t.pre = newSampleRing(int(rec.prebuffer.Seconds()*float64(rec.sampleRate)) * rec.channels)
+	}
+	return t
+}
+
+// hold reports whether a buffer that peaked at peak is still held off, in
+// which case its samples in out are kept in the prebuffer.
+func (t *soundTrigger) hold(peak float64, out []int32) bool {
+	if !t.waiting || peak >= t.threshold {
+		return false
+	}
+
+	if t.pre != nil {
+		t.pre.write(out)
+	}
+	return true
+}
+
+// release stops waiting and passes what the prebuffer holds to emit in
+// slices of at most size samples.
+func (t *soundTrigger) release(size int, emit func([]int32)) {
+	t.waiting = false
+	log.Info("heard sound after %s, recording", time.Since(t.started).Round(time.Millisecond))
+
+	if t.pre != nil {
+		log.Info("starting with the %s captured before it", time.Duration(float64(t.pf.frames(t.pre.len()))/float64(t.pf.sampleRate)*float64(time.Second)).Round(time.Millisecond))
+		t.pre.drain(size, emit)
+	}
+}
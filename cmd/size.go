@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the units a size can be given in, with the number of bytes
+// in each. Decimal units count in thousands and binary units in 1024s.
+var sizeUnits = []struct {
+	name  string
+	bytes float64
+}{
+	{"b", 1},
+	{"kb", 1e3}, {"mb", 1e6}, {"gb", 1e9}, {"tb", 1e12},
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30}, {"tib", 1 << 40},
+}
+
+// parseSize parses a number of bytes like 500MB, 1.5 GB or 64KiB.
+// A number without a unit is in bytes.
+func parseSize(s string) (int64, error) {
+	text := strings.ToLower(strings.TrimSpace(s))
+	number := strings.TrimRight(text, "abcdefghijklmnopqrstuvwxyz")
+	unit := strings.TrimSpace(text[len(number):])
+
+	v, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || v < 0 || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("invalid size %q : must be a number of bytes, optionally followed by a unit like KB, MB, GB, KiB, MiB or GiB", s)
+	}
+
+	if unit == "" {
+		unit = "b"
+	}
+	for _, u := range sizeUnits {
+		if u.name == unit {
+			if v*u.bytes > math.MaxInt64 {
+				return 0, fmt.Errorf("invalid size %q : too large", s)
+			}
+			return int64(v * u.bytes), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid size %q : unknown unit %q, must be B, KB, MB, GB, TB, KiB, MiB, GiB or TiB", s, unit)
+}
+
+// formatSize formats n bytes in the largest decimal unit it fills, like 1.5 MB.
+func formatSize(n int64) string {
+	units := []string{"KB", "MB", "GB", "TB"}
+	if n < 1000 {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	v := float64(n) / 1000
+	unit := 0
+	for v >= 1000 && unit < len(units)-1 {
+		v /= 1000
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", v, units[unit])
+}
+
+// sampleLimit stops a recording once its output holds the most samples
+// that fit within rec.maxBytes or rec.maxFrames, whichever comes first.
+type sampleLimit struct {
+	// max is the most samples the output can hold, or 0 for no limit.
+	max int
+	// frames is set when max comes from rec.maxFrames.
+	frames bool
+	// full is set once the output holds max samples.
+	full bool
+}
+
+// newSampleLimit returns the sampleLimit of rec for an output that
+// already holds samples samples, which the frame limit counts from.
+func newSampleLimit(rec recording, samples int) sampleLimit {
+	var l sampleLimit
+	if rec.maxBytes > 0 {
+		frameBytes := int64(rec.channels * rec.bytesPerSample())
+		meta := rec.meta
+		if rec.embedChecksum {
+			// the checksum isn't known yet, but its chunk always has the same size.
+			meta.checksum = strings.Repeat("0", 2*sha256.Size)
+		}
+		available := rec.maxBytes - headerSize(rec.format, rec.pcmFormat) - int64(len(encodeMetadata(rec.format, meta)))
+		if rec.format != formatRaw && rec.bytesPerSample()%2 == 1 {
+			// room for the pad byte an odd number of samples needs.
+			available--
+		}
+		l.max = int(available/frameBytes) * rec.channels
+	}
+
+	if rec.maxFrames > 0 {
+		if frameLimit := samples + rec.maxFrames*rec.channels; l.max == 0 || frameLimit <= l.max {
+			l.max, l.frames = frameLimit, true
+		}
+		log.Info("recording will stop after %d frames", rec.maxFrames)
+	}
+	return l
+}
+
+// cut returns what of out fits in an output that holds samples
+// samples, and sets full once the output reaches the limit.
+func (l *sampleLimit) cut(out []int32, samples int) []int32 {
+	if l.max == 0 || samples+len(out) < l.max {
+		return out
+	}
+
+	// an appended recording may already be past the limit.
+	n := l.max - samples
+	if n < 0 {
+		n = 0
+	}
+	l.full = true
+	return out[:n]
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"math/cmplx"
+	"os"
+
+	"github.com/fuskovic/audio-recorder/internal/fft"
+)
+
+// spectrogramFloor is the level in dB below full scale drawn as black.
+const spectrogramFloor = -100
+
+// writeSpectrogramFile reads back the recording in name, made with rec,
+// and writes its spectrogram to pngName.
+func writeSpectrogramFile(pngName, name string, rec recording, window, hop int) error {
+	f, af, order, err := openRecording(name, rec)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	out, err := os.Create(pngName)
+	if err != nil {
+		return fmt.Errorf("failed to create %s : %v", pngName, err)
+	}
+
+	if err := writeSpectrogram(out, f, order, af.pcmFormat, af.numFrames, window, hop); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to write %s : %v", pngName, err)
+	}
+	return out.Close()
+}
+
+// writeSpectrogram reads numFrames frames of pf samples in order from r
+// and writes a grayscale PNG of their short-time Fourier transform to w.
+// Each column is a window of frames, hop frames after the one before it,
+// with low frequencies at the bottom and louder bins brighter.
+func writeSpectrogram(w io.Writer, r io.Reader, order binary.ByteOrder, pf pcmFormat, numFrames, window, hop int) error {
+	columns := 1
+	if numFrames > window {
+		columns += (numFrames - window + hop - 1) / hop
+	}
+
+	bins := window / 2
+	img := image.NewGray(image.Rect(0, 0, columns, bins))
+
+	// a hann window keeps the edges of each window from smearing across every bin.
+	hann := make([]float64, window)
+	for i := range hann {
+		hann[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(window-1))
+	}
+
+	// mono holds the current window with the channels of each frame averaged.
+	mono := make([]float64, window)
+	buf := make([]int32, window*pf.channels)
+	spectrum := make([]complex128, window)
+
+	if err := readMono(r, order, pf, buf, mono); err != nil {
+		return err
+	}
+
+	for x := 0; x < columns; x++ {
+		for i, v := range mono {
+			spectrum[i] = complex(v*hann[i], 0)
+		}
+		fft.Transform(spectrum)
+
+		for bin := 0; bin < bins; bin++ {
+			// normalized so that a full scale sine peaks near 0 dB.
+			magnitude := cmplx.Abs(spectrum[bin]) / float64(bins) * 2
+			db := 20 * math.Log10(magnitude+1e-12)
+
+			level := (db - spectrogramFloor) / -spectrogramFloor
+			level = math.Max(0, math.Min(1, level))
+			img.SetGray(x, bins-1-bin, color.Gray{Y: uint8(level * 255)})
+		}
+
+		copy(mono, mono[hop:])
+		if err := readMono(r, order, pf, buf[:hop*pf.channels], mono[window-hop:]); err != nil {
+			return err
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// readMono fills mono with the next frames in r, averaging their channels
+// and scaling them to between -1 and 1. Frames past the end of r are silent.
+func readMono(r io.Reader, order binary.ByteOrder, pf pcmFormat, buf []int32, mono []float64) error {
+	n, err := readSamples(r, order, pf, buf[:len(mono)*pf.channels])
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	for i := range mono {
+		mono[i] = 0
+		for c := 0; c < pf.channels; c++ {
+			if s := i*pf.channels + c; s < n {
+				mono[i] += float64(buf[s]) / (1 << 31)
+			}
+		}
+		mono[i] /= float64(pf.channels)
+	}
+	return nil
+}
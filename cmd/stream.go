@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Every datagram sent by a udpStream starts with a 16 byte big endian header:
+//
+//	offset  size  field
+//	0       4     magic, the ASCII bytes "AREC"
+//	4       4     sequence number, starting at 0 and incremented by every datagram
+//	8       4     sample rate in Hz
+//	12      2     channels
+//	14      2     bits per sample (16, 24 or 32)
+//
+// The header is followed by interleaved big endian samples. A datagram
+// only holds whole frames, so a receiver can detect lost datagrams from
+// gaps in the sequence numbers and replace them with silence.
+const (
+	streamMagic      = "AREC"
+	streamHeaderSize = 16
+
+	// streamPayloadSize keeps datagrams within a typical ethernet MTU.
+	streamPayloadSize = 1400
+
+	// streamReportInterval is how often a summary of the stream is logged.
+	streamReportInterval = 10 * time.Second
+)
+
+// udpStream sends captured samples as UDP datagrams.
+type udpStream struct {
+	conn net.Conn
+	addr string
+	pf   pcmFormat
+
+	seq     uint32
+	sent    int
+	dropped int
+
+	packet     []byte
+	lastReport time.Time
+}
+
+// dialStream dials the udp://host:port address in rawurl.
+func dialStream(rawurl string, pf pcmFormat) (*udpStream, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse stream address %q : %v", rawurl, err)
+	}
+
+	if u.Scheme != "udp" || u.Host == "" {
+		return nil, fmt.Errorf("unsupported stream address %q : must look like udp://host:port", rawurl)
+	}
+
+	conn, err := net.Dial("udp", u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s : %v", u.Host, err)
+	}
+
+	return &udpStream{
+		conn:       conn,
+		addr:       u.Host,
+		pf:         pf,
+		packet:     make([]byte, 0, streamHeaderSize+streamPayloadSize),
+		lastReport: time.Now(),
+	}, nil
+}
+
+// send splits samples into datagrams and sends them. Failed sends are
+// counted as dropped rather than stopping the recording.
+func (s *udpStream) send(samples []int32) {
+	width := s.pf.bytesPerSample()
+	perPacket := streamPayloadSize / (width * s.pf.channels) * s.pf.channels
+
+	for len(samples) > 0 {
+		n := perPacket
+		if n > len(samples) {
+			n = len(samples)
+		}
+
+		s.packet = append(s.packet[:0], streamMagic...)
+		s.packet = appendUint32(s.packet, s.seq)
+		s.packet = appendUint32(s.packet, uint32(s.pf.sampleRate))
+		s.packet = appendUint16(s.packet, uint16(s.pf.channels))
+		s.packet = appendUint16(s.packet, uint16(s.pf.bitDepth))
+
+		for _, v := range samples[:n] {
+			switch width {
+			case 2:
+				s.packet = appendUint16(s.packet, uint16(v))
+			case 3:
+				// 24 bit samples are captured as int32, so their high 3 bytes are sent.
+				s.packet = append(s.packet, byte(v>>24), byte(v>>16), byte(v>>8))
+			default:
+				s.packet = appendUint32(s.packet, uint32(v))
+			}
+		}
+
+		if _, err := s.conn.Write(s.packet); err != nil {
+			if s.dropped == 0 {
+				log.Error("failed to send to %s : %v", s.addr, err)
+			}
+			s.dropped++
+		} else {
+			s.sent++
+		}
+
+		s.seq++
+		samples = samples[n:]
+	}
+
+	if time.Since(s.lastReport) >= streamReportInterval {
+		s.report()
+	}
+}
+
+// report logs how many datagrams have been sent and dropped.
+func (s *udpStream) report() {
+	log.Info("streamed %d packets to %s, %d dropped", s.sent, s.addr, s.dropped)
+	s.lastReport = time.Now()
+}
+
+// Close logs a final summary and closes the connection.
+func (s *udpStream) Close() error {
+	s.report()
+	return s.conn.Close()
+}
+
+// appendUint16 appends v to b in big endian order.
+func appendUint16(b []byte, v uint16) []byte {
+	var buf [2]byte
+	binary.BigEndian.PutUint16(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// appendUint32 appends v to b in big endian order.
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// The reasons a recording stops, as given in its summary.
+const (
+	stopInput      = "enter"
+	stopDuration   = "duration"
+	stopFrames     = "frames"
+	stopSignal     = "signal"
+	stopEndOfInput = "end of input"
+	stopSizeLimit  = "size limit"
+	stopDiskSpace  = "low disk space"
+	stopSilence    = "silence"
+	stopReadError  = "read error"
+	stopDeadInput  = "dead input"
+	stopWriteError = "write error"
+)
+
+// summary describes a recording once it has stopped.
+type summary struct {
+	Path            string  `json:"path"`
+	Format          string  `json:"format"`
+	SampleRate      int     `json:"sample_rate"`
+	Channels        int     `json:"channels"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Frames          int     `json:"frames"`
+	// Bytes is the size of the output, or -1 if it went somewhere that can't be measured.
+	Bytes         int64  `json:"bytes"`
+	Segments      int    `json:"segments,omitempty"`
+	Overflows     int    `json:"dropped_buffers"`
+	ClippedFrames int    `json:"clipped_frames"`
+	ReadErrors    int    `json:"read_errors"`
+	StopReason    string `json:"stop_reason"`
+}
+
+// newSummary summarizes the frames stats captured into path, which
+// holds bytes, leaving out the frames a recording being appended to
+// held before it started.
+func newSummary(path string, bytes int64, rec recording, stats recordStats) summary {
+	frames := rec.frames(stats.samples - rec.existingSamples)
+	return summary{
+		Path:            path,
+		Format:          rec.format,
+		SampleRate:      rec.sampleRate,
+		Channels:        rec.channels,
+		DurationSeconds: float64(frames) / float64(rec.sampleRate),
+		Frames:          frames,
+		Bytes:           bytes,
+		Overflows:       stats.overflows,
+		ClippedFrames:   stats.clippedFrames,
+		ReadErrors:      stats.readErrors,
+		StopReason:      stats.stopReason,
+	}
+}
+
+// lines returns s as key : value lines for the text log.
+func (s summary) lines() []string {
+	size := "unknown"
+	if s.Bytes >= 0 {
+		size = fmt.Sprintf("%s (%d bytes)", formatSize(s.Bytes), s.Bytes)
+	}
+	duration := time.Duration(s.DurationSeconds * float64(time.Second)).Round(time.Millisecond)
+
+	lines := []string{
+		"output : " + s.Path,
+		"format : " + s.Format,
+		fmt.Sprintf("sample rate : %d Hz", s.SampleRate),
+		fmt.Sprintf("channels : %d", s.Channels),
+		fmt.Sprintf("duration : %s", duration),
+		fmt.Sprintf("frames : %d", s.Frames),
+		"size : " + size,
+	}
+	if s.Segments > 0 {
+		lines = append(lines, fmt.Sprintf("segments : %d", s.Segments))
+	}
+	return append(lines,
+		fmt.Sprintf("dropped buffers : %d", s.Overflows),
+		fmt.Sprintf("clipped frames : %d", s.ClippedFrames),
+		fmt.Sprintf("read errors : %d", s.ReadErrors),
+		"stopped by : "+s.StopReason,
+	)
+}
+
+// logSummary logs s as a single JSON line with --log-format json, or as
+// a line for each field otherwise. --quiet leaves it out.
+func logSummary(s summary) {
+	switch l := log.(type) {
+	case quietLogger:
+		return
+	case jsonLogger:
+		l.writeEntry(logEntry{Time: time.Now(), Level: "info", Message: "recording summary", Summary: &s})
+	default:
+		log.Info("recording summary")
+		for _, line := range s.lines() {
+			log.Info("  %s", line)
+		}
+	}
+}
+
+// outputFilesSize returns the combined size of the files named paths.
+func outputFilesSize(paths []string) (int64, error) {
+	var total int64
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return 0, fmt.Errorf("failed to stat %s : %v", p, err)
+		}
+		total += fi.Size()
+	}
+	return total, nil
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestRecordingSummary checks the summary of a short recording of the fake
+// device, as it's logged as text and as JSON.
+func TestRecordingSummary(t *testing.T) {
+	rec := recording{
+		format:    formatWAV,
+		order:     binary.LittleEndian,
+		pcmFormat: pcmFormat{sampleRate: 8000, channels: 2, bitDepth: 16},
+		buffer:    64,
+		gain:      1,
+		dev:       &fakeCaptureDevice{},
+		maxFrames: 400,
+	}
+
+	f := &memoryFile{}
+	stats, err := record(f, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := int64(len(f.Bytes()))
+	if want := int64(wavHeaderSize + 400*4); size != want {
+		t.Fatalf("recording is %d bytes, want %d", size, want)
+	}
+
+	s := newSummary("take.wav", size, rec, stats)
+	want := summary{
+		Path:            "take.wav",
+		Format:          formatWAV,
+		SampleRate:      8000,
+		Channels:        2,
+		DurationSeconds: 0.05,
+		Frames:          400,
+		Bytes:           size,
+		StopReason:      stopFrames,
+	}
+	if s != want {
+		t.Errorf("summary is %+v, want %+v", s, want)
+	}
+
+	var text bytes.Buffer
+	defer func(l logger) { log = l }(log)
+	log = newLogger(logFormatText, &text)
+	logSummary(s)
+	for _, line := range []string{"output : take.wav", "duration : 50ms", "frames : 400", "(1644 bytes)", "stopped by : frames"} {
+		if !strings.Contains(text.String(), line) {
+			t.Errorf("text summary doesn't contain %q :\n%s", line, text.String())
+		}
+	}
+
+	var js bytes.Buffer
+	log = newLogger(logFormatJSON, &js)
+	logSummary(s)
+
+	var entry logEntry
+	if err := json.Unmarshal(js.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to decode %s : %v", js.Bytes(), err)
+	}
+	if entry.Message != "recording summary" || entry.Summary == nil || *entry.Summary != want {
+		t.Errorf("json summary is %s, want %+v", js.Bytes(), want)
+	}
+
+	t.Run("appended", func(t *testing.T) {
+		// as if the first 300 of the 400 frames were already in the file.
+		rec.existingSamples = 300 * 2
+		if s := newSummary("take.wav", size, rec, stats); s.Frames != 100 || s.DurationSeconds != 0.0125 {
+			t.Errorf("summary of an appended recording has %d frames in %vs, want 100 in 0.0125s", s.Frames, s.DurationSeconds)
+		}
+	})
+}
@@ -0,0 +1,12 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package cmd
+
+import "golang.org/x/sys/unix"
+
+// The ioctls that read and set the attributes of a terminal.
+const (
+	ioctlGetTermios = unix.TIOCGETA
+	ioctlSetTermios = unix.TIOCSETA
+)
@@ -0,0 +1,9 @@
+package cmd
+
+import "golang.org/x/sys/unix"
+
+// The ioctls that read and set the attributes of a terminal.
+const (
+	ioctlGetTermios = unix.TCGETS
+	ioctlSetTermios = unix.TCSETS
+)
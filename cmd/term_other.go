@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package cmd
+
+import (
+	"errors"
+	"os"
+)
+
+// terminalWidth returns defaultPreviewWidth, the width of a terminal isn't looked up here.
+func terminalWidth(f *os.File) int { return defaultPreviewWidth }
+
+// makeCbreak returns an error, single keys can't be read from a terminal here.
+func makeCbreak(fd int) (func() error, error) {
+	return nil, errors.New("single keys can't be read from a terminal on this platform")
+}
@@ -0,0 +1,38 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package cmd
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminalWidth returns the number of columns of the terminal f is attached to,
+// or defaultPreviewWidth if it isn't a terminal.
+func terminalWidth(f *os.File) int {
+	ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 {
+		return defaultPreviewWidth
+	}
+	return int(ws.Col)
+}
+
+// makeCbreak stops the terminal fd from waiting for enter and echoing what's
+// typed, so keys can be read one at a time. Ctrl-C still sends a signal.
+// It returns a func that puts the terminal back the way it was.
+func makeCbreak(fd int) (func() error, error) {
+	old, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, err
+	}
+
+	t := *old
+	t.Lflag &^= unix.ICANON | unix.ECHO | unix.IEXTEN
+	t.Cc[unix.VMIN], t.Cc[unix.VTIME] = 1, 0
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &t); err != nil {
+		return nil, err
+	}
+	return func() error { return unix.IoctlSetTermios(fd, ioctlSetTermios, old) }, nil
+}
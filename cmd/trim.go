@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// trimFrames is the number of frames read at a time while trimming.
+const trimFrames = 4096
+
+// trimSilence removes the frames at either end of the numSamples samples
+// starting at dataOffset whose samples all peak below threshold, a fraction
+// of full scale. The remaining frames are moved to dataOffset and the new
+// number of samples is returned.
+func trimSilence(rw io.ReadWriteSeeker, dataOffset int64, pf pcmFormat, order binary.ByteOrder, numSamples int, threshold float64) (int, error) {
+	if _, err := rw.Seek(dataOffset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to seek to sample data : %v", err)
+	}
+
+	limit := threshold * (1 << 31)
+	buf := make([]int32, trimFrames*pf.channels)
+	first, last := -1, -1
+
+	r := io.LimitReader(rw, int64(numSamples*pf.bytesPerSample()))
+	for frame := 0; ; {
+		n, err := readSamples(r, order, pf, buf)
+		for i := 0; i+pf.channels <= n; i += pf.channels {
+			for _, v := range buf[i : i+pf.channels] {
+				if math.Abs(float64(v)) >= limit {
+					if first < 0 {
+						first = frame
+					}
+					last = frame
+					break
+				}
+			}
+			frame++
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read samples : %v", err)
+		}
+	}
+
+	if first < 0 {
+		return 0, nil
+	}
+
+	if err := keepFrames(rw, dataOffset, pf, first, last-first+1); err != nil {
+		return 0, err
+	}
+	return (last - first + 1) * pf.channels, nil
+}
+
+// trimOffsets removes start frames from the beginning and end frames from
+// the end of the numSamples samples starting at dataOffset. The remaining
+// frames are moved to dataOffset and the new number of samples is returned.
+func trimOffsets(rw io.ReadWriteSeeker, dataOffset int64, pf pcmFormat, numSamples, start, end int) (int, error) {
+	frames := pf.frames(numSamples)
+	if start+end >= frames {
+		return 0, fmt.Errorf("can't trim %d frames from a recording of %d frames", start+end, frames)
+	}
+
+	if err := keepFrames(rw, dataOffset, pf, start, frames-start-end); err != nil {
+		return 0, err
+	}
+	return (frames - start - end) * pf.channels, nil
+}
+
+// keepFrames moves count frames, starting first frames after dataOffset, to dataOffset.
+func keepFrames(rw io.ReadWriteSeeker, dataOffset int64, pf pcmFormat, first, count int) error {
+	frameBytes := int64(pf.channels * pf.bytesPerSample())
+	src := dataOffset + int64(first)*frameBytes
+	size := int64(count) * frameBytes
+
+	// the frames only ever move towards the start of the data,
+	// so copying forwards never overwrites frames still to be copied.
+	chunk := make([]byte, trimFrames*frameBytes)
+	for dst, done := dataOffset, int64(0); done < size && src != dataOffset; {
+		n := int64(len(chunk))
+		if size-done < n {
+			n = size - done
+		}
+
+		if _, err := rw.Seek(src+done, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek to frames : %v", err)
+		}
+		if _, err := io.ReadFull(rw, chunk[:n]); err != nil {
+			return fmt.Errorf("failed to read frames : %v", err)
+		}
+		if _, err := rw.Seek(dst+done, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek to trimmed position : %v", err)
+		}
+		if _, err := rw.Write(chunk[:n]); err != nil {
+			return fmt.Errorf("failed to write frames : %v", err)
+		}
+		done += n
+	}
+	return nil
+}
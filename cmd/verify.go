@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+	"go.coder.com/cli"
+	"go.coder.com/flog"
+)
+
+type verifyCmd struct{}
+
+// Spec returns a command spec containing a description of it's usage.
+func (cmd *verifyCmd) Spec() cli.CommandSpec {
+	return cli.CommandSpec{
+		Name:  "verify",
+		Usage: "<in>...",
+		Desc:  "Check that the sample data of AIFF or WAV recordings still matches the checksums written by --checksum.",
+	}
+}
+
+// Run checks every input file against its checksum file and the checksum
+// embedded in it. It exits with a nonzero status if any of them fails.
+func (cmd *verifyCmd) Run(fl *pflag.FlagSet) {
+	inputs := fl.Args()
+	if len(inputs) == 0 {
+		flog.Error("no input file provided")
+		fl.Usage()
+		return
+	}
+
+	var failed int
+	for _, in := range inputs {
+		sum, err := verify(in)
+		if err != nil {
+			flog.Error("%v", err)
+			failed++
+			continue
+		}
+		flog.Success("%s matches its checksum %s", in, sum)
+	}
+
+	if failed > 0 {
+		flog.Error("%d of %d recordings failed verification", failed, len(inputs))
+		os.Exit(1)
+	}
+}
+
+// verify recomputes the checksum of the sample data of the recording in
+// name and compares it with the one in its checksum file and the one
+// embedded in it, whichever it has. It returns the checksum if every one
+// matches, and an error if any differs or there are none.
+func verify(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s : %v", name, err)
+	}
+
+	defer f.Close()
+
+	af, err := readHeader(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to read header of %s : %v", name, err)
+	}
+
+	meta, err := readMetadata(f, af)
+	if err != nil {
+		return "", fmt.Errorf("failed to read metadata of %s : %v", name, err)
+	}
+
+	// expected holds each checksum found and where it was found.
+	var expected []struct{ source, sum string }
+	if meta.checksum != "" {
+		expected = append(expected, struct{ source, sum string }{"embedded checksum", meta.checksum})
+	}
+
+	sum, ok, err := readChecksumFile(name)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		expected = append(expected, struct{ source, sum string }{"checksum in " + name + checksumExt, sum})
+	}
+
+	if len(expected) == 0 {
+		return "", fmt.Errorf("%s has no checksum : neither %s nor an embedded checksum was found", name, name+checksumExt)
+	}
+
+	actual, err := sampleChecksum(f, af.dataOffset, af.dataSize)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute checksum of %s : %v", name, err)
+	}
+
+	for _, e := range expected {
+		if actual != e.sum {
+			return "", fmt.Errorf("%s doesn't match : its sample data hashes to %s but the %s is %s", name, actual, e.source, e.sum)
+		}
+	}
+	return actual, nil
+}
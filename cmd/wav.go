@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// wavHeaderSize is the number of bytes written by writeRiffChunk,
+// writeFmtChunk and writeDataChunk before the first sample.
+const wavHeaderSize = 12 + 24 + 8
+
+// Audio formats of the fmt chunk. Float files are written without the
+// fact chunk other non-PCM formats need, which every common reader accepts.
+const (
+	wavFormatPCM   = 1
+	wavFormatFloat = 3
+)
+
+func writeRiffChunk(w io.Writer) error {
+	// http://soundfile.sapp.org/doc/WaveFormat/
+
+	// header
+	if _, err := io.WriteString(w, "RIFF"); err != nil {
+		return err
+	}
+
+	// total bytes
+	if err := binary.Write(w, binary.LittleEndian, int32(0)); err != nil {
+		return err
+	}
+
+	// format
+	if _, err := io.WriteString(w, "WAVE"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func writeFmtChunk(w io.Writer, pf pcmFormat) error {
+	// http://soundfile.sapp.org/doc/WaveFormat/
+
+	blockAlign := pf.channels * pf.bytesPerSample()
+
+	// header
+	if _, err := io.WriteString(w, "fmt "); err != nil {
+		return err
+	}
+	// size
+	if err := binary.Write(w, binary.LittleEndian, int32(16)); err != nil {
+		return err
+	}
+	// audio format (1 = PCM, 3 = IEEE float)
+	audioFormat := wavFormatPCM
+	if pf.float {
+		audioFormat = wavFormatFloat
+	}
+	if err := binary.Write(w, binary.LittleEndian, int16(audioFormat)); err != nil {
+		return err
+	}
+	// channels
+	if err := binary.Write(w, binary.LittleEndian, int16(pf.channels)); err != nil {
+		return err
+	}
+	// sample rate
+	if err := binary.Write(w, binary.LittleEndian, int32(pf.sampleRate)); err != nil {
+		return err
+	}
+	// byte rate
+	if err := binary.Write(w, binary.LittleEndian, int32(pf.sampleRate*blockAlign)); err != nil {
+		return err
+	}
+	// block align
+	if err := binary.Write(w, binary.LittleEndian, int16(blockAlign)); err != nil {
+		return err
+	}
+	// bits per sample
+	if err := binary.Write(w, binary.LittleEndian, int16(pf.bitDepth)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func writeDataChunk(w io.Writer) error {
+	// http://soundfile.sapp.org/doc/WaveFormat/
+
+	// header
+	if _, err := io.WriteString(w, "data"); err != nil {
+		return err
+	}
+	// size
+	if err := binary.Write(w, binary.LittleEndian, int32(0)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// wavSizes returns the RIFF and data size fields for a recording
+// of numSamples interleaved samples followed by trailer bytes of other chunks.
+func wavSizes(pf pcmFormat, numSamples, trailer int) []sizeField {
+	dataBytes := pf.bytesPerSample() * numSamples
+
+	return []sizeField{
+		{name: "riff size", offset: 4, value: int32(wavHeaderSize - 8 + dataBytes + trailer)},
+		{name: "data size", offset: 40, value: int32(dataBytes)},
+	}
+}
+
+// streamingWAVHeader returns a wav header with every size set to the largest
+// value, which players read as a stream that goes on until it's closed.
+func streamingWAVHeader(pf pcmFormat) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeRiffChunk(&buf); err != nil {
+		return nil, fmt.Errorf("failed to write riff chunk : %v", err)
+	}
+
+	if err := writeFmtChunk(&buf, pf); err != nil {
+		return nil, fmt.Errorf("failed to write fmt chunk : %v", err)
+	}
+
+	if err := writeDataChunk(&buf); err != nil {
+		return nil, fmt.Errorf("failed to write data chunk : %v", err)
+	}
+
+	header := buf.Bytes()
+	for _, field := range wavSizes(pf, 0, 0) {
+		binary.LittleEndian.PutUint32(header[field.offset:], math.MaxUint32)
+	}
+	return header, nil
+}
+
+// parseWAV reads the chunks of a WAV file whose RIFF id has already been read.
+func parseWAV(r io.ReadSeeker) (audioFile, error) {
+	var riff struct {
+		Size uint32
+		Type [4]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &riff); err != nil {
+		return audioFile{}, fmt.Errorf("failed to read riff chunk : %v", err)
+	}
+	if string(riff.Type[:]) != "WAVE" {
+		return audioFile{}, fmt.Errorf("unsupported riff type %q", riff.Type[:])
+	}
+
+	af := audioFile{format: formatWAV, formSize: int64(riff.Size)}
+
+	var blockAlign int
+	var foundFmt, foundData bool
+	for pos := int64(12); !foundFmt || !foundData; {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			return audioFile{}, fmt.Errorf("failed to read chunk header : %v", err)
+		}
+		pos += 8
+
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			var fmtChunk struct {
+				AudioFormat   uint16
+				Channels      uint16
+				SampleRate    uint32
+				ByteRate      uint32
+				BlockAlign    uint16
+				BitsPerSample uint16
+			}
+			if err := binary.Read(r, binary.LittleEndian, &fmtChunk); err != nil {
+				return audioFile{}, fmt.Errorf("failed to read fmt chunk : %v", err)
+			}
+			switch fmtChunk.AudioFormat {
+			case wavFormatPCM:
+			case wavFormatFloat:
+				af.float = true
+			default:
+				return audioFile{}, fmt.Errorf("unsupported wav audio format %d : only PCM and IEEE float are supported", fmtChunk.AudioFormat)
+			}
+			af.channels = int(fmtChunk.Channels)
+			af.sampleRate = int(fmtChunk.SampleRate)
+			af.bitDepth = int(fmtChunk.BitsPerSample)
+			blockAlign = int(fmtChunk.BlockAlign)
+			foundFmt = true
+		case "data":
+			af.dataOffset = pos
+			af.dataSize = int64(chunk.Size)
+			foundData = true
+		}
+
+		// chunks are padded to an even length.
+		pos += int64(chunk.Size) + int64(chunk.Size&1)
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return audioFile{}, fmt.Errorf("failed to seek to next chunk : %v", err)
+		}
+	}
+
+	if af.channels < 1 || af.sampleRate < 1 || blockAlign < 1 || !validBitDepth(af.bitDepth) || (af.float && af.bitDepth != 32) {
+		return audioFile{}, fmt.Errorf("unsupported fmt chunk : %d channels, %d Hz, %d bits", af.channels, af.sampleRate, af.bitDepth)
+	}
+
+	af.numFrames = int(af.dataSize) / blockAlign
+	return af, nil
+}
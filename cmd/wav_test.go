@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// TestStreamingWAVHeader checks the chunk ids and fmt fields of the header
+// streamed recordings start with, and that both of its sizes are the largest
+// value so that players read on until the stream is closed.
+func TestStreamingWAVHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		pf     pcmFormat
+		format uint16
+	}{
+		{"16 bit stereo", pcmFormat{sampleRate: 44100, channels: 2, bitDepth: 16}, wavFormatPCM},
+		{"24 bit mono", pcmFormat{sampleRate: 48000, channels: 1, bitDepth: 24}, wavFormatPCM},
+		{"float stereo", pcmFormat{sampleRate: 96000, channels: 2, bitDepth: 32, float: true}, wavFormatFloat},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			header, err := streamingWAVHeader(tc.pf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(header) != wavHeaderSize {
+				t.Fatalf("header is %d bytes, want %d", len(header), wavHeaderSize)
+			}
+
+			for offset, id := range map[int]string{0: "RIFF", 8: "WAVE", 12: "fmt ", 36: "data"} {
+				if got := string(header[offset : offset+4]); got != id {
+					t.Errorf("id at %d = %q, want %q", offset, got, id)
+				}
+			}
+
+			blockAlign := tc.pf.channels * tc.pf.bytesPerSample()
+			le := binary.LittleEndian
+			for _, field := range []struct {
+				name      string
+				got, want uint32
+			}{
+				{"riff size", le.Uint32(header[4:]), math.MaxUint32},
+				{"fmt size", le.Uint32(header[16:]), 16},
+				{"audio format", uint32(le.Uint16(header[20:])), uint32(tc.format)},
+				{"channels", uint32(le.Uint16(header[22:])), uint32(tc.pf.channels)},
+				{"sample rate", le.Uint32(header[24:]), uint32(tc.pf.sampleRate)},
+				{"byte rate", le.Uint32(header[28:]), uint32(tc.pf.sampleRate * blockAlign)},
+				{"block align", uint32(le.Uint16(header[32:])), uint32(blockAlign)},
+				{"bits per sample", uint32(le.Uint16(header[34:])), uint32(tc.pf.bitDepth)},
+				{"data size", le.Uint32(header[40:]), math.MaxUint32},
+			} {
+				if field.got != field.want {
+					t.Errorf("%s = %d, want %d", field.name, field.got, field.want)
+				}
+			}
+		})
+	}
+}
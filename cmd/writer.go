@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+)
+
+// writerQueueSize is the number of captured buffers that can wait to be
+// encoded, which lets capture carry on through a disk stall of that many
+// buffers before portaudio starts dropping input.
+const writerQueueSize = 64
+
+// writeJob is a captured buffer for an asyncWriter to encode, or, when
+// done is set, a request to be told once everything before it is encoded.
+type writeJob struct {
+	samples []int32
+	done    chan struct{}
+}
+
+// asyncWriter encodes and streams captured buffers in its own goroutine,
+// so that capture keeps reading from the input while the disk is slow.
+type asyncWriter struct {
+	// enc may only be changed between a sync and the next write.
+	enc    Encoder
+	stream *udpStream
+
+	queue chan writeJob
+	// free holds buffers that have been encoded, to be reused by write.
+	free chan []int32
+	// stopped is closed once the goroutine has encoded everything queued.
+	stopped chan struct{}
+
+	// backedUp is set while the queue is at least half full.
+	backedUp bool
+
+	// err is the first error from the encoder, after which
+	// nothing more is encoded.
+	mu  sync.Mutex
+	err error
+}
+
+// newAsyncWriter starts a goroutine that writes buffers to enc and stream, which may be nil.
+func newAsyncWriter(enc Encoder, stream *udpStream) *asyncWriter {
+	a := &asyncWriter{
+		enc:     enc,
+		stream:  stream,
+		queue:   make(chan writeJob, writerQueueSize),
+		free:    make(chan []int32, writerQueueSize+1),
+		stopped: make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// run encodes queued buffers until the queue is closed.
+func (a *asyncWriter) run() {
+	defer close(a.stopped)
+
+	for job := range a.queue {
+		if job.done != nil {
+			close(job.done)
+			continue
+		}
+
+		if a.failed() == nil {
+			if err := a.enc.WriteFrames(job.samples); err != nil {
+				a.mu.Lock()
+				a.err = fmt.Errorf("failed to write audio data : %v", err)
+				a.mu.Unlock()
+			}
+		}
+
+		if a.stream != nil {
+			a.stream.send(job.samples)
+		}
+
+		select {
+		case a.free <- job.samples:
+		default:
+		}
+	}
+}
+
+// write queues a copy of samples to be encoded. It only blocks
+// once writerQueueSize buffers are already waiting.
+func (a *asyncWriter) write(samples []int32) {
+	var buf []int32
+	select {
+	case buf = <-a.free:
+	default:
+	}
+	buf = append(buf[:0], samples...)
+
+	switch queued := len(a.queue); {
+	case queued >= writerQueueSize/2 && !a.backedUp:
+		a.backedUp = true
+		log.Info("writes are falling behind capture, %d buffers are waiting to be written", queued)
+	case queued == 0 && a.backedUp:
+		a.backedUp = false
+		log.Info("writes have caught up with capture")
+	}
+
+	a.queue <- writeJob{samples: buf}
+}
+
+// sync waits until every buffer queued so far has been encoded.
+func (a *asyncWriter) sync() {
+	done := make(chan struct{})
+	a.queue <- writeJob{done: done}
+	<-done
+}
+
+// failed returns the error that stopped the encoder, if any.
+func (a *asyncWriter) failed() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// close encodes every queued buffer, stops the goroutine and
+// returns the error that stopped the encoder, if any.
+func (a *asyncWriter) close() error {
+	close(a.queue)
+	<-a.stopped
+	return a.err
+}
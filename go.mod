@@ -4,8 +4,9 @@ go 1.14
 
 require (
 	github.com/gordonklaus/portaudio v0.0.0-20180817120803-00e7307ccd93
+	github.com/mewkiz/flac v1.0.10
 	github.com/spf13/pflag v1.0.5
 	go.coder.com/cli v0.4.0
 	go.coder.com/flog v0.0.0-20190906214207-47dd47ea0512
-	golang.org/x/sys v0.0.0-20200625212154-ddb9806d33ae // indirect
+	golang.org/x/sys v0.5.0
 )
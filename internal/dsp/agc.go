@@ -0,0 +1,95 @@
+package dsp
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// agcWindow is how long the RMS level the AGC works from is averaged
+	// over, so that single syllables and drum hits don't move the gain.
+	agcWindow = 300 * time.Millisecond
+	// agcFloor is the RMS level, as a fraction of full scale, below which
+	// the AGC holds its gain instead of raising the noise between phrases.
+	agcFloor = 0.001
+)
+
+// AGC scales interleaved frames to keep their RMS level near a target.
+// The gain falls over the attack time when the input gets louder and
+// rises over the longer release time when it gets quieter, the same way
+// for every channel, so the stereo image doesn't shift.
+type AGC struct {
+	target    float64
+	maxGain   float64
+	fullScale float64
+	channels  int
+
+	window                  float64
+	attackCoef, releaseCoef float64
+
+	meanSquare float64
+	gain       float64
+}
+
+// NewAGC returns an AGC for frames of channels samples at sampleRate Hz
+// whose samples reach fullScale. The target is an RMS level as a fraction
+// of full scale, and the gain never rises above maxGain.
+func NewAGC(target, maxGain, fullScale float64, sampleRate, channels int, attack, release time.Duration) *AGC {
+	if channels <= 0 || sampleRate <= 0 || attack <= 0 || release <= 0 || maxGain < 1 {
+		panic("dsp: agc needs a positive sample rate, channel count, attack and release, and a maximum gain of at least 1")
+	}
+
+	// coef returns the fraction of the way to its goal that a one pole
+	// smoother covers each frame to settle within about d.
+	coef := func(d time.Duration) float64 { return 1 - math.Exp(-1/math.Max(1, d.Seconds()*float64(sampleRate))) }
+
+	return &AGC{
+		target:      target,
+		maxGain:     maxGain,
+		fullScale:   fullScale,
+		channels:    channels,
+		window:      coef(agcWindow),
+		attackCoef:  coef(attack),
+		releaseCoef: coef(release),
+		gain:        1,
+	}
+}
+
+// Gain returns the gain applied to the last frame processed.
+func (a *AGC) Gain() float64 { return a.gain }
+
+// Process scales the interleaved frames in samples in place, clamping
+// the scaled samples to [min, max] so they fit the recording's bit depth.
+func (a *AGC) Process(samples []int32, min, max int32) {
+	for i := 0; i+a.channels <= len(samples); i += a.channels {
+		frame := samples[i : i+a.channels]
+
+		var sum float64
+		for _, v := range frame {
+			x := float64(v) / a.fullScale
+			sum += x * x
+		}
+		a.meanSquare += (sum/float64(a.channels) - a.meanSquare) * a.window
+
+		if level := math.Sqrt(a.meanSquare); level >= agcFloor {
+			want := math.Min(a.maxGain, a.target/level)
+			if want < a.gain {
+				a.gain += (want - a.gain) * a.attackCoef
+			} else {
+				a.gain += (want - a.gain) * a.releaseCoef
+			}
+		}
+
+		for j, v := range frame {
+			y := float64(v) * a.gain
+			switch {
+			case y > float64(max):
+				frame[j] = max
+			case y < float64(min):
+				frame[j] = min
+			default:
+				frame[j] = int32(math.Round(y))
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// rampedSine returns seconds of a 440 Hz sine at sampleRate Hz whose peak
+// ramps from start to end of full scale by the same number of dB every second.
+func rampedSine(sampleRate int, seconds, start, end float64) []int32 {
+	n := int(seconds * float64(sampleRate))
+	samples := make([]int32, n)
+	for i := range samples {
+		amplitude := start * math.Pow(end/start, float64(i)/float64(n))
+		samples[i] = int32(amplitude * math.MaxInt16 * math.Sin(2*math.Pi*440*float64(i)/float64(sampleRate)))
+	}
+	return samples
+}
+
+// TestAGCRamp feeds the AGC a sine whose amplitude ramps up and down by
+// 12 dB and checks that, once it has settled, every 100ms of its output
+// stays within 3 dB of the target, and that the gain never passes maxGain.
+func TestAGCRamp(t *testing.T) {
+	const sampleRate, target, maxGain = 8000, 0.1, 10
+
+	for _, tc := range []struct {
+		name       string
+		start, end float64
+		// want is the RMS level the output settles at, once settle
+		// seconds have passed.
+		want   float64
+		settle int
+	}{
+		{"rising", 0.1, 0.4, target, 2},
+		{"falling", 0.4, 0.1, target, 2},
+		// a sine peaking at 0.004 has an RMS level 29 dB under the target,
+		// and the gain rises to its maximum over a few release times.
+		{"held at max gain", 0.004, 0.004, 0.004 / math.Sqrt2 * maxGain, 8},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			agc := NewAGC(target, maxGain, 1<<15, sampleRate, 1, 200*time.Millisecond, 2*time.Second)
+			samples := rampedSine(sampleRate, 12, tc.start, tc.end)
+			agc.Process(samples, math.MinInt16, math.MaxInt16)
+
+			block := sampleRate / 10
+			for i := tc.settle * sampleRate; i+block <= len(samples); i += block {
+				var sum float64
+				for _, v := range samples[i : i+block] {
+					x := float64(v) / (1 << 15)
+					sum += x * x
+				}
+				rms := math.Sqrt(sum / float64(block))
+				if db := 20 * math.Log10(rms/tc.want); math.Abs(db) > 3 {
+					t.Fatalf("output at %.1fs has an rms of %.4f, %.1f dB from %.4f", float64(i)/sampleRate, rms, db, tc.want)
+				}
+			}
+			if g := agc.Gain(); g > maxGain {
+				t.Errorf("gain rose to %.2f, past the maximum of %d", g, maxGain)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+// Package dsp filters, gates and levels interleaved samples.
+package dsp
+
+import "math"
+
+// Biquad is a second order IIR filter applied to every channel of
+// interleaved frames. Each channel keeps its own state, so consecutive
+// calls to Process filter a continuous stream.
+type Biquad struct {
+	b0, b1, b2, a1, a2 float64
+
+	channels int
+	// state holds the last two inputs and outputs of each channel.
+	state []struct{ x1, x2, y1, y2 float64 }
+}
+
+// NewHighPass returns a Butterworth high-pass filter that attenuates
+// frequencies below cutoff Hz by 12 dB per octave, using the coefficients
+// of the Audio EQ Cookbook. The cutoff must be below half of sampleRate.
+func NewHighPass(cutoff, sampleRate float64, channels int) *Biquad {
+	if cutoff <= 0 || cutoff >= sampleRate/2 || channels <= 0 {
+		panic("dsp: cutoff must be between 0 and half the sample rate, with at least one channel")
+	}
+
+	// a Q of 1/√2 makes the response maximally flat above the cutoff.
+	w0 := 2 * math.Pi * cutoff / sampleRate
+	cos, alpha := math.Cos(w0), math.Sin(w0)/math.Sqrt2
+	a0 := 1 + alpha
+
+	return &Biquad{
+		b0:       (1 + cos) / 2 / a0,
+		b1:       -(1 + cos) / a0,
+		b2:       (1 + cos) / 2 / a0,
+		a1:       -2 * cos / a0,
+		a2:       (1 - alpha) / a0,
+		channels: channels,
+		state:    make([]struct{ x1, x2, y1, y2 float64 }, channels),
+	}
+}
+
+// Process filters the interleaved frames in samples in place, clamping
+// the filtered samples to [min, max] so they fit the recording's bit depth.
+func (b *Biquad) Process(samples []int32, min, max int32) {
+	for i, v := range samples {
+		s := &b.state[i%b.channels]
+
+		x := float64(v)
+		y := b.b0*x + b.b1*s.x1 + b.b2*s.x2 - b.a1*s.y1 - b.a2*s.y2
+		s.x2, s.x1 = s.x1, x
+		s.y2, s.y1 = s.y1, y
+
+		switch {
+		case y > float64(max):
+			samples[i] = max
+		case y < float64(min):
+			samples[i] = min
+		default:
+			samples[i] = int32(math.Round(y))
+		}
+	}
+}
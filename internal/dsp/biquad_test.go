@@ -0,0 +1,55 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+)
+
+// TestHighPass drives an 80 Hz high-pass with a tone in each of two
+// channels, a buffer at a time, and checks how much each is attenuated
+// once the filter has settled against the response of a Butterworth filter.
+func TestHighPass(t *testing.T) {
+	const sampleRate, cutoff, frames, buffer = 48000, 80, 48000, 512
+
+	for _, tc := range []struct {
+		name string
+		// freqs are the tones in the left and right channel.
+		freqs [2]float64
+		// want are the gains of each channel in dB.
+		want [2]float64
+	}{
+		{"two octaves below and above", [2]float64{20, 1280}, [2]float64{-24.1, 0}},
+		{"cutoff", [2]float64{80, 10000}, [2]float64{-3.01, 0}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			samples := make([]int32, 2*frames)
+			for i := range samples {
+				freq := tc.freqs[i%2]
+				samples[i] = int32(0.5 * math.MaxInt32 * math.Sin(2*math.Pi*freq*float64(i/2)/sampleRate))
+			}
+			in := append([]int32(nil), samples...)
+
+			hp := NewHighPass(cutoff, sampleRate, 2)
+			for i := 0; i < len(samples); i += 2 * buffer {
+				end := i + 2*buffer
+				if end > len(samples) {
+					end = len(samples)
+				}
+				hp.Process(samples[i:end], math.MinInt32, math.MaxInt32)
+			}
+
+			// the first half second is left out while the filter settles.
+			var sumIn, sumOut [2]float64
+			for i := sampleRate; i < len(samples); i++ {
+				x, y := float64(in[i]), float64(samples[i])
+				sumIn[i%2] += x * x
+				sumOut[i%2] += y * y
+			}
+			for c := range tc.want {
+				if gain := 10 * math.Log10(sumOut[c]/sumIn[c]); math.Abs(gain-tc.want[c]) > 0.2 {
+					t.Errorf("%.0f Hz in channel %d is changed by %.2f dB, want %.2f", tc.freqs[c], c, gain, tc.want[c])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package dsp
+
+import (
+	"math"
+	"math/rand"
+)
+
+// DitherShape is the distribution of the noise a Quantizer adds before rounding.
+type DitherShape int
+
+const (
+	// DitherNone rounds without adding noise.
+	DitherNone DitherShape = iota
+	// DitherRectangular adds noise spread evenly over one step of the reduced depth.
+	DitherRectangular
+	// DitherTriangular adds the sum of two rectangular noises, which also keeps
+	// the loudness of the noise from following the signal. It's the usual TPDF dither.
+	DitherTriangular
+)
+
+// Quantizer reduces samples to fewer bits. Dither noise added before
+// rounding turns the rounding error of quiet passages into a steady noise
+// floor instead of distortion that follows the signal.
+type Quantizer struct {
+	shift uint
+	shape DitherShape
+	rng   *rand.Rand
+}
+
+// NewQuantizer returns a Quantizer that drops the low shift bits of each
+// sample, seeding its noise with seed so that the same input and seed
+// always give the same output.
+func NewQuantizer(shift uint, shape DitherShape, seed int64) *Quantizer {
+	if shift == 0 || shift > 31 {
+		panic("dsp: quantizer needs to drop between 1 and 31 bits")
+	}
+	return &Quantizer{shift: shift, shape: shape, rng: rand.New(rand.NewSource(seed))}
+}
+
+// Process reduces the samples in place, leaving each one in the range of
+// the reduced bit depth.
+func (q *Quantizer) Process(samples []int32) {
+	step := float64(int64(1) << q.shift)
+	max, min := float64(int32(math.MaxInt32)>>q.shift), float64(int32(math.MinInt32)>>q.shift)
+
+	for i, v := range samples {
+		x := float64(v) / step
+		switch q.shape {
+		case DitherRectangular:
+			x += q.rng.Float64() - 0.5
+		case DitherTriangular:
+			x += q.rng.Float64() - q.rng.Float64()
+		}
+
+		switch y := math.Round(x); {
+		case y > max:
+			samples[i] = int32(max)
+		case y < min:
+			samples[i] = int32(min)
+		default:
+			samples[i] = int32(y)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package dsp
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// quietRamp returns n 32 bit samples that climb a few steps of 16 bits, so
+// that reducing them to 16 bits leaves mostly rounding error.
+func quietRamp(n int) []int32 {
+	samples := make([]int32, n)
+	for i := range samples {
+		samples[i] = int32(i * 997 % (8 << 16))
+	}
+	return samples
+}
+
+// quantize returns in reduced to 16 bits with the dither shape seeded with seed.
+func quantize(shape DitherShape, seed int64, in []int32) []int32 {
+	out := append([]int32(nil), in...)
+	NewQuantizer(16, shape, seed).Process(out)
+	return out
+}
+
+// TestQuantizerSeededDither checks that dither moves the low bits of the
+// reduced samples away from plain rounding by no more than its noise, and
+// that the same seed always moves them the same way.
+func TestQuantizerSeededDither(t *testing.T) {
+	in := quietRamp(4096)
+	rounded := quantize(DitherNone, 1, in)
+	for i, v := range in {
+		if want := int32(math.Round(float64(v) / (1 << 16))); rounded[i] != want {
+			t.Fatalf("undithered sample %d = %d, want %d", i, rounded[i], want)
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		shape DitherShape
+		// spread is how far in steps of the reduced depth a sample can
+		// land from its exact value.
+		spread float64
+	}{
+		{"rectangular", DitherRectangular, 1},
+		{"triangular", DitherTriangular, 1.5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := quantize(tc.shape, 1, in)
+			if again := quantize(tc.shape, 1, in); !reflect.DeepEqual(out, again) {
+				t.Error("the same seed gave different samples")
+			}
+			if other := quantize(tc.shape, 2, in); reflect.DeepEqual(out, other) {
+				t.Error("a different seed gave the same samples")
+			}
+
+			var changed int
+			for i, v := range in {
+				if out[i] != rounded[i] {
+					changed++
+				}
+				if d := math.Abs(float64(out[i]) - float64(v)/(1<<16)); d > tc.spread {
+					t.Fatalf("sample %d = %d, %.2f steps from %d", i, out[i], d, v)
+				}
+			}
+			if changed == 0 {
+				t.Error("dither didn't change any samples")
+			}
+		})
+	}
+}
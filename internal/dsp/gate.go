@@ -0,0 +1,72 @@
+package dsp
+
+import (
+	"math"
+	"time"
+)
+
+// gateDetectorTime is how quickly the level the gate compares against its
+// threshold falls away, so that zero crossings in a loud signal don't
+// look like silence.
+const gateDetectorTime = 10 * time.Millisecond
+
+// Gate silences interleaved frames while their level is below a threshold.
+// The gain fades in over the attack time once the level rises above the
+// threshold and fades out over the release time once it falls below,
+// so the gate doesn't chatter on signals that hover around it.
+type Gate struct {
+	threshold float64
+	fullScale float64
+	channels  int
+
+	attackStep, releaseStep float64
+	decay                   float64
+
+	level float64
+	gain  float64
+}
+
+// NewGate returns a Gate for frames of channels samples at sampleRate Hz
+// whose samples reach fullScale. The threshold is a fraction of full scale.
+func NewGate(threshold, fullScale float64, sampleRate, channels int, attack, release time.Duration) *Gate {
+	if channels <= 0 || sampleRate <= 0 || attack <= 0 || release <= 0 {
+		panic("dsp: gate needs a positive sample rate, channel count, attack and release")
+	}
+
+	frames := func(d time.Duration) float64 { return math.Max(1, d.Seconds()*float64(sampleRate)) }
+
+	return &Gate{
+		threshold:   threshold,
+		fullScale:   fullScale,
+		channels:    channels,
+		attackStep:  1 / frames(attack),
+		releaseStep: 1 / frames(release),
+		decay:       math.Exp(-1 / frames(gateDetectorTime)),
+	}
+}
+
+// Process gates the interleaved frames in samples in place.
+func (g *Gate) Process(samples []int32) {
+	for i := 0; i+g.channels <= len(samples); i += g.channels {
+		frame := samples[i : i+g.channels]
+
+		var peak float64
+		for _, v := range frame {
+			peak = math.Max(peak, math.Abs(float64(v))/g.fullScale)
+		}
+		g.level = math.Max(peak, g.level*g.decay)
+
+		if g.level >= g.threshold {
+			g.gain = math.Min(1, g.gain+g.attackStep)
+		} else {
+			g.gain = math.Max(0, g.gain-g.releaseStep)
+		}
+
+		if g.gain == 1 {
+			continue
+		}
+		for j, v := range frame {
+			frame[j] = int32(math.Round(float64(v) * g.gain))
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package dsp
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestGateNoisyThenLoud gates noise at 1% of full scale, then a sine at
+// half scale, then the noise again, and checks that the noise is zeroed,
+// apart from the release after the sine, and that the sine passes once
+// the gate has opened.
+func TestGateNoisyThenLoud(t *testing.T) {
+	const sampleRate, section = 8000, 8000
+	rng := rand.New(rand.NewSource(1))
+
+	samples := make([]int32, 3*section)
+	for i := range samples {
+		if i >= section && i < 2*section {
+			samples[i] = int32(0.5 * math.MaxInt16 * math.Sin(2*math.Pi*440*float64(i)/sampleRate))
+		} else {
+			samples[i] = int32(0.01 * math.MaxInt16 * (2*rng.Float64() - 1))
+		}
+	}
+	in := append([]int32(nil), samples...)
+
+	g := NewGate(0.05, 1<<15, sampleRate, 1, time.Millisecond, 50*time.Millisecond)
+	g.Process(samples)
+
+	for i, v := range samples[:section] {
+		if v != 0 {
+			t.Fatalf("noise at frame %d is %d, want it gated to 0", i, v)
+		}
+	}
+
+	// the gate opens over the attack time of 8 frames.
+	for i := section + 8; i < 2*section; i++ {
+		if samples[i] != in[i] {
+			t.Fatalf("sine at frame %d is %d, want it passed as %d", i, samples[i], in[i])
+		}
+	}
+
+	// the level the gate detects takes about 25ms to fall under the
+	// threshold, then it closes over the release time of 50ms.
+	closed := 2*section + sampleRate/10
+	for i := 2 * section; i < closed; i++ {
+		if math.Abs(float64(samples[i])) > math.Abs(float64(in[i])) {
+			t.Fatalf("noise at frame %d is %d, louder than the %d it was", i, samples[i], in[i])
+		}
+	}
+	for i := closed; i < len(samples); i++ {
+		if samples[i] != 0 {
+			t.Fatalf("noise at frame %d is %d, want it gated to 0", i, samples[i])
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package dsp
+
+import "math"
+
+const (
+	// loudnessBlock is the length of the blocks loudness is measured over, in steps.
+	// Blocks are 400ms long and start every 100ms, so each overlaps the last by 75%.
+	loudnessBlock = 4
+	// loudnessStep is the length in seconds of the step between blocks.
+	loudnessStep = 0.1
+
+	// absoluteGate is the loudness in LUFS below which blocks are left out, so that silence doesn't count.
+	absoluteGate = -70
+	// relativeGate is how far in LU below the loudness of the blocks above
+	// the absolute gate a block can be and still count.
+	relativeGate = -10
+)
+
+// kStage is one of the two biquads of the K-weighting filter, for one channel.
+type kStage struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (k *kStage) filter(x float64) float64 {
+	y := k.b0*x + k.b1*k.x1 + k.b2*k.x2 - k.a1*k.y1 - k.a2*k.y2
+	k.x2, k.x1 = k.x1, x
+	k.y2, k.y1 = k.y1, y
+	return y
+}
+
+// LoudnessMeter measures the integrated loudness of interleaved frames
+// the way EBU R128 does, following ITU-R BS.1770: samples are K-weighted,
+// their mean square is taken over overlapping 400ms blocks and blocks
+// that are quieter than an absolute and a relative gate are left out.
+// Every channel is weighted equally, as BS.1770 does for the front channels.
+type LoudnessMeter struct {
+	channels  int
+	fullScale float64
+	shelf     []kStage
+	highPass  []kStage
+
+	// step is the number of frames in every 100ms step.
+	step int
+	// frames is the number of frames in the current step and sum their weighted squares.
+	frames int
+	sum    float64
+	// steps holds the sums of the last loudnessBlock steps.
+	steps []float64
+
+	// blocks holds the mean square of every complete block.
+	blocks []float64
+}
+
+// NewLoudnessMeter returns a LoudnessMeter for frames of channels samples
+// at sampleRate Hz whose samples reach fullScale.
+func NewLoudnessMeter(sampleRate, channels int, fullScale float64) *LoudnessMeter {
+	if sampleRate <= 0 || channels <= 0 {
+		panic("dsp: loudness meter needs a positive sample rate and channel count")
+	}
+	fs := float64(sampleRate)
+
+	// the coefficients of both stages are derived for any sample rate from
+	// their analog prototypes, matching those BS.1770 gives at 48000 Hz.
+	k := math.Tan(math.Pi * 1681.974450955533 / fs)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := kStage{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	k = math.Tan(math.Pi * 38.13547087602444 / fs)
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	highPass := kStage{b0: 1, b1: -2, b2: 1, a1: 2 * (k*k - 1) / a0, a2: (1 - k/q + k*k) / a0}
+
+	m := &LoudnessMeter{
+		channels:  channels,
+		fullScale: fullScale,
+		shelf:     make([]kStage, channels),
+		highPass:  make([]kStage, channels),
+		step:      int(math.Round(fs * loudnessStep)),
+	}
+	for c := 0; c < channels; c++ {
+		m.shelf[c], m.highPass[c] = shelf, highPass
+	}
+	return m
+}
+
+// Process measures the interleaved frames in samples.
+func (m *LoudnessMeter) Process(samples []int32) {
+	for i := 0; i+m.channels <= len(samples); i += m.channels {
+		for c, v := range samples[i : i+m.channels] {
+			y := m.highPass[c].filter(m.shelf[c].filter(float64(v) / m.fullScale))
+			m.sum += y * y
+		}
+
+		if m.frames++; m.frames < m.step {
+			continue
+		}
+
+		m.steps = append(m.steps, m.sum)
+		if len(m.steps) > loudnessBlock {
+			m.steps = m.steps[1:]
+		}
+		if len(m.steps) == loudnessBlock {
+			var sum float64
+			for _, s := range m.steps {
+				sum += s
+			}
+			m.blocks = append(m.blocks, sum/float64(loudnessBlock*m.step))
+		}
+		m.frames, m.sum = 0, 0
+	}
+}
+
+// Integrated returns the integrated loudness in LUFS of the frames
+// processed so far, or -Inf if none of their blocks are above the gates.
+func (m *LoudnessMeter) Integrated() float64 {
+	gated := func(threshold float64) float64 {
+		var sum float64
+		var n int
+		for _, b := range m.blocks {
+			if blockLoudness(b) > threshold {
+				sum += b
+				n++
+			}
+		}
+		if n == 0 {
+			return math.Inf(-1)
+		}
+		return blockLoudness(sum / float64(n))
+	}
+
+	loudness := gated(absoluteGate)
+	if math.IsInf(loudness, -1) {
+		return loudness
+	}
+	return gated(loudness + relativeGate)
+}
+
+// blockLoudness returns the loudness in LUFS of a block with the mean square ms,
+// offset so that a 1 kHz sine reads as its RMS level relative to full scale.
+func blockLoudness(ms float64) float64 { return -0.691 + 10*math.Log10(ms) }
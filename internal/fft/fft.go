@@ -0,0 +1,46 @@
+// Package fft computes discrete Fourier transforms.
+package fft
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// IsPowerOfTwo reports whether n is a length Transform accepts.
+func IsPowerOfTwo(n int) bool { return n > 0 && n&(n-1) == 0 }
+
+// Transform replaces x with its discrete Fourier transform using the
+// iterative radix-2 Cooley-Tukey algorithm. len(x) must be a power of two.
+func Transform(x []complex128) {
+	n := len(x)
+	if !IsPowerOfTwo(n) {
+		panic("fft: length is not a power of two")
+	}
+
+	// reorder x so that each butterfly pass works on adjacent pairs.
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		half := size / 2
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < half; k++ {
+				a, b := x[start+k], x[start+k+half]*w
+				x[start+k], x[start+k+half] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Package resample converts interleaved samples between sample rates.
+//
+// Samples are resampled by linear interpolation between neighbouring
+// frames. That's cheap and adds just one frame of latency, but there's
+// no anti-aliasing filter: downsampling folds content above the new
+// Nyquist frequency back into the signal, and upsampling slightly dulls
+// the highest frequencies. It's accurate enough for speech, where little
+// energy sits near the top of the band, but not for music mastering.
+package resample
+
+// Resampler converts a stream of interleaved frames from one sample rate
+// to another. Consecutive calls to Resample continue the same stream.
+type Resampler struct {
+	from, to int
+	channels int
+
+	// phase is the position of the next output frame in units of
+	// 1/to input frames, counted from the first frame of buf.
+	phase int64
+	// buf holds the last input frame of the previous call followed
+	// by the frames of the current one.
+	buf []int32
+}
+
+// New returns a Resampler from rate from to rate to for frames of channels samples.
+func New(from, to, channels int) *Resampler {
+	if from <= 0 || to <= 0 || channels <= 0 {
+		panic("resample: rates and channels must be positive")
+	}
+	return &Resampler{from: from, to: to, channels: channels}
+}
+
+// Resample appends the frames of in at the output rate to out and returns it.
+// In must hold whole frames. The last frame of in is kept to interpolate
+// against the next call, so the final frame of a stream is never written.
+func (r *Resampler) Resample(out, in []int32) []int32 {
+	r.buf = append(r.buf, in...)
+
+	c := r.channels
+	n := int64(len(r.buf) / c)
+	to, from := int64(r.to), int64(r.from)
+
+	for {
+		i, frac := r.phase/to, r.phase%to
+		if i+1 >= n {
+			break
+		}
+
+		a, b := r.buf[i*int64(c):], r.buf[(i+1)*int64(c):]
+		for ch := 0; ch < c; ch++ {
+			x, y := int64(a[ch]), int64(b[ch])
+			out = append(out, int32(x+(y-x)*frac/to))
+		}
+		r.phase += from
+	}
+
+	// only the last frame is needed to continue the stream.
+	if n > 1 {
+		r.phase -= (n - 1) * to
+		r.buf = append(r.buf[:0], r.buf[(n-1)*int64(c):]...)
+	}
+	return out
+}
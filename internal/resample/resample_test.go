@@ -0,0 +1,68 @@
+package resample
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestResampleFrames resamples a tenth of a second of stereo ramps,
+// whichever buffer size they're passed in, and checks that the frame count
+// follows the ratio of the rates and that the ramps are interpolated along
+// their line: input frame i holds i*to, so output frame k holds k*from.
+func TestResampleFrames(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		from, to int
+	}{
+		{"48000 to 44100", 48000, 44100},
+		{"44100 to 48000", 44100, 48000},
+		{"48000 to 16000", 48000, 16000},
+		{"8000 to 48000", 8000, 48000},
+		{"same rate", 16000, 16000},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			frames := tc.from / 10
+			in := make([]int32, 2*frames)
+			for i := 0; i < frames; i++ {
+				in[2*i], in[2*i+1] = int32(i*tc.to), -int32(i*tc.to)
+			}
+
+			// the last frame is kept for the next call, so the output
+			// covers the frames-1 frames before it, which falls short of
+			// the ratio of the rates by at most what one input frame makes.
+			want := ((frames-1)*tc.to + tc.from - 1) / tc.from
+			ratio, short := frames*tc.to/tc.from, (tc.to+tc.from-1)/tc.from
+			if want > ratio || ratio-want > short {
+				t.Fatalf("want %d frames, not within %d of %d", want, short, ratio)
+			}
+
+			var whole []int32
+			for _, buffer := range []int{frames, 64, 441, 1} {
+				r := New(tc.from, tc.to, 2)
+				var out []int32
+				for i := 0; i < frames; i += buffer {
+					end := i + buffer
+					if end > frames {
+						end = frames
+					}
+					out = r.Resample(out, in[2*i:2*end])
+				}
+
+				if got := len(out) / 2; got != want {
+					t.Fatalf("%d frame buffers: resampled %d frames to %d, want %d", buffer, frames, got, want)
+				}
+				if whole == nil {
+					whole = out
+				} else if !reflect.DeepEqual(out, whole) {
+					t.Fatalf("%d frame buffers resample differently from a single one", buffer)
+				}
+			}
+
+			for k := 0; k < len(whole)/2; k++ {
+				if l, r := whole[2*k], whole[2*k+1]; l != int32(k*tc.from) || r != -int32(k*tc.from) {
+					t.Fatalf("frame %d is %d, %d, want %d, %d", k, l, r, k*tc.from, -k*tc.from)
+				}
+			}
+		})
+	}
+}